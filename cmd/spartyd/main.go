@@ -2,17 +2,26 @@ package main
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log"
 	"net/http"
 	"os"
 	"os/signal"
+	"strconv"
+	"strings"
 	"syscall"
 	"time"
 
+	"github.com/epels/sparty/events"
+	"github.com/epels/sparty/guest"
 	"github.com/epels/sparty/handler"
 	"github.com/epels/sparty/jobqueue"
+	"github.com/epels/sparty/partyqueue"
+	"github.com/epels/sparty/policy"
+	"github.com/epels/sparty/resolver"
 	"github.com/epels/sparty/spotify"
+	"github.com/epels/sparty/spotifyurl"
 )
 
 var (
@@ -24,7 +33,8 @@ var (
 	spartyAuthToken     = mustGetenv("SPARTY_AUTH_TOKEN")
 	spotifyClientID     = mustGetenv("SPOTIFY_CLIENT_ID")
 	spotifyClientSecret = mustGetenv("SPOTIFY_CLIENT_SECRET")
-	spotifyRefreshToken = mustGetenv("SPOTIFY_REFRESH_TOKEN")
+	// Optional: the host can connect their account from a browser instead.
+	spotifyRefreshToken = os.Getenv("SPOTIFY_REFRESH_TOKEN")
 )
 
 func main() {
@@ -34,40 +44,136 @@ func main() {
 		p = "8080"
 	}
 	addr := ":" + p
-	jq := jobqueue.NewMemory()
-	sc := spotify.NewClient(spotifyClientID, spotifyClientSecret, spotifyRefreshToken)
+	// Public URL spartyd is reachable on, used to have Spotify redirect back
+	// after connecting an account.
+	baseURL := strings.TrimSuffix(os.Getenv("SPARTY_BASE_URL"), "/")
+	if baseURL == "" {
+		baseURL = "http://localhost:" + p
+	}
+	maxExpand := intEnv("SPARTY_MAX_EXPAND_TRACKS", 25)
+	// Restrict search results to tracks playable in this market.
+	market := os.Getenv("SPARTY_MARKET")
+	if market == "" {
+		market = "from_token"
+	}
+	bus := events.NewBus()
+	jq, err := newJobqueue(jobqueue.WithDoneFunc(func(j jobqueue.Job, st jobqueue.Status) {
+		song := events.Song{URI: j.URI, Requester: j.Requester}
+		if st.State == jobqueue.StateFailed {
+			song.Error = st.Err
+			bus.Publish(events.JobFailed, song)
+			return
+		}
+		bus.Publish(events.JobSent, song)
+	}))
+	if err != nil {
+		errLog.Fatalf("Creating jobqueue: %s", err)
+	}
+	tokenStore := os.Getenv("SPARTY_TOKEN_STORE")
+	if tokenStore == "" {
+		tokenStore = "sparty-token.json"
+	}
+	scOpts := []spotify.Option{spotify.WithTokenStore(spotify.NewFileTokenStore(tokenStore))}
+	if v := os.Getenv("SPOTIFY_RATE_LIMIT"); v != "" {
+		rps, err := strconv.ParseFloat(v, 64)
+		if err != nil || rps <= 0 {
+			errLog.Fatalf("Invalid value for environment variable: SPOTIFY_RATE_LIMIT (%s)", v)
+		}
+		scOpts = append(scOpts, spotify.WithRateLimit(rps, intEnv("SPOTIFY_RATE_BURST", 5)))
+	}
+	sc := spotify.NewClient(spotifyClientID, spotifyClientSecret, spotifyRefreshToken, scOpts...)
+	var pol policy.Policy
+	if path := os.Getenv("SPARTY_POLICY"); path != "" {
+		if pol, err = policy.Load(path); err != nil {
+			errLog.Fatalf("Loading policy: %s", err)
+		}
+	}
+	pe := policy.NewEngine(sc, pol)
+	limits := handler.Limits{
+		PerGuest:   intEnv("SPARTY_GUEST_LIMIT", 0),
+		Window:     durationEnv("SPARTY_GUEST_LIMIT_WINDOW", time.Hour),
+		MaxPending: intEnv("SPARTY_GUEST_MAX_PENDING", 0),
+		Rate:       float64(intEnv("SPARTY_ENQUEUE_RATE", 0)) / 60,
+		Burst:      intEnv("SPARTY_ENQUEUE_BURST", 5),
+	}
 
 	// Channels that can cancel the execution of the daemon.
-	errCh := make(chan error, 2)
+	errCh := make(chan error, 4)
 	sigCh := make(chan os.Signal, 1)
 	signal.Notify(sigCh, syscall.SIGINT, syscall.SIGTERM)
+	usrCh := make(chan os.Signal, 1)
+	signal.Notify(usrCh, syscall.SIGUSR1)
+	go togglePause(jq, usrCh)
 
-	// Start the job consumer/worker.
+	// Start the job consumer/worker. The host can pause it through the admin
+	// API, or by sending SIGUSR1, e.g. during speeches.
 	jqCtx, jqCancel := context.WithCancel(context.Background())
 	defer jqCancel()
 	go func() {
 		infoLog.Print("Starting job worker")
-		err := jq.Consume(jqCtx, func(url string) {
-			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-			defer cancel()
-			if err := sc.AddToQueue(ctx, url); err != nil {
-				errLog.Printf("spotify: Client.AddToQueue: %s", err)
-				return
+		err := jq.Consume(jqCtx, func(j jobqueue.Job) error {
+			if err := process(sc, pe, j.URI, maxExpand); err != nil {
+				errLog.Printf("Processing %s (requested by %q): %s", j.URI, j.Requester, err)
+				return err
 			}
-			infoLog.Printf("Enqueued %s", url)
+			return nil
 		})
-		errCh <- fmt.Errorf("jobqueue: memory.Consume: %s", err)
+		errCh <- fmt.Errorf("jobqueue: %T.Consume: %s", jq, err)
+	}()
+	go func() {
+		err := watchTrack(jqCtx, sc, bus, 5*time.Second)
+		errCh <- fmt.Errorf("watchTrack: %s", err)
 	}()
 
 	// Create the API server and start listening.
-	h := handler.New(errLog, infoLog, jq, spartyAuthToken)
+	hOpts := []handler.Option{
+		handler.WithResolver(resolver.NewMetadata(sc, market)),
+		handler.WithSearcher(sc, market),
+		handler.WithAuthenticator(sc, baseURL+"/auth/callback"),
+		handler.WithGuests(guest.NewRegistry()),
+		handler.WithLimits(limits),
+		handler.WithCooldown(durationEnv("SPARTY_COOLDOWN", time.Hour)),
+		handler.WithPolicy(pe),
+		handler.WithSkip(sc, handler.SkipVotes{
+			Votes:    intEnv("SPARTY_SKIP_VOTES", 0),
+			Fraction: floatEnv("SPARTY_SKIP_FRACTION", 0.5),
+		}),
+		handler.WithNowPlaying(sc, durationEnv("SPARTY_NOW_PLAYING_CACHE", 5*time.Second)),
+		handler.WithJobStatus(jq),
+		handler.WithEvents(bus),
+		handler.WithUI(),
+		// Not served unless SPARTY_ADMIN_TOKEN is set.
+		handler.WithAdmin(handler.Admin{
+			Token:    os.Getenv("SPARTY_ADMIN_TOKEN"),
+			Worker:   jq,
+			Jobqueue: jq,
+			Policy:   pe,
+		}),
+	}
+	if boolEnv("SPARTY_MODERATION") {
+		hOpts = append(hOpts, handler.WithModeration())
+	}
+	// Requests go into the jobqueue right away, unless they wait in the party
+	// queue for their turn.
+	var requests putter = jq
+	if boolEnv("SPARTY_PARTY_QUEUE") {
+		pq := partyqueue.New(partyqueue.WithCapacity(intEnv("SPARTY_PARTY_QUEUE_CAPACITY", partyqueue.DefaultCapacity)))
+		lead := durationEnv("SPARTY_PARTY_QUEUE_LEAD", 20*time.Second)
+		go func() {
+			infoLog.Print("Starting party queue scheduler")
+			err := pq.Schedule(jqCtx, sc, jq, 5*time.Second, lead, errLog)
+			errCh <- fmt.Errorf("partyqueue: %T.Schedule: %s", pq, err)
+		}()
+		requests = pq
+		hOpts = append(hOpts, handler.WithPartyQueue(pq))
+	}
+	h := handler.New(errLog, infoLog, requests, spartyAuthToken, hOpts...)
 	s := http.Server{
 		Addr:    addr,
-		Handler: h,
+		Handler: withTimeout(h, 5*time.Second, "/events"),
 
-		IdleTimeout:  1 * time.Minute,
-		ReadTimeout:  5 * time.Second,
-		WriteTimeout: 5 * time.Second,
+		IdleTimeout: 1 * time.Minute,
+		ReadTimeout: 5 * time.Second,
 	}
 	go func() {
 		infoLog.Printf("Starting server on %q", addr)
@@ -89,8 +195,331 @@ func main() {
 		errLog.Printf("net/http: Server.Shutdown: %v", err)
 	}
 	if err := jq.Close(); err != nil {
-		errLog.Printf("jobqueue: memory.Close: %s", err)
+		errLog.Printf("jobqueue: %T.Close: %s", jq, err)
+	}
+}
+
+// withTimeout makes h respond with a 503 if it takes longer than d, like a
+// WriteTimeout on the server would, except for requests to the streaming
+// endpoints in streams: those are meant to stay open.
+func withTimeout(h http.Handler, d time.Duration, streams ...string) http.Handler {
+	th := http.TimeoutHandler(h, d, "Timed out")
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		for _, path := range streams {
+			if r.URL.Path == path {
+				h.ServeHTTP(w, r)
+				return
+			}
+		}
+		th.ServeHTTP(w, r)
+	})
+}
+
+type putter interface {
+	Put(ctx context.Context, j jobqueue.Job) (string, error)
+}
+
+type queue interface {
+	putter
+	Close() error
+	Consume(ctx context.Context, fn func(j jobqueue.Job) error) error
+	Status(id string) (jobqueue.Status, bool)
+	Clear() (int, error)
+	DeadLetters() []jobqueue.DeadLetter
+	Redrive() (int, error)
+	Pause()
+	Resume()
+	Paused() bool
+	Len() int
+}
+
+// togglePause pauses the worker of jq if it is running, and resumes it if it
+// is paused, whenever a signal is received on sigCh.
+func togglePause(jq queue, sigCh <-chan os.Signal) {
+	for range sigCh {
+		if jq.Paused() {
+			jq.Resume()
+			infoLog.Printf("Resumed job worker (%d jobs pending)", jq.Len())
+		} else {
+			jq.Pause()
+			infoLog.Printf("Paused job worker (%d jobs pending)", jq.Len())
+		}
+	}
+}
+
+// newJobqueue creates the jobqueue backend selected by SPARTY_JOBQUEUE, with
+// the given options on top of the ones set through the environment.
+func newJobqueue(opts ...jobqueue.Option) (queue, error) {
+	rp := jobqueue.DefaultRetryPolicy
+	rp.MaxAttempts = intEnv("SPARTY_JOB_MAX_ATTEMPTS", rp.MaxAttempts)
+	opts = append([]jobqueue.Option{
+		jobqueue.WithRetryPolicy(rp),
+		jobqueue.WithCapacity(intEnv("SPARTY_JOBQUEUE_CAPACITY", jobqueue.DefaultCapacity)),
+	}, opts...)
+
+	switch b := os.Getenv("SPARTY_JOBQUEUE"); b {
+	case "", "memory":
+		return jobqueue.NewMemory(opts...), nil
+	case "fair":
+		weights, err := parseWeights(os.Getenv("SPARTY_JOBQUEUE_WEIGHTS"))
+		if err != nil {
+			return nil, fmt.Errorf("parseWeights: %s", err)
+		}
+		return jobqueue.NewFair(append(opts, jobqueue.WithWeights(weights))...), nil
+	case "file":
+		path := os.Getenv("SPARTY_JOBQUEUE_PATH")
+		if path == "" {
+			path = "sparty-jobs.log"
+		}
+		jq, err := jobqueue.NewFile(path, opts...)
+		if err != nil {
+			return nil, fmt.Errorf("jobqueue: NewFile: %s", err)
+		}
+		return jq, nil
+	default:
+		return nil, fmt.Errorf("unknown jobqueue backend %q", b)
+	}
+}
+
+// parseWeights parses weights of requesters like alice=2,bob=3.
+func parseWeights(s string) (map[string]int, error) {
+	weights := make(map[string]int)
+	if s == "" {
+		return weights, nil
+	}
+	for _, kv := range strings.Split(s, ",") {
+		i := strings.LastIndex(kv, "=")
+		if i < 1 {
+			return nil, fmt.Errorf("invalid weight %q", kv)
+		}
+		w, err := strconv.Atoi(kv[i+1:])
+		if err != nil || w < 1 {
+			return nil, fmt.Errorf("invalid weight %q", kv)
+		}
+		weights[strings.TrimSpace(kv[:i])] = w
+	}
+	return weights, nil
+}
+
+type trackWatcher interface {
+	// CurrentlyPlaying returns what is playing, or nil if nothing is.
+	CurrentlyPlaying(ctx context.Context) (*spotify.CurrentlyPlaying, error)
+}
+
+type eventBus interface {
+	Publish(typ events.Type, data interface{})
+	Subscribers() int
+}
+
+// watchTrack polls p every interval, and publishes an event to b whenever
+// another track starts playing. It only does so while someone subscribed to
+// b, so it doesn't use up the Spotify Web API rate limit for nothing.
+// Invocation blocks until the context is cancelled: then, the context error is
+// returned.
+func watchTrack(ctx context.Context, p trackWatcher, b eventBus, interval time.Duration) error {
+	t := time.NewTicker(interval)
+	defer t.Stop()
+
+	var playing string
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-t.C:
+		}
+		if b.Subscribers() == 0 {
+			// Whatever plays once someone subscribes is news to them.
+			playing = ""
+			continue
+		}
+
+		cctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+		cp, err := p.CurrentlyPlaying(cctx)
+		cancel()
+		if err != nil {
+			errLog.Printf("%T: CurrentlyPlaying: %s", p, err)
+			continue
+		}
+		if cp == nil || !cp.IsPlaying || cp.Item == nil || cp.Item.URI == playing {
+			continue
+		}
+		playing = cp.Item.URI
+		artists := make([]string, 0, len(cp.Item.Artists))
+		for _, a := range cp.Item.Artists {
+			artists = append(artists, a.Name)
+		}
+		b.Publish(events.TrackChanged, struct {
+			URI     string   `json:"uri"`
+			Name    string   `json:"name"`
+			Artists []string `json:"artists"`
+			Album   string   `json:"album"`
+		}{cp.Item.URI, cp.Item.Name, artists, cp.Item.Album.Name})
+	}
+}
+
+type expander interface {
+	AlbumTracks(ctx context.Context, id string, max int) ([]string, error)
+	PlaylistTracks(ctx context.Context, id string, max int) ([]string, error)
+}
+
+type player interface {
+	expander
+	AddToQueue(ctx context.Context, uri string) error
+}
+
+type checker interface {
+	Check(ctx context.Context, uri string) error
+}
+
+// process adds the song(s) uri refers to to the Spotify queue. Tracks of albums
+// and playlists that c does not allow are skipped. Errors are transient, unless
+// marked otherwise using jobqueue.Permanent.
+func process(p player, c checker, uri string, maxExpand int) error {
+	uris, err := expand(p, uri, maxExpand)
+	if err != nil {
+		return classify(fmt.Errorf("expand: %w", err))
+	}
+	if len(uris) != 1 || uris[0] != uri {
+		// Single tracks were checked upon request already.
+		if uris, err = allowed(c, uris); err != nil {
+			return classify(fmt.Errorf("allowed: %w", err))
+		}
+	}
+	for i, uri := range uris {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		err := p.AddToQueue(ctx, uri)
+		cancel()
+		if err != nil {
+			err = fmt.Errorf("spotify: Client.AddToQueue: %w", err)
+			if i > 0 {
+				// Retrying would add the tracks that did make it to the
+				// queue once more.
+				return jobqueue.Permanent(fmt.Errorf("added %d of %d tracks: %w", i, len(uris), err))
+			}
+			return classify(err)
+		}
+		infoLog.Printf("Enqueued %s", uri)
+	}
+	return nil
+}
+
+// allowed returns the uris that c allows, in order.
+func allowed(c checker, uris []string) ([]string, error) {
+	var ok []string
+	for _, uri := range uris {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		err := c.Check(ctx, uri)
+		cancel()
+		var v *policy.Violation
+		if errors.As(err, &v) {
+			infoLog.Printf("Skipping %s: %s", uri, v)
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%T: Check: %w", c, err)
+		}
+		ok = append(ok, uri)
+	}
+	return ok, nil
+}
+
+// classify marks err as permanent if it is a Spotify error that won't go away
+// by retrying, like a missing premium subscription, a track that does not
+// exist or a revoked refresh token.
+func classify(err error) error {
+	var serr *spotify.Error
+	if errors.As(err, &serr) && !serr.Temporary() {
+		return jobqueue.Permanent(err)
+	}
+	var aerr *spotify.AuthError
+	if errors.As(err, &aerr) && !aerr.Temporary() {
+		return jobqueue.Permanent(err)
+	}
+	return err
+}
+
+// expand resolves uri to the URIs of the tracks it refers to: albums and
+// playlists are expanded to (at most max of) their tracks, in order, anything
+// else is returned as is.
+func expand(e expander, uri string, max int) ([]string, error) {
+	l, err := spotifyurl.Parse(uri)
+	if err != nil {
+		return nil, jobqueue.Permanent(fmt.Errorf("spotifyurl: Parse: %w", err))
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	switch l.Type {
+	case spotifyurl.TypeAlbum:
+		uris, err := e.AlbumTracks(ctx, l.ID, max)
+		if err != nil {
+			return nil, fmt.Errorf("spotify: Client.AlbumTracks: %w", err)
+		}
+		return uris, nil
+	case spotifyurl.TypePlaylist:
+		uris, err := e.PlaylistTracks(ctx, l.ID, max)
+		if err != nil {
+			return nil, fmt.Errorf("spotify: Client.PlaylistTracks: %w", err)
+		}
+		return uris, nil
+	default:
+		return []string{uri}, nil
+	}
+}
+
+// intEnv gets the positive integer value of the environment variable key, or
+// def if it is not set.
+func intEnv(key string, def int) int {
+	v := os.Getenv(key)
+	if v == "" {
+		return def
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil || n < 1 {
+		errLog.Fatalf("Invalid value for environment variable: %s (%s)", key, v)
+	}
+	return n
+}
+
+// boolEnv reports whether the environment variable key is set to true.
+func boolEnv(key string) bool {
+	v := os.Getenv(key)
+	if v == "" {
+		return false
+	}
+	b, err := strconv.ParseBool(v)
+	if err != nil {
+		errLog.Fatalf("Invalid value for environment variable: %s (%s)", key, v)
+	}
+	return b
+}
+
+// floatEnv gets the positive float value of the environment variable key, or
+// def if it is not set.
+func floatEnv(key string, def float64) float64 {
+	v := os.Getenv(key)
+	if v == "" {
+		return def
+	}
+	f, err := strconv.ParseFloat(v, 64)
+	if err != nil || f <= 0 {
+		errLog.Fatalf("Invalid value for environment variable: %s (%s)", key, v)
+	}
+	return f
+}
+
+// durationEnv gets the positive duration value of the environment variable key,
+// e.g. 30m, or def if it is not set.
+func durationEnv(key string, def time.Duration) time.Duration {
+	v := os.Getenv(key)
+	if v == "" {
+		return def
+	}
+	d, err := time.ParseDuration(v)
+	if err != nil || d <= 0 {
+		errLog.Fatalf("Invalid value for environment variable: %s (%s)", key, v)
 	}
+	return d
 }
 
 func mustGetenv(key string) string {
@@ -0,0 +1,135 @@
+// Package events implements the bus that party events, like songs being
+// requested or sent to Spotify, are published to, so clients can follow along
+// as they happen.
+package events
+
+import (
+	"sync"
+	"time"
+)
+
+// Type is the type of an event.
+type Type string
+
+const (
+	// SongRequested is published when a song was put into the jobqueue (or
+	// the party queue).
+	SongRequested Type = "song_requested"
+	// JobSent is published when the worker sent a song to Spotify.
+	JobSent Type = "job_sent"
+	// JobFailed is published when the worker gave up on sending a song to
+	// Spotify.
+	JobFailed Type = "job_failed"
+	// TrackChanged is published when another track started playing.
+	TrackChanged Type = "track_changed"
+	// SkipVote is published when a guest voted to skip the track that is
+	// playing.
+	SkipVote Type = "skip_vote"
+)
+
+// Song is the data of the events about a song: SongRequested, JobSent and
+// JobFailed.
+type Song struct {
+	URI       string `json:"uri"`
+	Requester string `json:"requester,omitempty"`
+	// Error is why sending the song failed, for JobFailed.
+	Error string `json:"error,omitempty"`
+}
+
+// Event is something that happened at the party. Data is marshaled to JSON for
+// clients.
+type Event struct {
+	ID   uint64
+	Type Type
+	At   time.Time
+	Data interface{}
+}
+
+const (
+	// maxHistory is the number of events kept, so clients that reconnect can
+	// catch up on the ones they missed.
+	maxHistory = 100
+	// subscriberBuffer is the number of events a subscriber may lag behind
+	// before it is dropped.
+	subscriberBuffer = 32
+)
+
+type bus struct {
+	mu      sync.Mutex
+	lastID  uint64
+	history []Event
+	subs    map[chan Event]struct{}
+
+	// nowFunc returns the current local time. Can be used to instrument tests.
+	nowFunc func() time.Time
+}
+
+func NewBus() *bus {
+	return &bus{
+		subs:    make(map[chan Event]struct{}),
+		nowFunc: time.Now,
+	}
+}
+
+// Publish publishes an event of the given type to all subscribers. It never
+// blocks: subscribers that can't keep up are dropped, i.e. their channel is
+// closed.
+func (b *bus) Publish(typ Type, data interface{}) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.lastID++
+	e := Event{ID: b.lastID, Type: typ, At: b.nowFunc(), Data: data}
+	b.history = append(b.history, e)
+	if len(b.history) > maxHistory {
+		b.history = b.history[len(b.history)-maxHistory:]
+	}
+	for ch := range b.subs {
+		select {
+		case ch <- e:
+		default:
+			delete(b.subs, ch)
+			close(ch)
+		}
+	}
+}
+
+// Subscribe subscribes to the events published from now on. If lastID is not
+// zero, the events after the one with that ID that are still kept are
+// returned as well, so a client that reconnects can catch up. An ID beyond the
+// last one published, e.g. one from before a restart, is treated as zero.
+//
+// The returned channel is closed if the subscriber falls too far behind, or
+// once cancel is called: callers must always call cancel.
+func (b *bus) Subscribe(lastID uint64) (missed []Event, ch <-chan Event, cancel func()) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if lastID > 0 && lastID <= b.lastID {
+		for _, e := range b.history {
+			if e.ID > lastID {
+				missed = append(missed, e)
+			}
+		}
+	}
+	c := make(chan Event, subscriberBuffer)
+	b.subs[c] = struct{}{}
+	return missed, c, func() {
+		b.mu.Lock()
+		defer b.mu.Unlock()
+
+		if _, ok := b.subs[c]; ok {
+			delete(b.subs, c)
+			close(c)
+		}
+	}
+}
+
+// Subscribers returns the number of subscribers, so publishers can skip work
+// no one would see.
+func (b *bus) Subscribers() int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return len(b.subs)
+}
@@ -0,0 +1,87 @@
+package events
+
+import "testing"
+
+func ids(es []Event) []uint64 {
+	var ids []uint64
+	for _, e := range es {
+		ids = append(ids, e.ID)
+	}
+	return ids
+}
+
+func TestPublish(t *testing.T) {
+	b := NewBus()
+	_, ch, cancel := b.Subscribe(0)
+	defer cancel()
+
+	b.Publish(SongRequested, "foo")
+	e := <-ch
+	if e.ID != 1 || e.Type != SongRequested || e.Data != "foo" {
+		t.Errorf("Got %+v, expected song requested foo", e)
+	}
+
+	cancel()
+	if _, ok := <-ch; ok {
+		t.Error("Got true, expected false")
+	}
+	if n := b.Subscribers(); n != 0 {
+		t.Errorf("Got %d, expected 0", n)
+	}
+	// Cancelling twice is harmless.
+	cancel()
+}
+
+func TestSubscribeMissed(t *testing.T) {
+	b := NewBus()
+	for i := 0; i < maxHistory+10; i++ {
+		b.Publish(JobSent, i)
+	}
+
+	for _, tc := range []struct {
+		name   string
+		lastID uint64
+		exp    []uint64
+	}{
+		{"New", 0, nil},
+		{"Recent", maxHistory + 8, []uint64{maxHistory + 9, maxHistory + 10}},
+		{"Up to date", maxHistory + 10, nil},
+		{"Too old", 5, ids(b.history)},
+		{"Unknown", maxHistory + 11, nil},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			missed, _, cancel := b.Subscribe(tc.lastID)
+			defer cancel()
+
+			got := ids(missed)
+			if len(got) != len(tc.exp) {
+				t.Fatalf("Got %v, expected %v", got, tc.exp)
+			}
+			for i := range got {
+				if got[i] != tc.exp[i] {
+					t.Fatalf("Got %v, expected %v", got, tc.exp)
+				}
+			}
+		})
+	}
+}
+
+func TestSlowSubscriber(t *testing.T) {
+	b := NewBus()
+	_, ch, cancel := b.Subscribe(0)
+	defer cancel()
+
+	for i := 0; i < subscriberBuffer+1; i++ {
+		b.Publish(SkipVote, i)
+	}
+	var n int
+	for range ch {
+		n++
+	}
+	if n != subscriberBuffer {
+		t.Errorf("Got %d, expected %d", n, subscriberBuffer)
+	}
+	if n := b.Subscribers(); n != 0 {
+		t.Errorf("Got %d, expected 0", n)
+	}
+}
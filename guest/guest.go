@@ -0,0 +1,182 @@
+// Package guest keeps track of the guests of a party: who may request songs,
+// and who requested what.
+package guest
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	// ErrInvalidName is returned when issuing a token for an empty name.
+	ErrInvalidName = errors.New("invalid guest name")
+	// ErrNameTaken is returned when issuing a token for a name that is in use
+	// by another guest.
+	ErrNameTaken = errors.New("guest name taken")
+	// ErrNotFound is returned when revoking a guest that does not exist.
+	ErrNotFound = errors.New("guest not found")
+)
+
+// Guest is an identity that songs can be requested under.
+type Guest struct {
+	Name string `json:"name"`
+	// Host is set for the host of the party, who may manage guests.
+	Host bool `json:"host"`
+	// Trusted guests do not need the host's approval for their requests.
+	Trusted bool `json:"trusted"`
+	// ExpiresAt is when the guest's token stops working. The zero value means
+	// it never expires.
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// MarshalJSON encodes a zero ExpiresAt as null rather than as year 1.
+func (g Guest) MarshalJSON() ([]byte, error) {
+	type plain Guest
+	v := struct {
+		plain
+		ExpiresAt *time.Time `json:"expires_at"`
+	}{plain: plain(g)}
+	if !g.ExpiresAt.IsZero() {
+		v.ExpiresAt = &g.ExpiresAt
+	}
+	return json.Marshal(v)
+}
+
+// Expired reports whether the guest's token has expired at t.
+func (g Guest) Expired(t time.Time) bool {
+	return !g.ExpiresAt.IsZero() && !t.Before(g.ExpiresAt)
+}
+
+type registry struct {
+	mu sync.Mutex
+	// guests maps the SHA-256 hash of tokens to guests, so the map can be
+	// looked up without comparing raw tokens.
+	guests map[string]Guest
+
+	// nowFunc returns the current local time. Can be used to instrument tests.
+	nowFunc func() time.Time
+}
+
+// NewRegistry creates an empty, in-memory guest registry.
+func NewRegistry() *registry {
+	return &registry{
+		guests:  make(map[string]Guest),
+		nowFunc: time.Now,
+	}
+}
+
+// Issue issues a new token for a guest named name, who is trusted if trusted is
+// set. The token expires after ttl, or never if ttl is zero.
+func (r *registry) Issue(name string, ttl time.Duration, trusted bool) (Guest, string, error) {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return Guest{}, "", ErrInvalidName
+	}
+	tok, err := randomToken()
+	if err != nil {
+		return Guest{}, "", fmt.Errorf("guest: randomToken: %w", err)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.prune()
+	for _, g := range r.guests {
+		if strings.EqualFold(g.Name, name) {
+			return Guest{}, "", ErrNameTaken
+		}
+	}
+	g := Guest{Name: name, Trusted: trusted}
+	if ttl > 0 {
+		g.ExpiresAt = r.nowFunc().Add(ttl)
+	}
+	r.guests[hash(tok)] = g
+	return g, tok, nil
+}
+
+// Lookup returns the guest that token belongs to. It returns false if there is
+// no such guest, or if their token expired.
+func (r *registry) Lookup(token string) (Guest, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	g, ok := r.guests[hash(token)]
+	if !ok || g.Expired(r.nowFunc()) {
+		return Guest{}, false
+	}
+	return g, true
+}
+
+// Revoke revokes the token of the guest named name.
+func (r *registry) Revoke(name string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for h, g := range r.guests {
+		if strings.EqualFold(g.Name, name) {
+			delete(r.guests, h)
+			return nil
+		}
+	}
+	return ErrNotFound
+}
+
+// List lists all guests whose token did not expire, ordered by name.
+func (r *registry) List() []Guest {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.prune()
+	gs := make([]Guest, 0, len(r.guests))
+	for _, g := range r.guests {
+		gs = append(gs, g)
+	}
+	sort.Slice(gs, func(i, j int) bool { return gs[i].Name < gs[j].Name })
+	return gs
+}
+
+// prune forgets guests whose token expired. Must be called with mu held.
+func (r *registry) prune() {
+	now := r.nowFunc()
+	for h, g := range r.guests {
+		if g.Expired(now) {
+			delete(r.guests, h)
+		}
+	}
+}
+
+func hash(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+func randomToken() (string, error) {
+	b := make([]byte, 24)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+type contextKey struct{}
+
+// NewContext returns a copy of ctx carrying g.
+func NewContext(ctx context.Context, g Guest) context.Context {
+	return context.WithValue(ctx, contextKey{}, g)
+}
+
+// FromContext returns the guest carried by ctx, if any.
+func FromContext(ctx context.Context) (Guest, bool) {
+	g, ok := ctx.Value(contextKey{}).(Guest)
+	return g, ok
+}
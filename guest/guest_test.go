@@ -0,0 +1,155 @@
+package guest
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestIssue(t *testing.T) {
+	t.Run("OK", func(t *testing.T) {
+		r := NewRegistry()
+		g, tok, err := r.Issue(" alice ", 0, false)
+		if err != nil {
+			t.Fatalf("Got %T (%s), expected nil", err, err)
+		}
+		if g.Name != "alice" {
+			t.Errorf("Got %q, expected alice", g.Name)
+		}
+		if tok == "" {
+			t.Error("Got empty token")
+		}
+		if !g.ExpiresAt.IsZero() {
+			t.Errorf("Got %s, expected zero time", g.ExpiresAt)
+		}
+		if got, ok := r.Lookup(tok); !ok || got != g {
+			t.Errorf("Got %v (%t), expected %v", got, ok, g)
+		}
+	})
+
+	t.Run("Invalid name", func(t *testing.T) {
+		r := NewRegistry()
+		if _, _, err := r.Issue("  ", 0, false); !errors.Is(err, ErrInvalidName) {
+			t.Errorf("Got %v, expected %v", err, ErrInvalidName)
+		}
+	})
+
+	t.Run("Name taken", func(t *testing.T) {
+		r := NewRegistry()
+		if _, _, err := r.Issue("alice", 0, false); err != nil {
+			t.Fatalf("Got %T (%s), expected nil", err, err)
+		}
+		if _, _, err := r.Issue("Alice", 0, false); !errors.Is(err, ErrNameTaken) {
+			t.Errorf("Got %v, expected %v", err, ErrNameTaken)
+		}
+	})
+}
+
+func TestLookup(t *testing.T) {
+	now := time.Date(2020, 1, 1, 20, 0, 0, 0, time.UTC)
+	r := NewRegistry()
+	r.nowFunc = func() time.Time { return now }
+
+	_, tok, err := r.Issue("alice", time.Hour, false)
+	if err != nil {
+		t.Fatalf("Got %T (%s), expected nil", err, err)
+	}
+
+	t.Run("Unknown token", func(t *testing.T) {
+		if _, ok := r.Lookup("bogus"); ok {
+			t.Error("Got true, expected false")
+		}
+	})
+
+	t.Run("Not expired", func(t *testing.T) {
+		now = now.Add(59 * time.Minute)
+		if _, ok := r.Lookup(tok); !ok {
+			t.Error("Got false, expected true")
+		}
+	})
+
+	t.Run("Expired", func(t *testing.T) {
+		now = now.Add(time.Minute)
+		if _, ok := r.Lookup(tok); ok {
+			t.Error("Got true, expected false")
+		}
+		// Its name can be reused.
+		if _, _, err := r.Issue("alice", 0, false); err != nil {
+			t.Errorf("Got %T (%s), expected nil", err, err)
+		}
+	})
+}
+
+func TestRevoke(t *testing.T) {
+	r := NewRegistry()
+	_, tok, err := r.Issue("alice", 0, false)
+	if err != nil {
+		t.Fatalf("Got %T (%s), expected nil", err, err)
+	}
+
+	if err := r.Revoke("alice"); err != nil {
+		t.Errorf("Got %T (%s), expected nil", err, err)
+	}
+	if _, ok := r.Lookup(tok); ok {
+		t.Error("Got true, expected false")
+	}
+	if err := r.Revoke("alice"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Got %v, expected %v", err, ErrNotFound)
+	}
+}
+
+func TestList(t *testing.T) {
+	now := time.Date(2020, 1, 1, 20, 0, 0, 0, time.UTC)
+	r := NewRegistry()
+	r.nowFunc = func() time.Time { return now }
+	for _, name := range []string{"carol", "alice", "bob"} {
+		if _, _, err := r.Issue(name, 0, false); err != nil {
+			t.Fatalf("Got %T (%s), expected nil", err, err)
+		}
+	}
+	if _, _, err := r.Issue("dave", time.Minute, false); err != nil {
+		t.Fatalf("Got %T (%s), expected nil", err, err)
+	}
+	now = now.Add(time.Minute)
+
+	gs := r.List()
+	if len(gs) != 3 {
+		t.Fatalf("Got %d guests, expected 3", len(gs))
+	}
+	for i, name := range []string{"alice", "bob", "carol"} {
+		if gs[i].Name != name {
+			t.Errorf("Got %q, expected %q", gs[i].Name, name)
+		}
+	}
+}
+
+func TestMarshalJSON(t *testing.T) {
+	for _, tc := range []struct {
+		g   Guest
+		exp string
+	}{
+		{Guest{Name: "alice"}, `{"name":"alice","host":false,"trusted":false,"expires_at":null}`},
+		{Guest{Name: "bob", ExpiresAt: time.Date(2020, 1, 1, 20, 0, 0, 0, time.UTC)}, `{"name":"bob","host":false,"trusted":false,"expires_at":"2020-01-01T20:00:00Z"}`},
+	} {
+		b, err := json.Marshal(tc.g)
+		if err != nil {
+			t.Fatalf("Got %T (%s), expected nil", err, err)
+		}
+		if s := string(b); s != tc.exp {
+			t.Errorf("Got %q, expected %q", s, tc.exp)
+		}
+	}
+}
+
+func TestContext(t *testing.T) {
+	if _, ok := FromContext(context.Background()); ok {
+		t.Error("Got true, expected false")
+	}
+	g := Guest{Name: "alice"}
+	got, ok := FromContext(NewContext(context.Background(), g))
+	if !ok || got != g {
+		t.Errorf("Got %v (%t), expected %v", got, ok, g)
+	}
+}
@@ -0,0 +1,536 @@
+package handler
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/epels/sparty/guest"
+	"github.com/epels/sparty/jobqueue"
+	"github.com/epels/sparty/policy"
+)
+
+type worker interface {
+	// Pause makes the worker hold off on sending songs to Spotify, until
+	// Resume is called. Songs are still accepted meanwhile.
+	Pause()
+	Resume()
+	Paused() bool
+	// Len returns the number of jobs waiting to be processed.
+	Len() int
+}
+
+type adminJobqueue interface {
+	// Clear drops the jobs that are waiting to be processed, and returns how
+	// many there were.
+	Clear() (int, error)
+	// DeadLetters returns the jobs that failed permanently.
+	DeadLetters() []jobqueue.DeadLetter
+	// Redrive puts the jobs that failed permanently back into the jobqueue,
+	// and returns how many there were.
+	Redrive() (int, error)
+}
+
+type policyEditor interface {
+	Policy() policy.Policy
+	SetPolicy(p policy.Policy)
+}
+
+// Admin configures the admin API, which lets the host control the party. It has
+// its own Token, separate from the sparty token and guest tokens, so handing
+// out either does not give away control. Endpoints for nil fields are not
+// served.
+type Admin struct {
+	Token    string
+	Worker   worker
+	Jobqueue adminJobqueue
+	Policy   policyEditor
+}
+
+// maxPolicySize caps the size of a policy sent to PUT /admin/policy.
+const maxPolicySize = 1 << 20
+
+// adminGuest is the identity of callers authenticating with the admin token.
+var adminGuest = guest.Guest{Name: "admin", Host: true}
+
+// WithAdmin serves the admin API under /admin/, and a page using it on /admin.
+// It is not served if a.Token is empty.
+func WithAdmin(a Admin) Option {
+	return func(h *handler) {
+		if a.Token != "" {
+			h.admin = &a
+		}
+	}
+}
+
+// adminRoutes registers the admin endpoints on mux.
+func (h *handler) adminRoutes(mux *http.ServeMux) {
+	for path := range adminAssets {
+		mux.HandleFunc(path, h.method(http.MethodGet, h.adminPage))
+	}
+	if h.admin.Worker != nil {
+		mux.HandleFunc("/admin/worker", h.method(http.MethodGet, h.adminAuth(h.log(h.workerStatus))))
+		mux.HandleFunc("/admin/worker/pause", h.method(http.MethodPost, h.adminAuth(h.log(h.pauseWorker))))
+		mux.HandleFunc("/admin/worker/resume", h.method(http.MethodPost, h.adminAuth(h.log(h.resumeWorker))))
+	}
+	if h.admin.Jobqueue != nil {
+		mux.HandleFunc("/admin/jobs/clear", h.method(http.MethodPost, h.adminAuth(h.log(h.clearJobs))))
+		mux.HandleFunc("/admin/jobs/failed", h.method(http.MethodGet, h.adminAuth(h.log(h.failedJobs))))
+		mux.HandleFunc("/admin/jobs/redrive", h.method(http.MethodPost, h.adminAuth(h.log(h.redriveJobs))))
+	}
+	if h.guests != nil {
+		mux.HandleFunc("/admin/guests", h.adminAuth(h.log(h.guestsHandler)))
+	}
+	if h.admin.Policy != nil {
+		mux.HandleFunc("/admin/policy", h.adminAuth(h.log(h.policyHandler)))
+	}
+}
+
+// adminAuth only lets callers with the admin token through.
+func (h *handler) adminAuth(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		const prefix = "Token "
+		t := r.Header.Get("Authorization")
+		if !strings.HasPrefix(t, prefix) ||
+			subtle.ConstantTimeCompare([]byte(strings.TrimPrefix(t, prefix)), []byte(h.admin.Token)) != 1 {
+			h.infoLog.Printf("Failed admin auth attempt from %q @ %q", r.UserAgent(), r.Header.Get("X-Forwarded-For"))
+			http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+			return
+		}
+		next(w, r.WithContext(guest.NewContext(r.Context(), adminGuest)))
+	}
+}
+
+func (h *handler) writeWorkerStatus(w http.ResponseWriter) {
+	h.writeJSON(w, http.StatusOK, struct {
+		Paused  bool `json:"paused"`
+		Pending int  `json:"pending"`
+	}{h.admin.Worker.Paused(), h.admin.Worker.Len()})
+}
+
+// workerStatus responds with whether the worker is paused, and how many jobs
+// are waiting for it.
+func (h *handler) workerStatus(w http.ResponseWriter, r *http.Request) {
+	h.writeWorkerStatus(w)
+}
+
+func (h *handler) pauseWorker(w http.ResponseWriter, r *http.Request) {
+	h.admin.Worker.Pause()
+	h.infoLog.Print("Paused the worker")
+	h.writeWorkerStatus(w)
+}
+
+func (h *handler) resumeWorker(w http.ResponseWriter, r *http.Request) {
+	h.admin.Worker.Resume()
+	h.infoLog.Print("Resumed the worker")
+	h.writeWorkerStatus(w)
+}
+
+// clearJobs drops the jobs waiting in the jobqueue.
+func (h *handler) clearJobs(w http.ResponseWriter, r *http.Request) {
+	n, err := h.admin.Jobqueue.Clear()
+	if err != nil {
+		h.errLog.Printf("%T: Clear: %s", h.admin.Jobqueue, err)
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+	h.infoLog.Printf("Cleared %d jobs", n)
+	h.writeJSON(w, http.StatusOK, struct {
+		Cleared int `json:"cleared"`
+	}{n})
+}
+
+// failedJobs responds with the jobs that failed permanently, most recent first.
+func (h *handler) failedJobs(w http.ResponseWriter, r *http.Request) {
+	dead := h.admin.Jobqueue.DeadLetters()
+	jobs := make([]jobqueue.DeadLetter, 0, len(dead))
+	for i := len(dead) - 1; i >= 0; i-- {
+		jobs = append(jobs, dead[i])
+	}
+	h.writeJSON(w, http.StatusOK, struct {
+		Jobs []jobqueue.DeadLetter `json:"jobs"`
+	}{jobs})
+}
+
+// redriveJobs puts the jobs that failed permanently back into the jobqueue, to
+// give them another chance, e.g. once Spotify is back up.
+func (h *handler) redriveJobs(w http.ResponseWriter, r *http.Request) {
+	n, err := h.admin.Jobqueue.Redrive()
+	if err != nil {
+		h.errLog.Printf("%T: Redrive: %s (after %d jobs)", h.admin.Jobqueue, err, n)
+		h.putError(w, err)
+		return
+	}
+	h.infoLog.Printf("Redrove %d jobs", n)
+	h.writeJSON(w, http.StatusOK, struct {
+		Redriven int `json:"redriven"`
+	}{n})
+}
+
+// policyHandler responds with the content policy in effect on GET, and replaces
+// it by the one in the request body on PUT.
+func (h *handler) policyHandler(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPut:
+		var p policy.Policy
+		d := json.NewDecoder(io.LimitReader(r.Body, maxPolicySize))
+		// Catch typos in rule names, rather than silently ignoring them.
+		d.DisallowUnknownFields()
+		if err := d.Decode(&p); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			_, _ = fmt.Fprintf(w, "Invalid policy: %s\n", err)
+			return
+		}
+		h.admin.Policy.SetPolicy(p)
+		h.infoLog.Print("Changed the content policy")
+	default:
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+	h.writeJSON(w, http.StatusOK, h.admin.Policy.Policy())
+}
+
+// adminAssets are the assets of the admin page, by path. It shares its look
+// with the guest web app.
+var adminAssets = map[string]asset{
+	"/admin":           {"text/html; charset=utf-8", adminHTML},
+	"/admin/admin.css": {"text/css; charset=utf-8", uiCSS + adminCSS},
+	"/admin/admin.js":  {"application/javascript; charset=utf-8", adminJS},
+}
+
+// adminPage serves the assets of the admin page. The page itself is public: it
+// asks for the admin token, and only uses it to call the admin API.
+func (h *handler) adminPage(w http.ResponseWriter, r *http.Request) {
+	serveAsset(w, r, adminAssets)
+}
+
+const adminHTML = `<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<meta name="robots" content="noindex">
+<title>sparty admin</title>
+<link rel="stylesheet" href="/admin/admin.css">
+</head>
+<body>
+<header><h1>sparty admin</h1></header>
+
+<section id="login" hidden>
+<h2>Log in</h2>
+<p>Enter the admin token.</p>
+<form id="login-form">
+<input id="token" type="password" autocomplete="off" placeholder="Admin token" required>
+<button type="submit">Log in</button>
+</form>
+</section>
+
+<main id="app" hidden>
+<p id="feedback" role="status"></p>
+
+<section id="worker" hidden>
+<h2>Worker</h2>
+<p>The worker is <strong id="worker-state">…</strong>, with <strong id="worker-pending">…</strong> songs waiting. While paused, requests are still accepted, but not sent to Spotify.</p>
+<button id="pause" type="button">Pause</button>
+<button id="resume" type="button">Resume</button>
+</section>
+
+<section id="jobs" hidden>
+<h2>Jobs</h2>
+<p><button id="clear" type="button" class="danger">Clear pending jobs</button></p>
+<h3>Failed</h3>
+<ul id="failed" class="rows"></ul>
+<p><button id="redrive" type="button">Retry failed jobs</button></p>
+</section>
+
+<section id="guests" hidden>
+<h2>Guests</h2>
+<form id="guest-form">
+<input id="guest-name" type="text" autocomplete="off" placeholder="Name" required>
+<input id="guest-ttl" type="text" autocomplete="off" placeholder="Expires after, e.g. 4h">
+<label><input id="guest-trusted" type="checkbox"> Trusted</label>
+<button type="submit">Invite</button>
+</form>
+<p id="guest-link" class="ok"></p>
+<ul id="guest-list" class="rows"></ul>
+</section>
+
+<section id="policy" hidden>
+<h2>Policy</h2>
+<form id="policy-form" class="column">
+<textarea id="policy-json" rows="12" spellcheck="false"></textarea>
+<button type="submit">Save</button>
+</form>
+</section>
+
+<footer><button id="logout" type="button" class="link">Log out</button></footer>
+</main>
+
+<script src="/admin/admin.js"></script>
+</body>
+</html>
+`
+
+const adminCSS = `h3 { font-size: 1em; color: #aaa; }
+form { flex-wrap: wrap; align-items: center; }
+form.column { flex-direction: column; align-items: stretch; }
+label { color: #aaa; }
+label input { flex: none; }
+textarea { width: 100%; padding: .6em; border: 0; border-radius: .3em; font-family: monospace; font-size: .9em; }
+button.danger { background: #c0392b; }
+.rows { list-style: none; padding: 0; }
+.rows li { display: flex; align-items: center; gap: .75em; padding: .4em 0; border-bottom: 1px solid #282828; }
+.rows .track { word-break: break-all; }
+`
+
+const adminJS = `(function () {
+  "use strict";
+
+  var token = "";
+  var pollTimer = null;
+
+  function $(id) { return document.getElementById(id); }
+
+  function el(tag, className, text) {
+    var e = document.createElement(tag);
+    if (className) { e.className = className; }
+    if (text !== undefined) { e.textContent = text; }
+    return e;
+  }
+
+  function api(method, path, body) {
+    return fetch(path, {
+      method: method,
+      headers: { "Authorization": "Token " + token },
+      body: body
+    }).then(function (res) {
+      if (res.status === 401) {
+        logout("The admin token is not valid.");
+        throw new Error("unauthorized");
+      }
+      return res;
+    });
+  }
+
+  function feedback(msg, className) {
+    var f = $("feedback");
+    f.textContent = msg;
+    f.className = className || "";
+  }
+
+  function failed(what) {
+    return function (err) {
+      if (err && err.message === "unauthorized") { return; }
+      feedback(what + " failed. Please try again.", "error");
+    };
+  }
+
+  // load fetches path and renders its JSON body, or hides section if the
+  // server does not serve it.
+  function load(section, path, render) {
+    return api("GET", path).then(function (res) {
+      if (res.status === 404) {
+        $(section).hidden = true;
+        return;
+      }
+      if (res.status !== 200) { throw new Error(res.statusText); }
+      $(section).hidden = false;
+      return res.json().then(render);
+    });
+  }
+
+  function expect(status, what) {
+    return function (res) {
+      if (res.status === status) { return res; }
+      return res.text().then(function (msg) {
+        throw new Error(what + " failed: " + (msg.trim() || res.statusText));
+      });
+    };
+  }
+
+  function report(err) {
+    if (err && err.message === "unauthorized") { return; }
+    feedback(err.message, "error");
+  }
+
+  // Worker.
+
+  function renderWorker(body) {
+    $("worker-state").textContent = body.paused ? "paused" : "running";
+    $("worker-pending").textContent = body.pending;
+    $("pause").disabled = body.paused;
+    $("resume").disabled = !body.paused;
+  }
+
+  function setWorker(action) {
+    api("POST", "/admin/worker/" + action).then(expect(200, "Changing the worker")).then(function (res) {
+      return res.json().then(renderWorker);
+    }).catch(report);
+  }
+
+  // Jobs.
+
+  function renderFailed(body) {
+    var ul = $("failed");
+    ul.textContent = "";
+    var jobs = body.jobs || [];
+    if (jobs.length === 0) {
+      ul.appendChild(el("li", "muted", "No jobs failed."));
+      return;
+    }
+    jobs.forEach(function (j) {
+      var li = el("li");
+      var info = el("div", "track");
+      info.appendChild(el("div", "name", j.uri));
+      var meta = j.err + " (" + j.attempts + " attempts, " + new Date(j.failed_at).toLocaleString() + ")";
+      if (j.requester) { meta = "requested by " + j.requester + " · " + meta; }
+      info.appendChild(el("div", "meta", meta));
+      li.appendChild(info);
+      ul.appendChild(li);
+    });
+  }
+
+  function clearJobs() {
+    if (!confirm("Drop all jobs that were not sent to Spotify yet?")) { return; }
+    api("POST", "/admin/jobs/clear").then(expect(200, "Clearing the jobs")).then(function (res) {
+      return res.json().then(function (body) {
+        feedback("Cleared " + body.cleared + " jobs.", "ok");
+      });
+    }).catch(report);
+  }
+
+  function redriveJobs() {
+    api("POST", "/admin/jobs/redrive").then(expect(200, "Retrying the failed jobs")).then(function (res) {
+      return res.json().then(function (body) {
+        feedback("Retrying " + body.redriven + " jobs.", "ok");
+        load("jobs", "/admin/jobs/failed", renderFailed).catch(failed("Loading the failed jobs"));
+      });
+    }).catch(report);
+  }
+
+  // Guests.
+
+  function renderGuests(body) {
+    var ul = $("guest-list");
+    ul.textContent = "";
+    var guests = body.guests || [];
+    if (guests.length === 0) {
+      ul.appendChild(el("li", "muted", "No guests yet."));
+      return;
+    }
+    guests.forEach(function (g) {
+      var li = el("li");
+      var info = el("div", "track");
+      info.appendChild(el("div", "name", g.name));
+      var meta = g.trusted ? "trusted" : "";
+      if (g.expires_at) {
+        meta += (meta ? " · " : "") + "expires " + new Date(g.expires_at).toLocaleString();
+      }
+      info.appendChild(el("div", "meta", meta));
+      li.appendChild(info);
+      var b = el("button", "danger", "Revoke");
+      b.type = "button";
+      b.addEventListener("click", function () { revokeGuest(g.name); });
+      li.appendChild(b);
+      ul.appendChild(li);
+    });
+  }
+
+  function inviteGuest() {
+    var q = "name=" + encodeURIComponent($("guest-name").value.trim());
+    var ttl = $("guest-ttl").value.trim();
+    if (ttl) { q += "&ttl=" + encodeURIComponent(ttl); }
+    if ($("guest-trusted").checked) { q += "&trusted=true"; }
+    api("POST", "/admin/guests?" + q).then(expect(201, "Inviting the guest")).then(function (res) {
+      return res.json().then(function (body) {
+        $("guest-form").reset();
+        $("guest-link").textContent = "Send " + body.guest.name + " this link: " +
+          location.origin + "/#token=" + encodeURIComponent(body.token);
+        refresh();
+      });
+    }).catch(report);
+  }
+
+  function revokeGuest(name) {
+    if (!confirm("Revoke the token of " + name + "?")) { return; }
+    api("DELETE", "/admin/guests?name=" + encodeURIComponent(name)).then(expect(204, "Revoking the guest")).then(function () {
+      feedback("Revoked the token of " + name + ".", "ok");
+      refresh();
+    }).catch(report);
+  }
+
+  // Policy.
+
+  function renderPolicy(body) {
+    // Don't overwrite changes that are being made.
+    if (document.activeElement === $("policy-json")) { return; }
+    $("policy-json").value = JSON.stringify(body, null, 2);
+  }
+
+  function savePolicy() {
+    api("PUT", "/admin/policy", $("policy-json").value).then(expect(200, "Saving the policy")).then(function (res) {
+      return res.json().then(function (body) {
+        $("policy-json").blur();
+        renderPolicy(body);
+        feedback("Saved the policy.", "ok");
+      });
+    }).catch(report);
+  }
+
+  function refresh() {
+    load("worker", "/admin/worker", renderWorker).catch(failed("Loading the worker"));
+    load("jobs", "/admin/jobs/failed", renderFailed).catch(failed("Loading the failed jobs"));
+    load("guests", "/admin/guests", renderGuests).catch(failed("Loading the guests"));
+    load("policy", "/admin/policy", renderPolicy).catch(failed("Loading the policy"));
+  }
+
+  // Logging in and out. The token is only kept for as long as the tab is open.
+
+  function start() {
+    $("login").hidden = true;
+    $("app").hidden = false;
+    refresh();
+    // Keep the number of songs waiting up to date.
+    pollTimer = setInterval(function () {
+      load("worker", "/admin/worker", renderWorker).catch(function () {});
+    }, 5000);
+  }
+
+  function logout(msg) {
+    token = "";
+    sessionStorage.removeItem("sparty-admin-token");
+    clearInterval(pollTimer);
+    $("app").hidden = true;
+    $("login").hidden = false;
+    if (msg) { alert(msg); }
+  }
+
+  $("login-form").addEventListener("submit", function (e) {
+    e.preventDefault();
+    token = $("token").value.trim();
+    sessionStorage.setItem("sparty-admin-token", token);
+    start();
+  });
+
+  $("pause").addEventListener("click", function () { setWorker("pause"); });
+  $("resume").addEventListener("click", function () { setWorker("resume"); });
+  $("clear").addEventListener("click", clearJobs);
+  $("redrive").addEventListener("click", redriveJobs);
+  $("guest-form").addEventListener("submit", function (e) {
+    e.preventDefault();
+    inviteGuest();
+  });
+  $("policy-form").addEventListener("submit", function (e) {
+    e.preventDefault();
+    savePolicy();
+  });
+  $("logout").addEventListener("click", function () { logout(); });
+
+  token = sessionStorage.getItem("sparty-admin-token") || "";
+  if (token) { start(); } else { $("login").hidden = false; }
+})();
+`
@@ -0,0 +1,228 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/epels/sparty/guest"
+	"github.com/epels/sparty/internal/mock"
+	"github.com/epels/sparty/jobqueue"
+	"github.com/epels/sparty/policy"
+)
+
+const adminToken = "admin-token"
+
+type fakeWorker struct {
+	paused bool
+}
+
+func (w *fakeWorker) Pause()       { w.paused = true }
+func (w *fakeWorker) Resume()      { w.paused = false }
+func (w *fakeWorker) Paused() bool { return w.paused }
+func (w *fakeWorker) Len() int     { return 2 }
+
+type fakeAdminJobqueue struct {
+	pending int
+	dead    []jobqueue.DeadLetter
+}
+
+func (jq *fakeAdminJobqueue) Clear() (int, error) {
+	n := jq.pending
+	jq.pending = 0
+	return n, nil
+}
+
+func (jq *fakeAdminJobqueue) DeadLetters() []jobqueue.DeadLetter {
+	return jq.dead
+}
+
+func (jq *fakeAdminJobqueue) Redrive() (int, error) {
+	n := len(jq.dead)
+	jq.pending += n
+	jq.dead = nil
+	return n, nil
+}
+
+func TestAdmin(t *testing.T) {
+	noopLogger := log.New(ioutil.Discard, "", 0)
+	noopJobqueue := mock.Jobqueue{
+		PutFunc: func(ctx context.Context, j jobqueue.Job) (string, error) {
+			return "", nil
+		},
+	}
+	w := &fakeWorker{}
+	jq := &fakeAdminJobqueue{
+		pending: 3,
+		dead: []jobqueue.DeadLetter{
+			{Job: jobqueue.Job{URI: "spotify:track:foo"}, Err: "foo", Attempts: 3},
+			{Job: jobqueue.Job{URI: "spotify:track:bar"}, Err: "bar", Attempts: 3},
+		},
+	}
+	pe := policy.NewEngine(nil, policy.Policy{NoExplicit: true})
+	h := New(noopLogger, noopLogger, noopJobqueue, authToken,
+		WithGuests(guest.NewRegistry()),
+		WithAdmin(Admin{Token: adminToken, Worker: w, Jobqueue: jq, Policy: pe}))
+
+	do := func(method, target, token, body string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		req := httptest.NewRequest(method, target, strings.NewReader(body))
+		if token != "" {
+			req.Header.Set("Authorization", "Token "+token)
+		}
+		h.ServeHTTP(rec, req)
+		return rec
+	}
+
+	t.Run("Unauthorized", func(t *testing.T) {
+		for _, token := range []string{"", "foo", authToken} {
+			if rec := do(http.MethodGet, "/admin/worker", token, ""); rec.Code != http.StatusUnauthorized {
+				t.Errorf("Got %d for token %q, expected 401", rec.Code, token)
+			}
+		}
+		// Nor does the admin token authenticate with the guest API.
+		if rec := do(http.MethodGet, "/guests", adminToken, ""); rec.Code != http.StatusUnauthorized {
+			t.Errorf("Got %d, expected 401", rec.Code)
+		}
+	})
+
+	t.Run("Page", func(t *testing.T) {
+		for _, path := range []string{"/admin", "/admin/admin.css", "/admin/admin.js"} {
+			rec := do(http.MethodGet, path, "", "")
+			if rec.Code != http.StatusOK {
+				t.Errorf("Got %d for %s, expected 200", rec.Code, path)
+			}
+			if csp := rec.Header().Get("Content-Security-Policy"); csp == "" {
+				t.Error("Got empty Content-Security-Policy, expected one")
+			}
+		}
+	})
+
+	t.Run("Worker", func(t *testing.T) {
+		for _, tc := range []struct {
+			method, path string
+			exp          string
+		}{
+			{http.MethodGet, "/admin/worker", `{"paused":false,"pending":2}`},
+			{http.MethodPost, "/admin/worker/pause", `{"paused":true,"pending":2}`},
+			{http.MethodGet, "/admin/worker", `{"paused":true,"pending":2}`},
+			{http.MethodPost, "/admin/worker/resume", `{"paused":false,"pending":2}`},
+		} {
+			rec := do(tc.method, tc.path, adminToken, "")
+			if rec.Code != http.StatusOK {
+				t.Errorf("Got %d for %s %s, expected 200", rec.Code, tc.method, tc.path)
+			}
+			if s := strings.TrimSpace(rec.Body.String()); s != tc.exp {
+				t.Errorf("Got %q for %s %s, expected %q", s, tc.method, tc.path, tc.exp)
+			}
+		}
+		if rec := do(http.MethodGet, "/admin/worker/pause", adminToken, ""); rec.Code != http.StatusMethodNotAllowed {
+			t.Errorf("Got %d, expected 405", rec.Code)
+		}
+	})
+
+	t.Run("Clear", func(t *testing.T) {
+		rec := do(http.MethodPost, "/admin/jobs/clear", adminToken, "")
+		if rec.Code != http.StatusOK {
+			t.Errorf("Got %d, expected 200", rec.Code)
+		}
+		if s := strings.TrimSpace(rec.Body.String()); s != `{"cleared":3}` {
+			t.Errorf("Got %q, expected %q", s, `{"cleared":3}`)
+		}
+		if jq.pending != 0 {
+			t.Errorf("Got %d, expected 0", jq.pending)
+		}
+	})
+
+	t.Run("Failed jobs", func(t *testing.T) {
+		rec := do(http.MethodGet, "/admin/jobs/failed", adminToken, "")
+		if rec.Code != http.StatusOK {
+			t.Errorf("Got %d, expected 200", rec.Code)
+		}
+		var res struct {
+			Jobs []jobqueue.DeadLetter `json:"jobs"`
+		}
+		if err := json.NewDecoder(rec.Body).Decode(&res); err != nil {
+			t.Fatalf("Got %T (%s), expected nil", err, err)
+		}
+		// Most recent first.
+		if len(res.Jobs) != 2 || res.Jobs[0].Err != "bar" || res.Jobs[1].Err != "foo" {
+			t.Errorf("Got %+v, expected bar, then foo", res.Jobs)
+		}
+	})
+
+	t.Run("Redrive", func(t *testing.T) {
+		rec := do(http.MethodPost, "/admin/jobs/redrive", adminToken, "")
+		if rec.Code != http.StatusOK {
+			t.Errorf("Got %d, expected 200", rec.Code)
+		}
+		if s := strings.TrimSpace(rec.Body.String()); s != `{"redriven":2}` {
+			t.Errorf("Got %q, expected %q", s, `{"redriven":2}`)
+		}
+		if len(jq.dead) != 0 || jq.pending != 2 {
+			t.Errorf("Got %d dead and %d pending, expected 0 and 2", len(jq.dead), jq.pending)
+		}
+		if rec := do(http.MethodGet, "/admin/jobs/redrive", adminToken, ""); rec.Code != http.StatusMethodNotAllowed {
+			t.Errorf("Got %d, expected 405", rec.Code)
+		}
+	})
+
+	t.Run("Guests", func(t *testing.T) {
+		rec := do(http.MethodPost, "/admin/guests?name=alice", adminToken, "")
+		if rec.Code != http.StatusCreated {
+			t.Errorf("Got %d, expected 201", rec.Code)
+		}
+		rec = do(http.MethodDelete, "/admin/guests?name=alice", adminToken, "")
+		if rec.Code != http.StatusNoContent {
+			t.Errorf("Got %d, expected 204", rec.Code)
+		}
+	})
+
+	t.Run("Policy", func(t *testing.T) {
+		rec := do(http.MethodGet, "/admin/policy", adminToken, "")
+		if s := strings.TrimSpace(rec.Body.String()); s != `{"no_explicit":true}` {
+			t.Errorf("Got %q, expected %q", s, `{"no_explicit":true}`)
+		}
+
+		rec = do(http.MethodPut, "/admin/policy", adminToken, `{"max_duration":"8m"}`)
+		if rec.Code != http.StatusOK {
+			t.Errorf("Got %d, expected 200", rec.Code)
+		}
+		if s := strings.TrimSpace(rec.Body.String()); s != `{"max_duration":"8m0s"}` {
+			t.Errorf("Got %q, expected %q", s, `{"max_duration":"8m0s"}`)
+		}
+		if p := pe.Policy(); p.NoExplicit || p.MaxDuration != policy.Duration(8*time.Minute) {
+			t.Errorf("Got %+v, expected only max_duration 8m", p)
+		}
+
+		for _, body := range []string{`{`, `{"max_duration":"foo"}`, `{"no_explicits":true}`} {
+			rec := do(http.MethodPut, "/admin/policy", adminToken, body)
+			if rec.Code != http.StatusBadRequest {
+				t.Errorf("Got %d for %s, expected 400", rec.Code, body)
+			}
+		}
+		if p := pe.Policy(); p.MaxDuration != policy.Duration(8*time.Minute) {
+			t.Errorf("Got %+v, expected it unchanged", p)
+		}
+	})
+
+	t.Run("Disabled", func(t *testing.T) {
+		h := New(noopLogger, noopLogger, noopJobqueue, authToken, WithAdmin(Admin{Worker: w}))
+
+		for _, path := range []string{"/admin", "/admin/worker"} {
+			rec := httptest.NewRecorder()
+			req := httptest.NewRequest(http.MethodGet, path, nil)
+			req.Header.Set("Authorization", "Token "+authToken)
+			h.ServeHTTP(rec, req)
+			if rec.Code != http.StatusNotFound {
+				t.Errorf("Got %d for %s, expected 404", rec.Code, path)
+			}
+		}
+	})
+}
@@ -0,0 +1,162 @@
+package handler
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"fmt"
+	"html/template"
+	"net/http"
+	"time"
+)
+
+type authenticator interface {
+	// AuthCodeURL returns the URL to send the host to for connecting their
+	// Spotify account, which redirects back to redirectURI.
+	AuthCodeURL(redirectURI, state, challenge string) string
+	// Exchange exchanges the authorization code Spotify redirected back with
+	// for a refresh token, and starts using it.
+	Exchange(ctx context.Context, code, redirectURI, verifier string) error
+}
+
+// pendingLogin is a login that was started, but for which Spotify did not
+// redirect back yet.
+type pendingLogin struct {
+	verifier  string
+	expiresAt time.Time
+}
+
+// loginTTL is how long the host has to complete a login.
+const loginTTL = 10 * time.Minute
+
+var loginTmpl = template.Must(template.New("login").Parse(`<!DOCTYPE html>
+<html>
+<head><meta charset="utf-8"><meta name="viewport" content="width=device-width"><title>sparty: connect Spotify</title></head>
+<body>
+<h1>Connect your Spotify account</h1>
+{{if .}}<p>{{.}}</p>{{end}}
+<form method="post" action="/auth/login">
+<label>Token <input type="password" name="token" required></label>
+<button type="submit">Connect</button>
+</form>
+</body>
+</html>
+`))
+
+// WithAuthenticator enables connecting the host's Spotify account from a
+// browser: GET /auth/login asks for the sparty token, and then sends the host
+// to Spotify, which redirects back to /auth/callback. RedirectURI must be the
+// absolute URL of the latter, as registered with Spotify.
+func WithAuthenticator(a authenticator, redirectURI string) Option {
+	return func(h *handler) {
+		h.authn = a
+		h.redirectURI = redirectURI
+		h.logins = make(map[string]pendingLogin)
+	}
+}
+
+// login shows a form asking for the sparty token on GET. On POST, it checks
+// the token and then redirects to Spotify to connect an account.
+func (h *handler) login(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		h.renderLogin(w, http.StatusOK, "")
+		return
+	case http.MethodPost:
+	default:
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+
+	if subtle.ConstantTimeCompare([]byte(r.PostFormValue("token")), []byte(h.token)) != 1 {
+		h.infoLog.Printf("Failed login attempt from %q @ %q", r.UserAgent(), r.Header.Get("X-Forwarded-For"))
+		h.renderLogin(w, http.StatusUnauthorized, "Incorrect token.")
+		return
+	}
+
+	state, err := randomString(16)
+	if err != nil {
+		h.errLog.Printf("randomString: %s", err)
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+	verifier, err := randomString(64)
+	if err != nil {
+		h.errLog.Printf("randomString: %s", err)
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+	sum := sha256.Sum256([]byte(verifier))
+	challenge := base64.RawURLEncoding.EncodeToString(sum[:])
+
+	now := h.nowFunc()
+	h.loginsMu.Lock()
+	for s, pl := range h.logins {
+		if now.After(pl.expiresAt) {
+			delete(h.logins, s)
+		}
+	}
+	h.logins[state] = pendingLogin{
+		verifier:  verifier,
+		expiresAt: now.Add(loginTTL),
+	}
+	h.loginsMu.Unlock()
+
+	http.Redirect(w, r, h.authn.AuthCodeURL(h.redirectURI, state, challenge), http.StatusFound)
+}
+
+func (h *handler) renderLogin(w http.ResponseWriter, status int, msg string) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(status)
+	if err := loginTmpl.Execute(w, msg); err != nil {
+		h.errLog.Printf("html/template: Template.Execute: %s", err)
+	}
+}
+
+// callback completes a login once Spotify redirects back to it.
+func (h *handler) callback(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	state := q.Get("state")
+
+	h.loginsMu.Lock()
+	pl, ok := h.logins[state]
+	delete(h.logins, state)
+	h.loginsMu.Unlock()
+	if !ok || h.nowFunc().After(pl.expiresAt) {
+		w.WriteHeader(http.StatusBadRequest)
+		_, _ = fmt.Fprintln(w, "Unknown or expired login: please start over.")
+		return
+	}
+
+	if e := q.Get("error"); e != "" {
+		w.WriteHeader(http.StatusBadRequest)
+		_, _ = fmt.Fprintf(w, "Spotify did not connect your account (%s).\n", e)
+		return
+	}
+	code := q.Get("code")
+	if code == "" {
+		w.WriteHeader(http.StatusBadRequest)
+		_, _ = fmt.Fprintln(w, "Missing required parameter: code")
+		return
+	}
+
+	if err := h.authn.Exchange(r.Context(), code, h.redirectURI, pl.verifier); err != nil {
+		h.errLog.Printf("%T: Exchange: %s", h.authn, err)
+		http.Error(w, http.StatusText(http.StatusBadGateway), http.StatusBadGateway)
+		return
+	}
+
+	h.infoLog.Print("Connected Spotify account")
+	_, _ = fmt.Fprintln(w, "Your Spotify account is connected: you can close this window.")
+}
+
+// randomString returns a URL safe string encoding n random bytes.
+func randomString(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("crypto/rand: Read: %w", err)
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
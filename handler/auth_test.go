@@ -0,0 +1,193 @@
+package handler
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/epels/sparty/internal/mock"
+)
+
+const redirectURI = "http://localhost:8080/auth/callback"
+
+func TestLogin(t *testing.T) {
+	noopLogger := log.New(ioutil.Discard, "", 0)
+	noopJobqueue := mock.Jobqueue{}
+
+	t.Run("Form", func(t *testing.T) {
+		rec := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodGet, "/auth/login", nil)
+
+		New(noopLogger, noopLogger, noopJobqueue, authToken, WithAuthenticator(mock.Authenticator{}, redirectURI)).ServeHTTP(rec, req)
+
+		if rec.Code != http.StatusOK {
+			t.Errorf("Got %d, expected 200", rec.Code)
+		}
+		if s := rec.Body.String(); !strings.Contains(s, `<form method="post" action="/auth/login">`) {
+			t.Errorf("Got %q, expected to contain form", s)
+		}
+	})
+
+	t.Run("Incorrect token", func(t *testing.T) {
+		rec := httptest.NewRecorder()
+		req := loginRequest("bad")
+
+		New(noopLogger, noopLogger, noopJobqueue, authToken, WithAuthenticator(mock.Authenticator{}, redirectURI)).ServeHTTP(rec, req)
+
+		if rec.Code != http.StatusUnauthorized {
+			t.Errorf("Got %d, expected 401", rec.Code)
+		}
+	})
+
+	t.Run("OK", func(t *testing.T) {
+		var state, verifier string
+		a := mock.Authenticator{
+			AuthCodeURLFunc: func(ru, s, challenge string) string {
+				if ru != redirectURI {
+					t.Errorf("Got %q, expected %q", ru, redirectURI)
+				}
+				if challenge == "" {
+					t.Error("Got empty challenge")
+				}
+				state = s
+				return "https://accounts.example.com/authorize?challenge=" + challenge
+			},
+			ExchangeFunc: func(ctx context.Context, code, ru, v string) error {
+				if code != "foo" {
+					t.Errorf("Got %q, expected foo", code)
+				}
+				if ru != redirectURI {
+					t.Errorf("Got %q, expected %q", ru, redirectURI)
+				}
+				verifier = v
+				return nil
+			},
+		}
+		h := New(noopLogger, noopLogger, noopJobqueue, authToken, WithAuthenticator(a, redirectURI))
+
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, loginRequest(authToken))
+		if rec.Code != http.StatusFound {
+			t.Fatalf("Got %d, expected 302", rec.Code)
+		}
+		loc, err := url.Parse(rec.Header().Get("Location"))
+		if err != nil {
+			t.Fatalf("Got %T (%s), expected nil", err, err)
+		}
+		challenge := loc.Query().Get("challenge")
+
+		rec = httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodGet, "/auth/callback?code=foo&state="+url.QueryEscape(state), nil)
+		h.ServeHTTP(rec, req)
+		if rec.Code != http.StatusOK {
+			t.Errorf("Got %d, expected 200", rec.Code)
+		}
+
+		// The verifier passed to Exchange must match the challenge.
+		sum := sha256.Sum256([]byte(verifier))
+		if exp := base64.RawURLEncoding.EncodeToString(sum[:]); challenge != exp {
+			t.Errorf("Got %q, expected %q", challenge, exp)
+		}
+
+		// A state can only be used once.
+		rec = httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		if rec.Code != http.StatusBadRequest {
+			t.Errorf("Got %d, expected 400", rec.Code)
+		}
+	})
+}
+
+func TestCallback(t *testing.T) {
+	noopLogger := log.New(ioutil.Discard, "", 0)
+	noopJobqueue := mock.Jobqueue{}
+
+	// startLogin starts a login, and returns the handler along with the state
+	// of that login.
+	startLogin := func(t *testing.T, a mock.Authenticator) (*handler, string) {
+		t.Helper()
+
+		var state string
+		a.AuthCodeURLFunc = func(redirectURI, s, challenge string) string {
+			state = s
+			return "https://accounts.example.com/authorize"
+		}
+		h := New(noopLogger, noopLogger, noopJobqueue, authToken, WithAuthenticator(a, redirectURI))
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, loginRequest(authToken))
+		if rec.Code != http.StatusFound {
+			t.Fatalf("Got %d, expected 302", rec.Code)
+		}
+		return h, state
+	}
+
+	t.Run("Unknown state", func(t *testing.T) {
+		h, _ := startLogin(t, mock.Authenticator{})
+
+		rec := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodGet, "/auth/callback?code=foo&state=bar", nil)
+		h.ServeHTTP(rec, req)
+
+		if rec.Code != http.StatusBadRequest {
+			t.Errorf("Got %d, expected 400", rec.Code)
+		}
+	})
+
+	t.Run("Expired state", func(t *testing.T) {
+		h, state := startLogin(t, mock.Authenticator{})
+		h.nowFunc = func() time.Time { return time.Now().Add(loginTTL + time.Second) }
+
+		rec := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodGet, "/auth/callback?code=foo&state="+url.QueryEscape(state), nil)
+		h.ServeHTTP(rec, req)
+
+		if rec.Code != http.StatusBadRequest {
+			t.Errorf("Got %d, expected 400", rec.Code)
+		}
+	})
+
+	t.Run("Access denied", func(t *testing.T) {
+		h, state := startLogin(t, mock.Authenticator{})
+
+		rec := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodGet, "/auth/callback?error=access_denied&state="+url.QueryEscape(state), nil)
+		h.ServeHTTP(rec, req)
+
+		if rec.Code != http.StatusBadRequest {
+			t.Errorf("Got %d, expected 400", rec.Code)
+		}
+	})
+
+	t.Run("Exchange failure", func(t *testing.T) {
+		h, state := startLogin(t, mock.Authenticator{
+			ExchangeFunc: func(ctx context.Context, code, redirectURI, verifier string) error {
+				return errors.New("some error")
+			},
+		})
+
+		rec := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodGet, "/auth/callback?code=foo&state="+url.QueryEscape(state), nil)
+		h.ServeHTTP(rec, req)
+
+		if rec.Code != http.StatusBadGateway {
+			t.Errorf("Got %d, expected 502", rec.Code)
+		}
+	})
+}
+
+func loginRequest(token string) *http.Request {
+	vals := url.Values{}
+	vals.Set("token", token)
+	req := httptest.NewRequest(http.MethodPost, "/auth/login", strings.NewReader(vals.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	return req
+}
@@ -0,0 +1,123 @@
+package handler
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/epels/sparty/events"
+)
+
+type eventBus interface {
+	Publish(typ events.Type, data interface{})
+	// Subscribe subscribes to the events published from now on, and returns
+	// the ones after lastID that were missed.
+	Subscribe(lastID uint64) ([]events.Event, <-chan events.Event, func())
+}
+
+// keepAliveInterval is how often a comment is sent to idle event streams, so
+// proxies don't consider them dead.
+const keepAliveInterval = 15 * time.Second
+
+// WithEvents streams the events published to b to clients through GET
+// /events, and publishes the handler's own events to it: songs being requested
+// and votes to skip.
+func WithEvents(b eventBus) Option {
+	return func(h *handler) {
+		h.bus = b
+	}
+}
+
+func (h *handler) publish(typ events.Type, data interface{}) {
+	if h.bus != nil {
+		h.bus.Publish(typ, data)
+	}
+}
+
+// tokenQuery lets clients that can't set headers, like a browser's
+// EventSource, pass their token in the token query parameter instead. It is
+// removed from the URL, so it isn't logged.
+func tokenQuery(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		if t := q.Get("token"); t != "" && r.Header.Get("Authorization") == "" {
+			r = r.Clone(r.Context())
+			r.Header.Set("Authorization", "Token "+t)
+			q.Del("token")
+			r.URL.RawQuery = q.Encode()
+		}
+		next(w, r)
+	}
+}
+
+// eventsHandler streams events to the client as server-sent events. Clients
+// that reconnect with a Last-Event-ID header first get the events they missed.
+func (h *handler) eventsHandler(w http.ResponseWriter, r *http.Request) {
+	f, ok := w.(http.Flusher)
+	if !ok {
+		h.errLog.Printf("%T does not implement http.Flusher", w)
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+	var lastID uint64
+	if v := r.Header.Get("Last-Event-ID"); v != "" {
+		n, err := strconv.ParseUint(v, 10, 64)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			_, _ = fmt.Fprintf(w, "Invalid value for header: Last-Event-ID (%s)\n", v)
+			return
+		}
+		lastID = n
+	}
+
+	missed, ch, cancel := h.bus.Subscribe(lastID)
+	defer cancel()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	// Keep reverse proxies like nginx from buffering the stream.
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+	for _, e := range missed {
+		if err := h.writeEvent(w, e); err != nil {
+			return
+		}
+	}
+	f.Flush()
+
+	t := time.NewTicker(keepAliveInterval)
+	defer t.Stop()
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case e, ok := <-ch:
+			if !ok {
+				// The client fell behind: it reconnects and catches up
+				// using Last-Event-ID.
+				return
+			}
+			if err := h.writeEvent(w, e); err != nil {
+				return
+			}
+		case <-t.C:
+			if _, err := fmt.Fprint(w, ": keep-alive\n\n"); err != nil {
+				return
+			}
+		}
+		f.Flush()
+	}
+}
+
+func (h *handler) writeEvent(w http.ResponseWriter, e events.Event) error {
+	b, err := json.Marshal(e.Data)
+	if err != nil {
+		// Skip the event rather than breaking the stream.
+		h.errLog.Printf("encoding/json: Marshal: %s", err)
+		return nil
+	}
+	_, err = fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", e.ID, e.Type, b)
+	return err
+}
@@ -0,0 +1,142 @@
+package handler
+
+import (
+	"bufio"
+	"context"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/epels/sparty/events"
+	"github.com/epels/sparty/internal/mock"
+	"github.com/epels/sparty/jobqueue"
+)
+
+// readEvent reads the next event from an event stream, skipping comments.
+func readEvent(t *testing.T, r *bufio.Reader) string {
+	t.Helper()
+
+	var lines []string
+	for {
+		l, err := r.ReadString('\n')
+		if err != nil {
+			t.Fatalf("Got %T (%s), expected nil", err, err)
+		}
+		l = strings.TrimSuffix(l, "\n")
+		if l == "" {
+			if len(lines) > 0 {
+				return strings.Join(lines, "\n")
+			}
+			continue
+		}
+		if !strings.HasPrefix(l, ":") {
+			lines = append(lines, l)
+		}
+	}
+}
+
+func TestEvents(t *testing.T) {
+	noopLogger := log.New(ioutil.Discard, "", 0)
+	noopJobqueue := mock.Jobqueue{
+		PutFunc: func(ctx context.Context, j jobqueue.Job) (string, error) {
+			return "foo", nil
+		},
+	}
+	b := events.NewBus()
+	ts := httptest.NewServer(New(noopLogger, noopLogger, noopJobqueue, authToken, WithEvents(b)))
+	defer ts.Close()
+
+	subscribe := func(t *testing.T, lastID string) (*bufio.Reader, func()) {
+		t.Helper()
+
+		req, err := http.NewRequest(http.MethodGet, ts.URL+"/events?token="+authToken, nil)
+		if err != nil {
+			t.Fatalf("Got %T (%s), expected nil", err, err)
+		}
+		if lastID != "" {
+			req.Header.Set("Last-Event-ID", lastID)
+		}
+		res, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("Got %T (%s), expected nil", err, err)
+		}
+		if res.StatusCode != http.StatusOK {
+			t.Fatalf("Got %d, expected 200", res.StatusCode)
+		}
+		if ct := res.Header.Get("Content-Type"); ct != "text/event-stream" {
+			t.Errorf("Got %q, expected text/event-stream", ct)
+		}
+		return bufio.NewReader(res.Body), func() {
+			_ = res.Body.Close()
+		}
+	}
+	// The handler subscribes before it responds with the headers, so no
+	// events are missed from here on.
+	r, done := subscribe(t, "")
+	defer done()
+
+	req, err := http.NewRequest(http.MethodPost, ts.URL+"/enqueue?url=spotify:track:1301WleyT98MSxVHPZCA6M", nil)
+	if err != nil {
+		t.Fatalf("Got %T (%s), expected nil", err, err)
+	}
+	req.Header.Set("Authorization", "Token "+authToken)
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("Got %T (%s), expected nil", err, err)
+	}
+	_ = res.Body.Close()
+	b.Publish(events.JobSent, events.Song{URI: "spotify:track:1301WleyT98MSxVHPZCA6M"})
+
+	exp := `id: 1
+event: song_requested
+data: {"uri":"spotify:track:1301WleyT98MSxVHPZCA6M","requester":"host"}`
+	if e := readEvent(t, r); e != exp {
+		t.Errorf("Got %q, expected %q", e, exp)
+	}
+	exp = `id: 2
+event: job_sent
+data: {"uri":"spotify:track:1301WleyT98MSxVHPZCA6M"}`
+	if e := readEvent(t, r); e != exp {
+		t.Errorf("Got %q, expected %q", e, exp)
+	}
+
+	t.Run("Last-Event-ID", func(t *testing.T) {
+		r, done := subscribe(t, "1")
+		defer done()
+
+		if e := readEvent(t, r); !strings.HasPrefix(e, "id: 2\n") {
+			t.Errorf("Got %q, expected event 2", e)
+		}
+	})
+
+	t.Run("Invalid Last-Event-ID", func(t *testing.T) {
+		req, err := http.NewRequest(http.MethodGet, ts.URL+"/events", nil)
+		if err != nil {
+			t.Fatalf("Got %T (%s), expected nil", err, err)
+		}
+		req.Header.Set("Authorization", "Token "+authToken)
+		req.Header.Set("Last-Event-ID", "foo")
+		res, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("Got %T (%s), expected nil", err, err)
+		}
+		_ = res.Body.Close()
+		if res.StatusCode != http.StatusBadRequest {
+			t.Errorf("Got %d, expected 400", res.StatusCode)
+		}
+	})
+
+	t.Run("Unauthorized", func(t *testing.T) {
+		res, err := http.Get(ts.URL + "/events?token=foo")
+		if err != nil {
+			t.Fatalf("Got %T (%s), expected nil", err, err)
+		}
+		_ = res.Body.Close()
+		if res.StatusCode != http.StatusUnauthorized {
+			t.Errorf("Got %d, expected 401", res.StatusCode)
+		}
+	})
+}
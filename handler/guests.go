@@ -0,0 +1,147 @@
+package handler
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/epels/sparty/guest"
+)
+
+type registry interface {
+	// Issue issues a new token for a guest named name, that expires after ttl
+	// or never if ttl is zero.
+	Issue(name string, ttl time.Duration, trusted bool) (guest.Guest, string, error)
+	// Lookup returns the guest token belongs to, if it is valid.
+	Lookup(token string) (guest.Guest, bool)
+	Revoke(name string) error
+	List() []guest.Guest
+}
+
+// hostGuest is the identity of callers authenticating with the sparty token.
+var hostGuest = guest.Guest{Name: "host", Host: true}
+
+// WithGuests lets the host issue tokens to named guests through the /guests
+// endpoint, keeping track of them in r. Guests can use their token anywhere the
+// sparty token is accepted, except to manage guests.
+func WithGuests(r registry) Option {
+	return func(h *handler) {
+		h.guests = r
+	}
+}
+
+// hostOnly only lets the host through. It must be wrapped by auth.
+func (h *handler) hostOnly(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if g, _ := guest.FromContext(r.Context()); !g.Host {
+			http.Error(w, http.StatusText(http.StatusForbidden), http.StatusForbidden)
+			return
+		}
+		next(w, r)
+	}
+}
+
+// guestsHandler lets the host manage guests: GET lists them, POST issues a
+// token to the guest in name (optionally expiring after ttl, e.g. 4h, and
+// optionally trusted) and DELETE revokes the token of the guest in name.
+func (h *handler) guestsHandler(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		h.writeJSON(w, http.StatusOK, struct {
+			Guests []guest.Guest `json:"guests"`
+		}{h.guests.List()})
+	case http.MethodPost:
+		h.issueGuest(w, r)
+	case http.MethodDelete:
+		h.revokeGuest(w, r)
+	default:
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+	}
+}
+
+func (h *handler) issueGuest(w http.ResponseWriter, r *http.Request) {
+	name := r.URL.Query().Get("name")
+	if name == "" {
+		w.WriteHeader(http.StatusBadRequest)
+		_, _ = fmt.Fprintln(w, "Missing required parameter: name")
+		return
+	}
+	if reservedName(name) {
+		w.WriteHeader(http.StatusBadRequest)
+		_, _ = fmt.Fprintf(w, "Invalid value for parameter: name (%s): reserved\n", name)
+		return
+	}
+	var ttl time.Duration
+	if v := r.URL.Query().Get("ttl"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d <= 0 {
+			w.WriteHeader(http.StatusBadRequest)
+			_, _ = fmt.Fprintf(w, "Invalid value for parameter: ttl (%s)\n", v)
+			return
+		}
+		ttl = d
+	}
+
+	var trusted bool
+	if v := r.URL.Query().Get("trusted"); v != "" {
+		b, err := strconv.ParseBool(v)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			_, _ = fmt.Fprintf(w, "Invalid value for parameter: trusted (%s)\n", v)
+			return
+		}
+		trusted = b
+	}
+
+	g, tok, err := h.guests.Issue(name, ttl, trusted)
+	switch {
+	case errors.Is(err, guest.ErrInvalidName):
+		w.WriteHeader(http.StatusBadRequest)
+		_, _ = fmt.Fprintf(w, "Invalid value for parameter: name (%s)\n", name)
+		return
+	case errors.Is(err, guest.ErrNameTaken):
+		w.WriteHeader(http.StatusConflict)
+		_, _ = fmt.Fprintf(w, "Guest already exists: %s\n", name)
+		return
+	case err != nil:
+		h.errLog.Printf("%T: Issue: %s", h.guests, err)
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+	h.infoLog.Printf("Issued token to guest %q", g.Name)
+	h.writeJSON(w, http.StatusCreated, struct {
+		Guest guest.Guest `json:"guest"`
+		Token string      `json:"token"`
+	}{g, tok})
+}
+
+// reservedName reports whether name is that of the host or the admin, which
+// guests may not pass themselves off as: their songs would be credited to them.
+func reservedName(name string) bool {
+	name = strings.TrimSpace(name)
+	return strings.EqualFold(name, hostGuest.Name) || strings.EqualFold(name, adminGuest.Name)
+}
+
+func (h *handler) revokeGuest(w http.ResponseWriter, r *http.Request) {
+	name := r.URL.Query().Get("name")
+	if name == "" {
+		w.WriteHeader(http.StatusBadRequest)
+		_, _ = fmt.Fprintln(w, "Missing required parameter: name")
+		return
+	}
+	if err := h.guests.Revoke(name); err != nil {
+		if errors.Is(err, guest.ErrNotFound) {
+			w.WriteHeader(http.StatusNotFound)
+			_, _ = fmt.Fprintf(w, "No such guest: %s\n", name)
+			return
+		}
+		h.errLog.Printf("%T: Revoke: %s", h.guests, err)
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+	h.infoLog.Printf("Revoked token of guest %q", name)
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,191 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/epels/sparty/guest"
+	"github.com/epels/sparty/internal/mock"
+	"github.com/epels/sparty/jobqueue"
+)
+
+func TestGuests(t *testing.T) {
+	noopLogger := log.New(ioutil.Discard, "", 0)
+	noopJobqueue := mock.Jobqueue{
+		PutFunc: func(ctx context.Context, j jobqueue.Job) (string, error) {
+			return "", nil
+		},
+	}
+
+	t.Run("Disabled", func(t *testing.T) {
+		rec := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodGet, "/guests", nil)
+		setAuth(t, req)
+		New(noopLogger, noopLogger, noopJobqueue, authToken).ServeHTTP(rec, req)
+
+		if rec.Code != http.StatusNotFound {
+			t.Errorf("Got %d, expected 404", rec.Code)
+		}
+	})
+
+	t.Run("Issue", func(t *testing.T) {
+		h := New(noopLogger, noopLogger, noopJobqueue, authToken, WithGuests(guest.NewRegistry()))
+
+		rec := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodPost, "/guests?name=alice&ttl=4h", nil)
+		setAuth(t, req)
+		h.ServeHTTP(rec, req)
+
+		if rec.Code != http.StatusCreated {
+			t.Fatalf("Got %d, expected 201", rec.Code)
+		}
+		var res struct {
+			Guest guest.Guest `json:"guest"`
+			Token string      `json:"token"`
+		}
+		if err := json.NewDecoder(rec.Body).Decode(&res); err != nil {
+			t.Fatalf("Got %T (%s), expected nil", err, err)
+		}
+		if res.Guest.Name != "alice" {
+			t.Errorf("Got %q, expected alice", res.Guest.Name)
+		}
+		if res.Token == "" || res.Guest.ExpiresAt.IsZero() {
+			t.Errorf("Got %+v, expected token and expiry", res)
+		}
+
+		// Issuing one for the same name conflicts.
+		rec = httptest.NewRecorder()
+		req = httptest.NewRequest(http.MethodPost, "/guests?name=alice", nil)
+		setAuth(t, req)
+		h.ServeHTTP(rec, req)
+		if rec.Code != http.StatusConflict {
+			t.Errorf("Got %d, expected 409", rec.Code)
+		}
+	})
+
+	t.Run("Invalid ttl", func(t *testing.T) {
+		rec := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodPost, "/guests?name=alice&ttl=forever", nil)
+		setAuth(t, req)
+		New(noopLogger, noopLogger, noopJobqueue, authToken, WithGuests(guest.NewRegistry())).ServeHTTP(rec, req)
+
+		if rec.Code != http.StatusBadRequest {
+			t.Errorf("Got %d, expected 400", rec.Code)
+		}
+	})
+
+	t.Run("Reserved name", func(t *testing.T) {
+		h := New(noopLogger, noopLogger, noopJobqueue, authToken, WithGuests(guest.NewRegistry()))
+		for _, name := range []string{"host", "Admin", "%20host"} {
+			rec := httptest.NewRecorder()
+			req := httptest.NewRequest(http.MethodPost, "/guests?name="+name, nil)
+			setAuth(t, req)
+			h.ServeHTTP(rec, req)
+
+			if rec.Code != http.StatusBadRequest {
+				t.Errorf("Got %d for %q, expected 400", rec.Code, name)
+			}
+		}
+	})
+
+	t.Run("Guest", func(t *testing.T) {
+		reg := guest.NewRegistry()
+		_, tok, err := reg.Issue("alice", 0, false)
+		if err != nil {
+			t.Fatalf("Got %T (%s), expected nil", err, err)
+		}
+		var requester string
+		jq := mock.Jobqueue{
+			PutFunc: func(ctx context.Context, j jobqueue.Job) (string, error) {
+				requester = j.Requester
+				return "", nil
+			},
+		}
+		h := New(noopLogger, noopLogger, jq, authToken, WithGuests(reg))
+
+		rec := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodPost, "/enqueue?url=spotify:track:1301WleyT98MSxVHPZCA6M", nil)
+		req.Header.Set("Authorization", "Token "+tok)
+		h.ServeHTTP(rec, req)
+		if rec.Code != http.StatusAccepted {
+			t.Errorf("Got %d, expected 202", rec.Code)
+		}
+		if requester != "alice" {
+			t.Errorf("Got %q, expected alice", requester)
+		}
+
+		// Guests may not manage guests.
+		rec = httptest.NewRecorder()
+		req = httptest.NewRequest(http.MethodGet, "/guests", nil)
+		req.Header.Set("Authorization", "Token "+tok)
+		h.ServeHTTP(rec, req)
+		if rec.Code != http.StatusForbidden {
+			t.Errorf("Got %d, expected 403", rec.Code)
+		}
+	})
+
+	t.Run("Revoke", func(t *testing.T) {
+		reg := guest.NewRegistry()
+		_, tok, err := reg.Issue("alice", 0, false)
+		if err != nil {
+			t.Fatalf("Got %T (%s), expected nil", err, err)
+		}
+		h := New(noopLogger, noopLogger, noopJobqueue, authToken, WithGuests(reg))
+
+		rec := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodDelete, "/guests?name=alice", nil)
+		setAuth(t, req)
+		h.ServeHTTP(rec, req)
+		if rec.Code != http.StatusNoContent {
+			t.Errorf("Got %d, expected 204", rec.Code)
+		}
+
+		rec = httptest.NewRecorder()
+		req = httptest.NewRequest(http.MethodPost, "/enqueue?url=spotify:track:1301WleyT98MSxVHPZCA6M", nil)
+		req.Header.Set("Authorization", "Token "+tok)
+		h.ServeHTTP(rec, req)
+		if rec.Code != http.StatusUnauthorized {
+			t.Errorf("Got %d, expected 401", rec.Code)
+		}
+
+		rec = httptest.NewRecorder()
+		req = httptest.NewRequest(http.MethodDelete, "/guests?name=alice", nil)
+		setAuth(t, req)
+		h.ServeHTTP(rec, req)
+		if rec.Code != http.StatusNotFound {
+			t.Errorf("Got %d, expected 404", rec.Code)
+		}
+	})
+
+	t.Run("List", func(t *testing.T) {
+		reg := guest.NewRegistry()
+		for _, name := range []string{"bob", "alice"} {
+			if _, _, err := reg.Issue(name, 0, false); err != nil {
+				t.Fatalf("Got %T (%s), expected nil", err, err)
+			}
+		}
+
+		rec := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodGet, "/guests", nil)
+		setAuth(t, req)
+		New(noopLogger, noopLogger, noopJobqueue, authToken, WithGuests(reg)).ServeHTTP(rec, req)
+
+		if rec.Code != http.StatusOK {
+			t.Fatalf("Got %d, expected 200", rec.Code)
+		}
+		var res struct {
+			Guests []guest.Guest `json:"guests"`
+		}
+		if err := json.NewDecoder(rec.Body).Decode(&res); err != nil {
+			t.Fatalf("Got %T (%s), expected nil", err, err)
+		}
+		if len(res.Guests) != 2 || res.Guests[0].Name != "alice" || res.Guests[1].Name != "bob" {
+			t.Errorf("Got %+v, expected alice and bob", res.Guests)
+		}
+	})
+}
@@ -1,59 +1,175 @@
 package handler
 
 import (
+	"context"
+	"crypto/subtle"
 	"errors"
 	"fmt"
 	"log"
 	"net/http"
-	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/epels/sparty/guest"
+	"github.com/epels/sparty/jobqueue"
+	"github.com/epels/sparty/spotifyurl"
 )
 
-// @todo: Add some basic auth.
 type handler struct {
 	http.Handler
 
 	errLog, infoLog *log.Logger
-	jq              jobqueue
+	jq              queue
+	resolver        resolver
+	searcher        searcher
+	market          string
 	token           string
+	guests          registry
+	limiter         *limiter
+	history         *history
+	policy          checker
+	moderation      *moderation
+	party           partyQueue
+	skipper         skipper
+	skipVotes       SkipVotes
+	skips           *skips
+	activity        *activity
+	nowPlaying      *nowPlaying
+	requesters      *requesters
+	jobs            statuser
+	bus             eventBus
+	ui              bool
+	admin           *Admin
+
+	authn       authenticator
+	redirectURI string
+	loginsMu    sync.Mutex
+	logins      map[string]pendingLogin
+
+	// nowFunc returns the current local time. Can be used to instrument tests.
+	nowFunc func() time.Time
 }
 
-type jobqueue interface {
+type queue interface {
 	// Put puts a job into the jobqueue that will, upon consumption by the
-	// worker, enqueue the referenced song in Spotify.
-	Put(uri string) error
+	// worker, enqueue the referenced song in Spotify. It returns the ID of
+	// the job, or jobqueue.ErrQueueFull if the jobqueue is full.
+	Put(ctx context.Context, j jobqueue.Job) (string, error)
+}
+
+type resolver interface {
+	// Resolve resolves a link that is not a Spotify link, e.g. one to the same
+	// song on another streaming service, to a Spotify track URI.
+	Resolve(ctx context.Context, link string) (string, error)
 }
 
-var (
-	_ http.Handler = (*handler)(nil) // Compile-time assurance.
+// Option configures optional behavior of the handler.
+type Option func(h *handler)
 
-	spotifyURLRe = regexp.MustCompile("^https:\\/\\/open.spotify\\..*\\/track\\/(.*)\\?si=.*$")
-)
+// WithResolver makes the handler fall back to r for links that are not Spotify
+// links.
+func WithResolver(r resolver) Option {
+	return func(h *handler) {
+		h.resolver = r
+	}
+}
 
-func New(errLog, infoLog *log.Logger, jq jobqueue, token string) *handler {
+var _ http.Handler = (*handler)(nil) // Compile-time assurance.
+
+// New creates the API handler. Callers authenticate with token as the host,
+// or with a guest token if guests are enabled using WithGuests.
+func New(errLog, infoLog *log.Logger, jq queue, token string, opts ...Option) *handler {
 	h := handler{
 		errLog:  errLog,
 		infoLog: infoLog,
 		jq:      jq,
+		token:   token,
+		nowFunc: time.Now,
+	}
+	for _, opt := range opts {
+		opt(&h)
 	}
 
 	mux := http.NewServeMux()
-	mux.HandleFunc("/enqueue", h.method(http.MethodPost, h.auth(token, h.log(h.enqueue))))
+	mux.HandleFunc("/enqueue", h.method(http.MethodPost, h.auth(h.log(h.enqueue))))
+	if h.searcher != nil {
+		mux.HandleFunc("/search", h.method(http.MethodGet, h.auth(h.log(h.search))))
+	}
+	if h.guests != nil {
+		mux.HandleFunc("/guests", h.auth(h.hostOnly(h.log(h.guestsHandler))))
+	}
+	if h.party != nil {
+		mux.HandleFunc("/party", h.method(http.MethodGet, h.auth(h.log(h.partyItems))))
+		mux.HandleFunc("/party/vote", h.method(http.MethodPost, h.auth(h.log(h.vote))))
+	}
+	if h.skipper != nil {
+		mux.HandleFunc("/skip", h.method(http.MethodPost, h.auth(h.log(h.skip))))
+	}
+	if h.bus != nil {
+		mux.HandleFunc("/events", h.method(http.MethodGet, tokenQuery(h.auth(h.log(h.eventsHandler)))))
+	}
+	if h.jobs != nil {
+		mux.HandleFunc("/jobs/", h.method(http.MethodGet, h.auth(h.log(h.job))))
+	}
+	if h.nowPlaying != nil {
+		mux.HandleFunc("/now-playing", h.method(http.MethodGet, h.auth(h.log(h.nowPlayingHandler))))
+		mux.HandleFunc("/queue", h.method(http.MethodGet, h.auth(h.log(h.queueHandler))))
+	}
+	if h.moderation != nil {
+		mux.HandleFunc("/approvals", h.method(http.MethodGet, h.auth(h.hostOnly(h.log(h.approvals)))))
+		mux.HandleFunc("/approvals/approve", h.method(http.MethodPost, h.auth(h.hostOnly(h.log(h.approve)))))
+		mux.HandleFunc("/approvals/reject", h.method(http.MethodPost, h.auth(h.hostOnly(h.log(h.reject)))))
+	}
+	if h.admin != nil {
+		h.adminRoutes(mux)
+	}
+	if h.ui {
+		mux.HandleFunc("/", h.uiHandler)
+	}
+	if h.authn != nil {
+		// The callback isn't logged: its URL holds the authorization code.
+		mux.HandleFunc("/auth/login", h.log(h.login))
+		mux.HandleFunc("/auth/callback", h.method(http.MethodGet, h.callback))
+	}
 	h.Handler = mux
 
 	return &h
 }
 
-func (h *handler) auth(token string, next http.HandlerFunc) http.HandlerFunc {
+// auth resolves the caller to the host or a guest, and passes their identity on
+// in the request context.
+func (h *handler) auth(next http.HandlerFunc) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		if t := r.Header.Get("Authorization"); t != "Token "+token {
+		g, ok := h.authenticate(r)
+		if !ok {
 			h.infoLog.Printf("Failed auth attempt from %q @ %q", r.UserAgent(), r.Header.Get("X-Forwarded-For"))
 			http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
 			return
 		}
-		next(w, r)
+		if h.activity != nil {
+			h.activity.seen(g.Name, h.nowFunc())
+		}
+		next(w, r.WithContext(guest.NewContext(r.Context(), g)))
 	}
 }
 
+func (h *handler) authenticate(r *http.Request) (guest.Guest, bool) {
+	const prefix = "Token "
+	t := r.Header.Get("Authorization")
+	if !strings.HasPrefix(t, prefix) {
+		return guest.Guest{}, false
+	}
+	t = strings.TrimPrefix(t, prefix)
+	if subtle.ConstantTimeCompare([]byte(t), []byte(h.token)) == 1 {
+		return hostGuest, true
+	}
+	if h.guests == nil {
+		return guest.Guest{}, false
+	}
+	return h.guests.Lookup(t)
+}
+
 func (h *handler) log(next http.HandlerFunc) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		h.infoLog.Printf("%s %s (%q @ %q)", r.Method, r.URL, r.UserAgent(), r.Header.Get("X-Forwarded-For"))
@@ -72,40 +188,140 @@ func (h *handler) method(m string, next http.HandlerFunc) http.HandlerFunc {
 }
 
 // enqueue accepts a song by its Spotify url and sticks a job into the jobqueue
-// to actually send it over to the Spotify Web API. Handler responds with a 204
-// if the song is accepted for delivery, but this does not guarantee it will
-// actually play.
+// to actually send it over to the Spotify Web API. Albums and playlists are
+// accepted too: the worker expands them into their tracks. Handler responds
+// with a 202 and the ID of the job if the song is accepted for delivery, but
+// this does not guarantee it will actually play: GET /jobs/{id} tells whether
+// the worker managed to send it to Spotify.
+//
+// Links to other streaming services are accepted too if the handler has a
+// resolver: it looks up the same song on Spotify. Instead of a url, a search
+// query may be passed in q if the handler has a searcher: the top hit is then
+// enqueued.
+//
+// If moderation is enabled, songs requested by guests await the host's approval
+// instead: the handler then responds with a 202 and the ID of the request.
 func (h *handler) enqueue(w http.ResponseWriter, r *http.Request) {
 	url := r.URL.Query().Get("url")
+	if q := r.URL.Query().Get("q"); url == "" && q != "" && h.searcher != nil {
+		uri, err := h.searchTopHit(r.Context(), q)
+		if err != nil {
+			h.errLog.Printf("searchTopHit: %s", err)
+			h.upstreamError(w, err)
+			return
+		}
+		if uri == "" {
+			w.WriteHeader(http.StatusNotFound)
+			_, _ = fmt.Fprintf(w, "No tracks found for parameter: q (%s)\n", q)
+			return
+		}
+		h.put(w, r, uri)
+		return
+	}
 	if url == "" {
 		w.WriteHeader(http.StatusBadRequest)
 		_, _ = fmt.Fprintln(w, "Missing required parameter: url")
 		return
 	}
 
-	uri, err := parseSpotifyURL(url)
-	if err != nil {
+	var uri string
+	if l, err := parseSpotifyURL(url); err == nil {
+		if h.party != nil && l.Type != spotifyurl.TypeTrack {
+			w.WriteHeader(http.StatusBadRequest)
+			_, _ = fmt.Fprintf(w, "Invalid value for parameter: url (%s): only tracks can be requested\n", url)
+			return
+		}
+		uri = l.URI()
+	} else if h.resolver != nil {
+		uri, err = h.resolver.Resolve(r.Context(), url)
+		if err != nil {
+			h.infoLog.Printf("%T: Resolve: %s", h.resolver, err)
+			w.WriteHeader(http.StatusBadRequest)
+			_, _ = fmt.Fprintf(w, "Invalid value for parameter: url (%s): no matching Spotify track found\n", url)
+			return
+		}
+	} else {
 		w.WriteHeader(http.StatusBadRequest)
 		_, _ = fmt.Fprintf(w, "Invalid value for parameter: url (%s)\n", url)
 		return
 	}
 
-	if err := h.jq.Put(uri); err != nil {
+	h.put(w, r, uri)
+}
+
+// put puts uri into the jobqueue on behalf of the caller and responds
+// accordingly.
+func (h *handler) put(w http.ResponseWriter, r *http.Request, uri string) {
+	if !h.allowed(w, r, uri) {
+		return
+	}
+	g, _ := guest.FromContext(r.Context())
+	unlimit, limited := h.limited(w, g)
+	if limited {
+		return
+	}
+	forget, dup := h.duplicate(w, uri)
+	if dup {
+		unlimit()
+		return
+	}
+	undo := func() {
+		forget()
+		unlimit()
+	}
+	j := jobqueue.Job{URI: uri, Requester: g.Name}
+	if h.needsApproval(g) {
+		if !h.park(w, j) {
+			undo()
+		}
+		return
+	}
+	id, err := h.jq.Put(r.Context(), j)
+	if err != nil {
+		undo()
 		h.errLog.Printf("%T: Put: %s", h.jq, err)
-		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		h.putError(w, err)
 		return
 	}
+	j.ID = id
+	h.requested(j)
 
-	w.WriteHeader(http.StatusNoContent)
+	if h.jobs != nil {
+		w.Header().Set("Location", "/jobs/"+id)
+	}
+	h.writeJSON(w, http.StatusAccepted, struct {
+		ID     string `json:"id"`
+		Status string `json:"status"`
+	}{id, string(jobqueue.StatePending)})
 }
 
-// parseSpotifyURL parses a full Spotify URL in the Spotify app's sharing
-// format, e.g. https://open.spotify.com/track/1301WleyT98MSxVHPZCA6M?si=FY7aEiPCT0u3-CuNApJTRg,
-// to its Spotify "URI": spotify:track:1301WleyT98MSxVHPZCA6M.
-func parseSpotifyURL(url string) (string, error) {
-	uriSubs := spotifyURLRe.FindStringSubmatch(url)
-	if len(uriSubs) != 2 {
-		return "", errors.New("url is not a valid Spotify track URL")
+// queueRetryAfter is how long callers are asked to wait when the jobqueue is
+// full: long enough for the worker to send a few songs to Spotify.
+const queueRetryAfter = 30 * time.Second
+
+// putError responds to a job that could not be put into the jobqueue. If it is
+// full, or shutting down, the caller is asked to come back later.
+func (h *handler) putError(w http.ResponseWriter, err error) {
+	if errors.Is(err, jobqueue.ErrQueueFull) || errors.Is(err, jobqueue.ErrClosed) {
+		setRetryAfter(w, queueRetryAfter)
+		http.Error(w, http.StatusText(http.StatusServiceUnavailable), http.StatusServiceUnavailable)
+		return
+	}
+	http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+}
+
+// parseSpotifyURL parses any link to a Spotify track, album or playlist, be it
+// a URI such as spotify:track:1301WleyT98MSxVHPZCA6M or a URL as shared by the
+// Spotify app, e.g. https://open.spotify.com/track/1301WleyT98MSxVHPZCA6M?si=FY7aEiPCT0u3-CuNApJTRg.
+func parseSpotifyURL(url string) (spotifyurl.Link, error) {
+	l, err := spotifyurl.Parse(url)
+	if err != nil {
+		return spotifyurl.Link{}, fmt.Errorf("spotifyurl: Parse: %w", err)
+	}
+	switch l.Type {
+	case spotifyurl.TypeTrack, spotifyurl.TypeAlbum, spotifyurl.TypePlaylist:
+	default:
+		return spotifyurl.Link{}, errors.New("url is not a valid Spotify track, album or playlist URL")
 	}
-	return "spotify:track:" + uriSubs[1], nil
+	return l, nil
 }
@@ -1,7 +1,9 @@
 package handler
 
 import (
+	"context"
 	"errors"
+	"fmt"
 	"io/ioutil"
 	"log"
 	"net/http"
@@ -11,6 +13,7 @@ import (
 	"testing"
 
 	"github.com/epels/sparty/internal/mock"
+	"github.com/epels/sparty/jobqueue"
 )
 
 const authToken = "secret"
@@ -18,8 +21,8 @@ const authToken = "secret"
 func TestEnqueue(t *testing.T) {
 	noopLogger := log.New(ioutil.Discard, "", 0)
 	noopJobqueue := mock.Jobqueue{
-		PutFunc: func(url string) error {
-			return nil
+		PutFunc: func(ctx context.Context, j jobqueue.Job) (string, error) {
+			return "", nil
 		},
 	}
 
@@ -82,8 +85,8 @@ func TestEnqueue(t *testing.T) {
 		var sb strings.Builder
 		errLog := log.New(&sb, "", log.LstdFlags)
 		jq := mock.Jobqueue{
-			PutFunc: func(url string) error {
-				return errors.New("some error")
+			PutFunc: func(ctx context.Context, j jobqueue.Job) (string, error) {
+				return "", errors.New("some error")
 			},
 		}
 		New(errLog, noopLogger, jq, authToken).ServeHTTP(rec, req)
@@ -96,6 +99,83 @@ func TestEnqueue(t *testing.T) {
 		}
 	})
 
+	t.Run("Jobqueue full", func(t *testing.T) {
+		for _, err := range []error{jobqueue.ErrQueueFull, jobqueue.ErrClosed} {
+			rec := httptest.NewRecorder()
+			req := httptest.NewRequest(http.MethodPost, "/enqueue?url=spotify:track:1301WleyT98MSxVHPZCA6M", nil)
+			setAuth(t, req)
+
+			jq := mock.Jobqueue{
+				PutFunc: func(ctx context.Context, j jobqueue.Job) (string, error) {
+					return "", fmt.Errorf("jobqueue: %w", err)
+				},
+			}
+			New(noopLogger, noopLogger, jq, authToken).ServeHTTP(rec, req)
+
+			if rec.Code != http.StatusServiceUnavailable {
+				t.Errorf("Got %d for %s, expected 503", rec.Code, err)
+			}
+			if ra := rec.Header().Get("Retry-After"); ra != "30" {
+				t.Errorf("Got %q for %s, expected 30", ra, err)
+			}
+		}
+	})
+
+	t.Run("Resolved", func(t *testing.T) {
+		vals := url.Values{}
+		vals.Set("url", "https://music.apple.com/song/123")
+
+		rec := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodPost, "/enqueue?"+vals.Encode(), nil)
+		setAuth(t, req)
+
+		var called bool
+		jq := mock.Jobqueue{
+			PutFunc: func(ctx context.Context, j jobqueue.Job) (string, error) {
+				called = true
+
+				if j.URI != "spotify:track:1301WleyT98MSxVHPZCA6M" {
+					t.Errorf("Got %q, expected spotify:track:1301WleyT98MSxVHPZCA6M", j.URI)
+				}
+
+				return "", nil
+			},
+		}
+		res := mock.Resolver{
+			ResolveFunc: func(ctx context.Context, link string) (string, error) {
+				if link != "https://music.apple.com/song/123" {
+					t.Errorf("Got %q, expected https://music.apple.com/song/123", link)
+				}
+				return "spotify:track:1301WleyT98MSxVHPZCA6M", nil
+			},
+		}
+		New(noopLogger, noopLogger, jq, authToken, WithResolver(res)).ServeHTTP(rec, req)
+
+		if rec.Code != http.StatusAccepted {
+			t.Errorf("Got %d, expected 202", rec.Code)
+		}
+		if !called {
+			t.Error("Got false, expected true")
+		}
+	})
+
+	t.Run("Unresolvable", func(t *testing.T) {
+		rec := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodPost, "/enqueue?url=notmatching", nil)
+		setAuth(t, req)
+
+		res := mock.Resolver{
+			ResolveFunc: func(ctx context.Context, link string) (string, error) {
+				return "", errors.New("some error")
+			},
+		}
+		New(noopLogger, noopLogger, noopJobqueue, authToken, WithResolver(res)).ServeHTTP(rec, req)
+
+		if rec.Code != http.StatusBadRequest {
+			t.Errorf("Got %d, expected 400", rec.Code)
+		}
+	})
+
 	t.Run("OK", func(t *testing.T) {
 		vals := url.Values{}
 		vals.Set("url", "https://open.spotify.com/track/1301WleyT98MSxVHPZCA6M?si=FY7aEiPCT0u3-CuNApJTRg")
@@ -106,20 +186,23 @@ func TestEnqueue(t *testing.T) {
 
 		var called bool
 		jq := mock.Jobqueue{
-			PutFunc: func(url string) error {
+			PutFunc: func(ctx context.Context, j jobqueue.Job) (string, error) {
 				called = true
 
-				if url != "spotify:track:1301WleyT98MSxVHPZCA6M" {
-					t.Errorf("Got %q, expected spotify:track:1301WleyT98MSxVHPZCA6M", url)
+				if j.URI != "spotify:track:1301WleyT98MSxVHPZCA6M" {
+					t.Errorf("Got %q, expected spotify:track:1301WleyT98MSxVHPZCA6M", j.URI)
+				}
+				if j.Requester != "host" {
+					t.Errorf("Got %q, expected host", j.Requester)
 				}
 
-				return nil
+				return "", nil
 			},
 		}
 		New(noopLogger, noopLogger, jq, authToken).ServeHTTP(rec, req)
 
-		if rec.Code != http.StatusNoContent {
-			t.Errorf("Got %d, expected 204", rec.Code)
+		if rec.Code != http.StatusAccepted {
+			t.Errorf("Got %d, expected 202", rec.Code)
 		}
 		if !called {
 			t.Error("Got false, expected true")
@@ -135,11 +218,21 @@ func setAuth(t *testing.T, r *http.Request) {
 
 func TestParseSpotifyURL(t *testing.T) {
 	t.Run("Matches", func(t *testing.T) {
-		uri, err := parseSpotifyURL("https://open.spotify.com/track/1301WleyT98MSxVHPZCA6M?si=FY7aEiPCT0u3-CuNApJTRg")
+		l, err := parseSpotifyURL("https://open.spotify.com/track/1301WleyT98MSxVHPZCA6M?si=FY7aEiPCT0u3-CuNApJTRg")
+		if err != nil {
+			t.Fatalf("Got %T (%s), expected nil", err, err)
+		}
+		if uri := l.URI(); uri != "spotify:track:1301WleyT98MSxVHPZCA6M" {
+			t.Errorf("Got %q, expected spotify:track:1301WleyT98MSxVHPZCA6M", uri)
+		}
+	})
+
+	t.Run("URI", func(t *testing.T) {
+		l, err := parseSpotifyURL("spotify:track:1301WleyT98MSxVHPZCA6M")
 		if err != nil {
 			t.Fatalf("Got %T (%s), expected nil", err, err)
 		}
-		if uri != "spotify:track:1301WleyT98MSxVHPZCA6M" {
+		if uri := l.URI(); uri != "spotify:track:1301WleyT98MSxVHPZCA6M" {
 			t.Errorf("Got %q, expected spotify:track:1301WleyT98MSxVHPZCA6M", uri)
 		}
 	})
@@ -150,4 +243,31 @@ func TestParseSpotifyURL(t *testing.T) {
 			t.Fatalf("Got nil, expected error")
 		}
 	})
+
+	t.Run("Album", func(t *testing.T) {
+		l, err := parseSpotifyURL("https://open.spotify.com/album/4aawyAB9vmqN3uQ7FjRGTy?si=FY7aEiPCT0u3-CuNApJTRg")
+		if err != nil {
+			t.Fatalf("Got %T (%s), expected nil", err, err)
+		}
+		if uri := l.URI(); uri != "spotify:album:4aawyAB9vmqN3uQ7FjRGTy" {
+			t.Errorf("Got %q, expected spotify:album:4aawyAB9vmqN3uQ7FjRGTy", uri)
+		}
+	})
+
+	t.Run("Playlist", func(t *testing.T) {
+		l, err := parseSpotifyURL("spotify:playlist:37i9dQZF1DXcBWIGoYBM5M")
+		if err != nil {
+			t.Fatalf("Got %T (%s), expected nil", err, err)
+		}
+		if uri := l.URI(); uri != "spotify:playlist:37i9dQZF1DXcBWIGoYBM5M" {
+			t.Errorf("Got %q, expected spotify:playlist:37i9dQZF1DXcBWIGoYBM5M", uri)
+		}
+	})
+
+	t.Run("Not enqueueable", func(t *testing.T) {
+		_, err := parseSpotifyURL("https://open.spotify.com/artist/0OdUWJ0sBjDrqHygGUXeCF")
+		if err == nil {
+			t.Fatalf("Got nil, expected error")
+		}
+	})
 }
@@ -0,0 +1,123 @@
+package handler
+
+import (
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// maxHistory bounds the number of songs remembered for the cooldown. Once it is
+// reached, the oldest ones are forgotten early.
+const maxHistory = 1000
+
+// WithCooldown rejects requests for songs that are waiting in the jobqueue or
+// for approval already, or that were requested less than d ago. Checking the
+// jobqueue requires it to report its pending jobs through a method Pending.
+func WithCooldown(d time.Duration) Option {
+	return func(h *handler) {
+		h.history = newHistory(d, maxHistory)
+	}
+}
+
+// history remembers when songs were requested, up to max of them.
+type history struct {
+	cooldown time.Duration
+	max      int
+
+	mu sync.Mutex
+	at map[string]time.Time
+	// order holds the songs in at in the order they were requested, so the
+	// oldest can be forgotten first.
+	order []historyEntry
+}
+
+type historyEntry struct {
+	uri string
+	at  time.Time
+}
+
+func newHistory(cooldown time.Duration, max int) *history {
+	return &history{
+		cooldown: cooldown,
+		max:      max,
+		at:       make(map[string]time.Time),
+	}
+}
+
+// reserve records uri as requested at now and returns 0, unless it was
+// requested within the cooldown: then it returns the remaining cooldown.
+func (hi *history) reserve(uri string, now time.Time) time.Duration {
+	hi.mu.Lock()
+	defer hi.mu.Unlock()
+
+	hi.prune(now)
+	if at, ok := hi.at[uri]; ok {
+		return at.Add(hi.cooldown).Sub(now)
+	}
+	hi.at[uri] = now
+	hi.order = append(hi.order, historyEntry{uri: uri, at: now})
+	if len(hi.order) > hi.max {
+		hi.evict(hi.order[0])
+		hi.order = hi.order[1:]
+	}
+	return 0
+}
+
+// forget undoes the reservation of uri at t, e.g. because putting it into the
+// jobqueue failed.
+func (hi *history) forget(uri string, t time.Time) {
+	hi.mu.Lock()
+	defer hi.mu.Unlock()
+
+	hi.evict(historyEntry{uri: uri, at: t})
+}
+
+// prune forgets songs whose cooldown is over. Callers must hold hi.mu.
+func (hi *history) prune(now time.Time) {
+	i := 0
+	for i < len(hi.order) && !now.Before(hi.order[i].at.Add(hi.cooldown)) {
+		hi.evict(hi.order[i])
+		i++
+	}
+	hi.order = hi.order[i:]
+}
+
+// evict removes e from at, if it was not requested again since. Entries in
+// order are left for prune to clean up. Callers must hold hi.mu.
+func (hi *history) evict(e historyEntry) {
+	if at, ok := hi.at[e.uri]; ok && at.Equal(e.at) {
+		delete(hi.at, e.uri)
+	}
+}
+
+// duplicate responds with a 409 and returns true if the song uri is pending in
+// the jobqueue, or still in its cooldown. Otherwise, the song is reserved and a
+// function to undo that is returned.
+func (h *handler) duplicate(w http.ResponseWriter, uri string) (undo func(), dup bool) {
+	if h.history == nil {
+		return func() {}, false
+	}
+	if h.moderation != nil && h.moderation.has(uri) {
+		w.WriteHeader(http.StatusConflict)
+		_, _ = fmt.Fprintln(w, "This song is awaiting approval already")
+		return nil, true
+	}
+	if pl, ok := h.jq.(pendingLister); ok {
+		for _, j := range pl.Pending() {
+			if j.URI == uri {
+				w.WriteHeader(http.StatusConflict)
+				_, _ = fmt.Fprintln(w, "This song is waiting to be queued already")
+				return nil, true
+			}
+		}
+	}
+	now := h.nowFunc()
+	if d := h.history.reserve(uri, now); d > 0 {
+		secs := setRetryAfter(w, d)
+		w.WriteHeader(http.StatusConflict)
+		_, _ = fmt.Fprintf(w, "This song was requested recently, try again in %s\n", time.Duration(secs)*time.Second)
+		return nil, true
+	}
+	return func() { h.history.forget(uri, now) }, false
+}
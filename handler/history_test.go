@@ -0,0 +1,137 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/epels/sparty/internal/mock"
+	"github.com/epels/sparty/jobqueue"
+)
+
+func TestHistoryReserve(t *testing.T) {
+	start := time.Date(2020, 1, 1, 20, 0, 0, 0, time.UTC)
+
+	t.Run("Cooldown", func(t *testing.T) {
+		hi := newHistory(time.Hour, 10)
+		if d := hi.reserve("foo", start); d != 0 {
+			t.Errorf("Got %s, expected 0", d)
+		}
+		if d := hi.reserve("foo", start.Add(20*time.Minute)); d != 40*time.Minute {
+			t.Errorf("Got %s, expected 40m0s", d)
+		}
+		if d := hi.reserve("bar", start.Add(20*time.Minute)); d != 0 {
+			t.Errorf("Got %s, expected 0", d)
+		}
+		if d := hi.reserve("foo", start.Add(time.Hour)); d != 0 {
+			t.Errorf("Got %s, expected 0", d)
+		}
+	})
+
+	t.Run("Bounded", func(t *testing.T) {
+		hi := newHistory(time.Hour, 2)
+		for i, uri := range []string{"foo", "bar", "baz"} {
+			if d := hi.reserve(uri, start.Add(time.Duration(i)*time.Minute)); d != 0 {
+				t.Errorf("Got %s, expected 0", d)
+			}
+		}
+		if n := len(hi.at); n != 2 {
+			t.Errorf("Got %d, expected 2", n)
+		}
+		// The oldest one was forgotten early.
+		if d := hi.reserve("foo", start.Add(3*time.Minute)); d != 0 {
+			t.Errorf("Got %s, expected 0", d)
+		}
+	})
+
+	t.Run("Forget", func(t *testing.T) {
+		hi := newHistory(time.Hour, 10)
+		if d := hi.reserve("foo", start); d != 0 {
+			t.Errorf("Got %s, expected 0", d)
+		}
+		hi.forget("foo", start)
+		if d := hi.reserve("foo", start.Add(time.Minute)); d != 0 {
+			t.Errorf("Got %s, expected 0", d)
+		}
+		// Forgetting the first reservation leaves the second one alone.
+		hi.forget("foo", start)
+		if d := hi.reserve("foo", start.Add(2*time.Minute)); d != 59*time.Minute {
+			t.Errorf("Got %s, expected 59m0s", d)
+		}
+	})
+}
+
+func TestEnqueueDuplicate(t *testing.T) {
+	noopLogger := log.New(ioutil.Discard, "", 0)
+	noopJobqueue := mock.Jobqueue{
+		PutFunc: func(ctx context.Context, j jobqueue.Job) (string, error) {
+			return "", nil
+		},
+	}
+	enqueue := func(h http.Handler) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodPost, "/enqueue?url=spotify:track:1301WleyT98MSxVHPZCA6M", nil)
+		setAuth(t, req)
+		h.ServeHTTP(rec, req)
+		return rec
+	}
+
+	t.Run("Cooldown", func(t *testing.T) {
+		now := time.Date(2020, 1, 1, 20, 0, 0, 0, time.UTC)
+		h := New(noopLogger, noopLogger, noopJobqueue, authToken, WithCooldown(time.Hour))
+		h.nowFunc = func() time.Time { return now }
+
+		if rec := enqueue(h); rec.Code != http.StatusAccepted {
+			t.Errorf("Got %d, expected 202", rec.Code)
+		}
+		now = now.Add(15 * time.Minute)
+		rec := enqueue(h)
+		if rec.Code != http.StatusConflict {
+			t.Errorf("Got %d, expected 409", rec.Code)
+		}
+		if s := rec.Header().Get("Retry-After"); s != "2700" {
+			t.Errorf("Got %q, expected 2700", s)
+		}
+		now = now.Add(45 * time.Minute)
+		if rec := enqueue(h); rec.Code != http.StatusAccepted {
+			t.Errorf("Got %d, expected 202", rec.Code)
+		}
+	})
+
+	t.Run("Pending", func(t *testing.T) {
+		jq := pendingJobqueue{
+			Jobqueue: noopJobqueue,
+			pending:  []jobqueue.Job{{URI: "spotify:track:1301WleyT98MSxVHPZCA6M"}},
+		}
+		h := New(noopLogger, noopLogger, jq, authToken, WithCooldown(time.Hour))
+		if rec := enqueue(h); rec.Code != http.StatusConflict {
+			t.Errorf("Got %d, expected 409", rec.Code)
+		}
+	})
+
+	t.Run("Put failed", func(t *testing.T) {
+		fail := true
+		jq := mock.Jobqueue{
+			PutFunc: func(ctx context.Context, j jobqueue.Job) (string, error) {
+				if fail {
+					return "", errors.New("some error")
+				}
+				return "", nil
+			},
+		}
+		h := New(noopLogger, noopLogger, jq, authToken, WithCooldown(time.Hour))
+		if rec := enqueue(h); rec.Code != http.StatusInternalServerError {
+			t.Errorf("Got %d, expected 500", rec.Code)
+		}
+		// The song can be requested again right away.
+		fail = false
+		if rec := enqueue(h); rec.Code != http.StatusAccepted {
+			t.Errorf("Got %d, expected 202", rec.Code)
+		}
+	})
+}
@@ -0,0 +1,61 @@
+package handler
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/epels/sparty/guest"
+	"github.com/epels/sparty/jobqueue"
+)
+
+type statuser interface {
+	// Status returns the status of the job with the given ID. It returns false
+	// if the job is not known.
+	Status(id string) (jobqueue.Status, bool)
+}
+
+// WithJobStatus lets callers look up the status of the jobs they put through
+// GET /jobs/{id}, as reported by s. This is typically the jobqueue the worker
+// consumes.
+func WithJobStatus(s statuser) Option {
+	return func(h *handler) {
+		h.jobs = s
+	}
+}
+
+// job responds with the status of the job with the ID in the path: whether it
+// is pending, was sent to Spotify or failed, and if so, why.
+func (h *handler) job(w http.ResponseWriter, r *http.Request) {
+	id := strings.TrimPrefix(r.URL.Path, "/jobs/")
+	st, ok := h.jobStatus(id)
+	// Guests only get to see their own jobs: to them, those of others do not
+	// exist.
+	if g, _ := guest.FromContext(r.Context()); ok && !g.Host && st.Requester != g.Name {
+		ok = false
+	}
+	if !ok {
+		http.Error(w, http.StatusText(http.StatusNotFound), http.StatusNotFound)
+		return
+	}
+	h.writeJSON(w, http.StatusOK, struct {
+		ID     string `json:"id"`
+		Status string `json:"status"`
+		Error  string `json:"error,omitempty"`
+	}{id, string(st.State), st.Err})
+}
+
+func (h *handler) jobStatus(id string) (jobqueue.Status, bool) {
+	if id == "" {
+		return jobqueue.Status{}, false
+	}
+	if h.party != nil {
+		// Songs waiting in the party queue have not made it into the jobqueue
+		// yet.
+		for _, it := range h.party.Items() {
+			if it.ID == id {
+				return jobqueue.Status{State: jobqueue.StatePending, Requester: it.Requester}, true
+			}
+		}
+	}
+	return h.jobs.Status(id)
+}
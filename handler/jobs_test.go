@@ -0,0 +1,159 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/epels/sparty/guest"
+	"github.com/epels/sparty/jobqueue"
+	"github.com/epels/sparty/partyqueue"
+)
+
+func TestJobs(t *testing.T) {
+	noopLogger := log.New(ioutil.Discard, "", 0)
+	do := func(h http.Handler, method, target string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		req := httptest.NewRequest(method, target, nil)
+		req.Header.Set("Authorization", "Token "+authToken)
+		h.ServeHTTP(rec, req)
+		return rec
+	}
+	type result struct {
+		ID     string `json:"id"`
+		Status string `json:"status"`
+		Error  string `json:"error"`
+	}
+	enqueue := func(t *testing.T, h http.Handler, uri string) result {
+		t.Helper()
+
+		rec := do(h, http.MethodPost, "/enqueue?url="+uri)
+		if rec.Code != http.StatusAccepted {
+			t.Fatalf("Got %d, expected 202", rec.Code)
+		}
+		var res result
+		if err := json.NewDecoder(rec.Body).Decode(&res); err != nil {
+			t.Fatalf("Got %T (%s), expected nil", err, err)
+		}
+		if res.ID == "" {
+			t.Error("Got empty ID, expected one")
+		}
+		if res.Status != "pending" {
+			t.Errorf("Got %q, expected pending", res.Status)
+		}
+		if loc := rec.Header().Get("Location"); loc != "/jobs/"+res.ID {
+			t.Errorf("Got %q, expected /jobs/%s", loc, res.ID)
+		}
+		return res
+	}
+	status := func(t *testing.T, h http.Handler, id string) result {
+		t.Helper()
+
+		rec := do(h, http.MethodGet, "/jobs/"+id)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("Got %d, expected 200", rec.Code)
+		}
+		var res result
+		if err := json.NewDecoder(rec.Body).Decode(&res); err != nil {
+			t.Fatalf("Got %T (%s), expected nil", err, err)
+		}
+		if res.ID != id {
+			t.Errorf("Got %q, expected %q", res.ID, id)
+		}
+		return res
+	}
+
+	t.Run("Jobqueue", func(t *testing.T) {
+		jq := jobqueue.NewMemory(jobqueue.WithRetryPolicy(jobqueue.RetryPolicy{MaxAttempts: 1}))
+		h := New(noopLogger, noopLogger, jq, authToken, WithJobStatus(jq))
+
+		foo := enqueue(t, h, "spotify:track:1301WleyT98MSxVHPZCA6M")
+		bar := enqueue(t, h, "spotify:track:4u7EnebtmKWzUH433cf5Qv")
+		if res := status(t, h, foo.ID); res.Status != "pending" {
+			t.Errorf("Got %q, expected pending", res.Status)
+		}
+
+		ctx, cancel := context.WithCancel(context.Background())
+		_ = jq.Consume(ctx, func(j jobqueue.Job) error {
+			if j.ID == foo.ID {
+				return errors.New("no active device")
+			}
+			cancel()
+			return nil
+		})
+
+		if res := status(t, h, foo.ID); res.Status != "failed" || res.Error != "no active device" {
+			t.Errorf("Got %+v, expected failed with no active device", res)
+		}
+		if res := status(t, h, bar.ID); res.Status != "sent" || res.Error != "" {
+			t.Errorf("Got %+v, expected sent", res)
+		}
+		if rec := do(h, http.MethodGet, "/jobs/baz"); rec.Code != http.StatusNotFound {
+			t.Errorf("Got %d, expected 404", rec.Code)
+		}
+		if rec := do(h, http.MethodGet, "/jobs/"); rec.Code != http.StatusNotFound {
+			t.Errorf("Got %d, expected 404", rec.Code)
+		}
+	})
+
+	t.Run("Other guests", func(t *testing.T) {
+		reg := guest.NewRegistry()
+		tokens := make(map[string]string)
+		for _, name := range []string{"alice", "bob"} {
+			_, tok, err := reg.Issue(name, 0, false)
+			if err != nil {
+				t.Fatalf("Got %T (%s), expected nil", err, err)
+			}
+			tokens[name] = tok
+		}
+		jq := jobqueue.NewMemory()
+		defer jq.Close()
+		h := New(noopLogger, noopLogger, jq, authToken, WithGuests(reg), WithJobStatus(jq))
+		get := func(target, token string) int {
+			rec := httptest.NewRecorder()
+			req := httptest.NewRequest(http.MethodGet, target, nil)
+			req.Header.Set("Authorization", "Token "+token)
+			h.ServeHTTP(rec, req)
+			return rec.Code
+		}
+
+		rec := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodPost, "/enqueue?url=spotify:track:1301WleyT98MSxVHPZCA6M", nil)
+		req.Header.Set("Authorization", "Token "+tokens["alice"])
+		h.ServeHTTP(rec, req)
+		if rec.Code != http.StatusAccepted {
+			t.Fatalf("Got %d, expected 202", rec.Code)
+		}
+		var res result
+		if err := json.NewDecoder(rec.Body).Decode(&res); err != nil {
+			t.Fatalf("Got %T (%s), expected nil", err, err)
+		}
+
+		if code := get("/jobs/"+res.ID, tokens["alice"]); code != http.StatusOK {
+			t.Errorf("Got %d, expected 200", code)
+		}
+		if code := get("/jobs/"+res.ID, authToken); code != http.StatusOK {
+			t.Errorf("Got %d, expected 200", code)
+		}
+		// Bob doesn't get to see alice's jobs.
+		if code := get("/jobs/"+res.ID, tokens["bob"]); code != http.StatusNotFound {
+			t.Errorf("Got %d, expected 404", code)
+		}
+	})
+
+	t.Run("Party queue", func(t *testing.T) {
+		pq := partyqueue.New()
+		jq := jobqueue.NewMemory()
+		h := New(noopLogger, noopLogger, pq, authToken, WithPartyQueue(pq), WithJobStatus(jq))
+
+		res := enqueue(t, h, "spotify:track:1301WleyT98MSxVHPZCA6M")
+		if res := status(t, h, res.ID); res.Status != "pending" {
+			t.Errorf("Got %q, expected pending", res.Status)
+		}
+	})
+}
@@ -0,0 +1,181 @@
+package handler
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/epels/sparty/guest"
+	"github.com/epels/sparty/jobqueue"
+)
+
+// Limits keeps guests from flooding the jobqueue. The host is exempt from
+// them. Zero values disable the respective limit.
+type Limits struct {
+	// PerGuest is the maximum number of songs a guest may request within
+	// Window, a rolling time window.
+	PerGuest int
+	Window   time.Duration
+	// MaxPending is the maximum number of songs a guest may have waiting in
+	// the jobqueue, or awaiting approval, at once.
+	MaxPending int
+	// Rate is the maximum number of songs requested per second by all guests
+	// together on average, allowing bursts of up to Burst songs.
+	Rate  float64
+	Burst int
+}
+
+// pendingRetryAfter is what clients are told to wait for when they have too
+// many songs pending: when the worker gets to them is anyone's guess.
+const pendingRetryAfter = 1 * time.Minute
+
+// WithLimits applies l to requests to POST /enqueue. Only songs that are
+// accepted count towards the limits. Limiting the songs pending in the
+// jobqueue requires jq to report them through a method Pending.
+func WithLimits(l Limits) Option {
+	return func(h *handler) {
+		h.limiter = newLimiter(l)
+	}
+}
+
+type pendingLister interface {
+	// Pending returns the jobs that were put but not processed yet.
+	Pending() []jobqueue.Job
+}
+
+// limiter implements Limits. Every guest gets a log of when they requested
+// songs within the window, and all of them share a token bucket.
+type limiter struct {
+	limits Limits
+
+	mu      sync.Mutex
+	history map[string][]time.Time
+	tokens  float64
+	last    time.Time
+}
+
+func newLimiter(l Limits) *limiter {
+	return &limiter{
+		limits:  l,
+		history: make(map[string][]time.Time),
+		tokens:  float64(l.Burst),
+	}
+}
+
+// allow records a song requested by name at now if that is within the limits,
+// and returns 0. Otherwise, it returns how long to wait before trying again.
+func (l *limiter) allow(name string, now time.Time) time.Duration {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.prune(now)
+	hist := l.history[name]
+	if l.limits.PerGuest > 0 && len(hist) >= l.limits.PerGuest {
+		return hist[len(hist)-l.limits.PerGuest].Add(l.limits.Window).Sub(now)
+	}
+	if l.limits.Rate > 0 {
+		if !l.last.IsZero() {
+			l.tokens += now.Sub(l.last).Seconds() * l.limits.Rate
+			if max := float64(l.limits.Burst); l.tokens > max {
+				l.tokens = max
+			}
+		}
+		l.last = now
+		if l.tokens < 1 {
+			return time.Duration((1 - l.tokens) / l.limits.Rate * float64(time.Second))
+		}
+		l.tokens--
+	}
+	if l.limits.PerGuest > 0 {
+		l.history[name] = append(hist, now)
+	}
+	return 0
+}
+
+// refund undoes the song requested by name at t, e.g. because putting it into
+// the jobqueue failed.
+func (l *limiter) refund(name string, t time.Time) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	hist := l.history[name]
+	for i := len(hist) - 1; i >= 0; i-- {
+		if hist[i].Equal(t) {
+			l.history[name] = append(hist[:i:i], hist[i+1:]...)
+			break
+		}
+	}
+	if len(l.history[name]) == 0 {
+		delete(l.history, name)
+	}
+	if l.limits.Rate > 0 {
+		if l.tokens++; l.tokens > float64(l.limits.Burst) {
+			l.tokens = float64(l.limits.Burst)
+		}
+	}
+}
+
+// prune forgets requests that fell out of the window. Callers must hold l.mu.
+func (l *limiter) prune(now time.Time) {
+	cutoff := now.Add(-l.limits.Window)
+	for name, hist := range l.history {
+		i := 0
+		for i < len(hist) && !hist[i].After(cutoff) {
+			i++
+		}
+		if i == len(hist) {
+			delete(l.history, name)
+		} else if i > 0 {
+			l.history[name] = hist[i:]
+		}
+	}
+}
+
+// limited responds with a 429 and returns true if g exceeds the limits.
+// Otherwise, the song g requests is counted towards them and a function to undo
+// that is returned.
+func (h *handler) limited(w http.ResponseWriter, g guest.Guest) (undo func(), limited bool) {
+	if h.limiter == nil || g.Host {
+		return func() {}, false
+	}
+
+	if max := h.limiter.limits.MaxPending; max > 0 {
+		var n int
+		if pl, ok := h.jq.(pendingLister); ok {
+			for _, j := range pl.Pending() {
+				if j.Requester == g.Name {
+					n++
+				}
+			}
+		}
+		if h.moderation != nil {
+			n += h.moderation.count(g.Name)
+		}
+		if n >= max {
+			h.tooManyRequests(w, pendingRetryAfter, fmt.Sprintf("You have %d songs waiting to be queued already", n))
+			return nil, true
+		}
+	}
+	now := h.nowFunc()
+	if d := h.limiter.allow(g.Name, now); d > 0 {
+		h.tooManyRequests(w, d, "You are requesting songs too fast")
+		return nil, true
+	}
+	return func() { h.limiter.refund(g.Name, now) }, false
+}
+
+func (h *handler) tooManyRequests(w http.ResponseWriter, retryAfter time.Duration, msg string) {
+	secs := setRetryAfter(w, retryAfter)
+	w.WriteHeader(http.StatusTooManyRequests)
+	_, _ = fmt.Fprintf(w, "%s, try again in %s\n", msg, time.Duration(secs)*time.Second)
+}
+
+// setRetryAfter sets the Retry-After header to d, rounded up to whole seconds,
+// and returns those seconds.
+func setRetryAfter(w http.ResponseWriter, d time.Duration) int {
+	secs := int((d + time.Second - 1) / time.Second)
+	w.Header().Set("Retry-After", strconv.Itoa(secs))
+	return secs
+}
@@ -0,0 +1,221 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/epels/sparty/guest"
+	"github.com/epels/sparty/internal/mock"
+	"github.com/epels/sparty/jobqueue"
+)
+
+func TestLimiterAllow(t *testing.T) {
+	start := time.Date(2020, 1, 1, 20, 0, 0, 0, time.UTC)
+
+	t.Run("Per guest", func(t *testing.T) {
+		l := newLimiter(Limits{PerGuest: 2, Window: 10 * time.Minute})
+		if d := l.allow("alice", start); d != 0 {
+			t.Errorf("Got %s, expected 0", d)
+		}
+		if d := l.allow("alice", start.Add(time.Minute)); d != 0 {
+			t.Errorf("Got %s, expected 0", d)
+		}
+		if d := l.allow("alice", start.Add(2*time.Minute)); d != 8*time.Minute {
+			t.Errorf("Got %s, expected 8m0s", d)
+		}
+		// Other guests have quotas of their own.
+		if d := l.allow("bob", start.Add(2*time.Minute)); d != 0 {
+			t.Errorf("Got %s, expected 0", d)
+		}
+		// The first request falls out of the window.
+		if d := l.allow("alice", start.Add(10*time.Minute)); d != 0 {
+			t.Errorf("Got %s, expected 0", d)
+		}
+		if d := l.allow("alice", start.Add(10*time.Minute)); d != time.Minute {
+			t.Errorf("Got %s, expected 1m0s", d)
+		}
+	})
+
+	t.Run("Global", func(t *testing.T) {
+		l := newLimiter(Limits{Rate: 0.5, Burst: 2})
+		for i, name := range []string{"alice", "bob"} {
+			if d := l.allow(name, start); d != 0 {
+				t.Errorf("%d: Got %s, expected 0", i, d)
+			}
+		}
+		if d := l.allow("carol", start.Add(time.Second)); d != time.Second {
+			t.Errorf("Got %s, expected 1s", d)
+		}
+		if d := l.allow("carol", start.Add(2*time.Second)); d != 0 {
+			t.Errorf("Got %s, expected 0", d)
+		}
+	})
+
+	t.Run("Rejections do not count", func(t *testing.T) {
+		l := newLimiter(Limits{PerGuest: 1, Window: time.Minute, Rate: 1, Burst: 1})
+		if d := l.allow("alice", start); d != 0 {
+			t.Errorf("Got %s, expected 0", d)
+		}
+		// Rejected by the per guest limit, so no token is taken.
+		if d := l.allow("alice", start.Add(time.Second)); d == 0 {
+			t.Error("Got 0, expected > 0")
+		}
+		if d := l.allow("bob", start.Add(time.Second)); d != 0 {
+			t.Errorf("Got %s, expected 0", d)
+		}
+	})
+
+	t.Run("Refund", func(t *testing.T) {
+		l := newLimiter(Limits{PerGuest: 1, Window: time.Minute, Rate: 0.1, Burst: 1})
+		if d := l.allow("alice", start); d != 0 {
+			t.Errorf("Got %s, expected 0", d)
+		}
+		l.refund("alice", start)
+		if d := l.allow("alice", start.Add(time.Second)); d != 0 {
+			t.Errorf("Got %s, expected 0", d)
+		}
+	})
+}
+
+type pendingJobqueue struct {
+	mock.Jobqueue
+	pending []jobqueue.Job
+}
+
+func (jq pendingJobqueue) Pending() []jobqueue.Job {
+	return jq.pending
+}
+
+func TestLimit(t *testing.T) {
+	noopLogger := log.New(ioutil.Discard, "", 0)
+	noopJobqueue := mock.Jobqueue{
+		PutFunc: func(ctx context.Context, j jobqueue.Job) (string, error) {
+			return "", nil
+		},
+	}
+	enqueue := func(h http.Handler, token string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodPost, "/enqueue?url=spotify:track:1301WleyT98MSxVHPZCA6M", nil)
+		req.Header.Set("Authorization", "Token "+token)
+		h.ServeHTTP(rec, req)
+		return rec
+	}
+
+	t.Run("Per guest", func(t *testing.T) {
+		reg := guest.NewRegistry()
+		_, tok, err := reg.Issue("alice", 0, false)
+		if err != nil {
+			t.Fatalf("Got %T (%s), expected nil", err, err)
+		}
+		now := time.Date(2020, 1, 1, 20, 0, 0, 0, time.UTC)
+		h := New(noopLogger, noopLogger, noopJobqueue, authToken, WithGuests(reg), WithLimits(Limits{PerGuest: 1, Window: time.Hour}))
+		h.nowFunc = func() time.Time { return now }
+
+		if rec := enqueue(h, tok); rec.Code != http.StatusAccepted {
+			t.Errorf("Got %d, expected 202", rec.Code)
+		}
+		now = now.Add(30 * time.Minute)
+		rec := enqueue(h, tok)
+		if rec.Code != http.StatusTooManyRequests {
+			t.Errorf("Got %d, expected 429", rec.Code)
+		}
+		if s := rec.Header().Get("Retry-After"); s != "1800" {
+			t.Errorf("Got %q, expected 1800", s)
+		}
+		// The host is exempt.
+		for i := 0; i < 2; i++ {
+			if rec := enqueue(h, authToken); rec.Code != http.StatusAccepted {
+				t.Errorf("Got %d, expected 202", rec.Code)
+			}
+		}
+	})
+
+	t.Run("Max pending", func(t *testing.T) {
+		reg := guest.NewRegistry()
+		_, tok, err := reg.Issue("alice", 0, false)
+		if err != nil {
+			t.Fatalf("Got %T (%s), expected nil", err, err)
+		}
+		jq := pendingJobqueue{
+			Jobqueue: noopJobqueue,
+			pending: []jobqueue.Job{
+				{URI: "spotify:track:4u7EnebtmKWzUH433cf5Qv", Requester: "alice"},
+				{URI: "spotify:track:1301WleyT98MSxVHPZCA6M", Requester: "bob"},
+			},
+		}
+
+		h := New(noopLogger, noopLogger, jq, authToken, WithGuests(reg), WithLimits(Limits{MaxPending: 2}))
+		if rec := enqueue(h, tok); rec.Code != http.StatusAccepted {
+			t.Errorf("Got %d, expected 202", rec.Code)
+		}
+
+		h = New(noopLogger, noopLogger, jq, authToken, WithGuests(reg), WithLimits(Limits{MaxPending: 1}))
+		rec := enqueue(h, tok)
+		if rec.Code != http.StatusTooManyRequests {
+			t.Errorf("Got %d, expected 429", rec.Code)
+		}
+		if s := rec.Header().Get("Retry-After"); s != "60" {
+			t.Errorf("Got %q, expected 60", s)
+		}
+	})
+
+	t.Run("Awaiting approval", func(t *testing.T) {
+		reg := guest.NewRegistry()
+		_, tok, err := reg.Issue("alice", 0, false)
+		if err != nil {
+			t.Fatalf("Got %T (%s), expected nil", err, err)
+		}
+		h := New(noopLogger, noopLogger, noopJobqueue, authToken, WithGuests(reg), WithModeration(), WithLimits(Limits{MaxPending: 1}))
+
+		if rec := enqueue(h, tok); rec.Code != http.StatusAccepted {
+			t.Errorf("Got %d, expected 202", rec.Code)
+		}
+		if rec := enqueue(h, tok); rec.Code != http.StatusTooManyRequests {
+			t.Errorf("Got %d, expected 429", rec.Code)
+		}
+	})
+
+	t.Run("Only accepted songs count", func(t *testing.T) {
+		reg := guest.NewRegistry()
+		_, tok, err := reg.Issue("alice", 0, false)
+		if err != nil {
+			t.Fatalf("Got %T (%s), expected nil", err, err)
+		}
+		fail := true
+		jq := mock.Jobqueue{
+			PutFunc: func(ctx context.Context, j jobqueue.Job) (string, error) {
+				if fail {
+					return "", errors.New("some error")
+				}
+				return "", nil
+			},
+		}
+		h := New(noopLogger, noopLogger, jq, authToken, WithGuests(reg), WithLimits(Limits{PerGuest: 1, Window: time.Hour, Rate: 0.001, Burst: 1}))
+
+		// Invalid.
+		rec := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodPost, "/enqueue?url=notmatching", nil)
+		req.Header.Set("Authorization", "Token "+tok)
+		h.ServeHTTP(rec, req)
+		if rec.Code != http.StatusBadRequest {
+			t.Errorf("Got %d, expected 400", rec.Code)
+		}
+		// Not put.
+		if rec := enqueue(h, tok); rec.Code != http.StatusInternalServerError {
+			t.Errorf("Got %d, expected 500", rec.Code)
+		}
+		fail = false
+		if rec := enqueue(h, tok); rec.Code != http.StatusAccepted {
+			t.Errorf("Got %d, expected 202", rec.Code)
+		}
+		if rec := enqueue(h, tok); rec.Code != http.StatusTooManyRequests {
+			t.Errorf("Got %d, expected 429", rec.Code)
+		}
+	})
+}
@@ -0,0 +1,207 @@
+package handler
+
+import (
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/epels/sparty/guest"
+	"github.com/epels/sparty/jobqueue"
+)
+
+// maxAwaitingApproval bounds the number of songs awaiting approval, should the
+// host not keep up.
+const maxAwaitingApproval = 500
+
+// WithModeration makes songs requested by guests await the host's approval
+// before they are put into the jobqueue. Songs requested by the host or by
+// trusted guests are approved automatically.
+func WithModeration() Option {
+	return func(h *handler) {
+		h.moderation = &moderation{}
+	}
+}
+
+// approvalRequest is a song awaiting the host's approval.
+type approvalRequest struct {
+	ID          string    `json:"id"`
+	URI         string    `json:"uri"`
+	Requester   string    `json:"requester"`
+	RequestedAt time.Time `json:"requested_at"`
+
+	seq uint64
+}
+
+// moderation holds the songs awaiting approval, oldest first.
+type moderation struct {
+	mu       sync.Mutex
+	nextSeq  uint64
+	requests []approvalRequest
+}
+
+// add adds the song in j, and returns its request, which has the ID of j. It
+// returns false if there are too many songs awaiting approval already.
+func (m *moderation) add(j jobqueue.Job, now time.Time) (approvalRequest, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if len(m.requests) >= maxAwaitingApproval {
+		return approvalRequest{}, false
+	}
+	m.nextSeq++
+	req := approvalRequest{
+		ID:          j.ID,
+		seq:         m.nextSeq,
+		URI:         j.URI,
+		Requester:   j.Requester,
+		RequestedAt: now,
+	}
+	m.requests = append(m.requests, req)
+	return req, true
+}
+
+// take removes the request with the given ID, and returns it.
+func (m *moderation) take(id string) (approvalRequest, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for i, req := range m.requests {
+		if req.ID == id {
+			m.requests = append(m.requests[:i], m.requests[i+1:]...)
+			return req, true
+		}
+	}
+	return approvalRequest{}, false
+}
+
+// putBack puts req back where it was, after it was taken.
+func (m *moderation) putBack(req approvalRequest) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	i := 0
+	for i < len(m.requests) && m.requests[i].seq < req.seq {
+		i++
+	}
+	m.requests = append(m.requests, approvalRequest{})
+	copy(m.requests[i+1:], m.requests[i:])
+	m.requests[i] = req
+}
+
+func (m *moderation) list() []approvalRequest {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return append([]approvalRequest{}, m.requests...)
+}
+
+// count returns the number of songs requested by requester that await approval.
+func (m *moderation) count(requester string) int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var n int
+	for _, req := range m.requests {
+		if req.Requester == requester {
+			n++
+		}
+	}
+	return n
+}
+
+// has reports whether the song uri is awaiting approval.
+func (m *moderation) has(uri string) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, req := range m.requests {
+		if req.URI == uri {
+			return true
+		}
+	}
+	return false
+}
+
+// needsApproval reports whether songs requested by g await approval.
+func (h *handler) needsApproval(g guest.Guest) bool {
+	return h.moderation != nil && !g.Host && !g.Trusted
+}
+
+// park adds the song in j to the songs awaiting approval, and responds with a
+// 202 and the ID of the request. The song keeps this ID in the jobqueue once it
+// is approved, so it can be looked up through GET /jobs/{id} then.
+func (h *handler) park(w http.ResponseWriter, j jobqueue.Job) bool {
+	id, err := jobqueue.NewID()
+	if err != nil {
+		h.errLog.Printf("jobqueue: NewID: %s", err)
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return false
+	}
+	j.ID = id
+	req, ok := h.moderation.add(j, h.nowFunc())
+	if !ok {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		_, _ = fmt.Fprintln(w, "Too many songs are awaiting approval, try again later")
+		return false
+	}
+	h.infoLog.Printf("Song %s requested by %q awaits approval (%s)", req.URI, req.Requester, req.ID)
+	h.writeJSON(w, http.StatusAccepted, struct {
+		ID     string `json:"id"`
+		Status string `json:"status"`
+	}{req.ID, "awaiting_approval"})
+	return true
+}
+
+// approvals lists the songs awaiting approval.
+func (h *handler) approvals(w http.ResponseWriter, r *http.Request) {
+	h.writeJSON(w, http.StatusOK, struct {
+		Requests []approvalRequest `json:"requests"`
+	}{h.moderation.list()})
+}
+
+// approve puts the song awaiting approval with the ID in id into the jobqueue.
+func (h *handler) approve(w http.ResponseWriter, r *http.Request) {
+	req, ok := h.takeApprovalRequest(w, r)
+	if !ok {
+		return
+	}
+	j := jobqueue.Job{ID: req.ID, URI: req.URI, Requester: req.Requester}
+	id, err := h.jq.Put(r.Context(), j)
+	if err != nil {
+		h.moderation.putBack(req)
+		h.errLog.Printf("%T: Put: %s", h.jq, err)
+		h.putError(w, err)
+		return
+	}
+	j.ID = id
+	h.requested(j)
+	h.infoLog.Printf("Approved %s requested by %q (%s)", req.URI, req.Requester, req.ID)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// reject drops the song awaiting approval with the ID in id.
+func (h *handler) reject(w http.ResponseWriter, r *http.Request) {
+	req, ok := h.takeApprovalRequest(w, r)
+	if !ok {
+		return
+	}
+	h.infoLog.Printf("Rejected %s requested by %q (%s)", req.URI, req.Requester, req.ID)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *handler) takeApprovalRequest(w http.ResponseWriter, r *http.Request) (approvalRequest, bool) {
+	id := r.URL.Query().Get("id")
+	if id == "" {
+		w.WriteHeader(http.StatusBadRequest)
+		_, _ = fmt.Fprintln(w, "Missing required parameter: id")
+		return approvalRequest{}, false
+	}
+	req, ok := h.moderation.take(id)
+	if !ok {
+		w.WriteHeader(http.StatusNotFound)
+		_, _ = fmt.Fprintf(w, "No song awaiting approval with id: %s\n", id)
+		return approvalRequest{}, false
+	}
+	return req, true
+}
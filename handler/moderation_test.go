@@ -0,0 +1,223 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/epels/sparty/guest"
+	"github.com/epels/sparty/internal/mock"
+	"github.com/epels/sparty/jobqueue"
+	"github.com/epels/sparty/partyqueue"
+)
+
+func TestModeration(t *testing.T) {
+	noopLogger := log.New(ioutil.Discard, "", 0)
+	do := func(h http.Handler, method, target, token string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		req := httptest.NewRequest(method, target, nil)
+		req.Header.Set("Authorization", "Token "+token)
+		h.ServeHTTP(rec, req)
+		return rec
+	}
+	newGuests := func(t *testing.T) (reg registry, alice, bob string) {
+		t.Helper()
+
+		reg = guest.NewRegistry()
+		_, alice, err := reg.Issue("alice", 0, false)
+		if err != nil {
+			t.Fatalf("Got %T (%s), expected nil", err, err)
+		}
+		_, bob, err = reg.Issue("bob", 0, true)
+		if err != nil {
+			t.Fatalf("Got %T (%s), expected nil", err, err)
+		}
+		return reg, alice, bob
+	}
+	enqueue := func(t *testing.T, h http.Handler, uri, token string) string {
+		t.Helper()
+
+		rec := do(h, http.MethodPost, "/enqueue?url="+uri, token)
+		if rec.Code != http.StatusAccepted {
+			t.Fatalf("Got %d, expected 202", rec.Code)
+		}
+		var res struct {
+			ID string `json:"id"`
+		}
+		if err := json.NewDecoder(rec.Body).Decode(&res); err != nil {
+			t.Fatalf("Got %T (%s), expected nil", err, err)
+		}
+		return res.ID
+	}
+
+	t.Run("Approve", func(t *testing.T) {
+		reg, alice, _ := newGuests(t)
+		var put []jobqueue.Job
+		jq := mock.Jobqueue{
+			PutFunc: func(ctx context.Context, j jobqueue.Job) (string, error) {
+				put = append(put, j)
+				return "", nil
+			},
+		}
+		h := New(noopLogger, noopLogger, jq, authToken, WithGuests(reg), WithModeration())
+
+		rec := do(h, http.MethodPost, "/enqueue?url=spotify:track:1301WleyT98MSxVHPZCA6M", alice)
+		if rec.Code != http.StatusAccepted {
+			t.Fatalf("Got %d, expected 202", rec.Code)
+		}
+		var res struct {
+			ID     string `json:"id"`
+			Status string `json:"status"`
+		}
+		if err := json.NewDecoder(rec.Body).Decode(&res); err != nil {
+			t.Fatalf("Got %T (%s), expected nil", err, err)
+		}
+		if res.Status != "awaiting_approval" {
+			t.Errorf("Got %q, expected awaiting_approval", res.Status)
+		}
+		if len(put) != 0 {
+			t.Errorf("Got %v, expected no jobs", put)
+		}
+
+		// Guests may not see the songs awaiting approval.
+		if rec := do(h, http.MethodGet, "/approvals", alice); rec.Code != http.StatusForbidden {
+			t.Errorf("Got %d, expected 403", rec.Code)
+		}
+		rec = do(h, http.MethodGet, "/approvals", authToken)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("Got %d, expected 200", rec.Code)
+		}
+		var list struct {
+			Requests []approvalRequest `json:"requests"`
+		}
+		if err := json.NewDecoder(rec.Body).Decode(&list); err != nil {
+			t.Fatalf("Got %T (%s), expected nil", err, err)
+		}
+		if len(list.Requests) != 1 || list.Requests[0].ID != res.ID || list.Requests[0].Requester != "alice" {
+			t.Errorf("Got %+v, expected request %s by alice", list.Requests, res.ID)
+		}
+
+		if rec := do(h, http.MethodPost, "/approvals/approve?id="+res.ID, authToken); rec.Code != http.StatusNoContent {
+			t.Errorf("Got %d, expected 204", rec.Code)
+		}
+		if len(put) != 1 || put[0] != (jobqueue.Job{ID: res.ID, URI: "spotify:track:1301WleyT98MSxVHPZCA6M", Requester: "alice"}) {
+			t.Errorf("Got %v, expected the song requested by alice", put)
+		}
+		if rec := do(h, http.MethodPost, "/approvals/approve?id="+res.ID, authToken); rec.Code != http.StatusNotFound {
+			t.Errorf("Got %d, expected 404", rec.Code)
+		}
+	})
+
+	t.Run("Reject", func(t *testing.T) {
+		reg, alice, _ := newGuests(t)
+		jq := mock.Jobqueue{
+			PutFunc: func(ctx context.Context, j jobqueue.Job) (string, error) {
+				t.Error("Unexpected call to Put")
+				return "", nil
+			},
+		}
+		h := New(noopLogger, noopLogger, jq, authToken, WithGuests(reg), WithModeration())
+
+		id := enqueue(t, h, "spotify:track:1301WleyT98MSxVHPZCA6M", alice)
+		if rec := do(h, http.MethodPost, "/approvals/reject?id="+id, authToken); rec.Code != http.StatusNoContent {
+			t.Errorf("Got %d, expected 204", rec.Code)
+		}
+		if l := h.moderation.list(); len(l) != 0 {
+			t.Errorf("Got %v, expected none", l)
+		}
+	})
+
+	t.Run("Auto-approve", func(t *testing.T) {
+		reg, _, bob := newGuests(t)
+		var n int
+		jq := mock.Jobqueue{
+			PutFunc: func(ctx context.Context, j jobqueue.Job) (string, error) {
+				n++
+				return "", nil
+			},
+		}
+		h := New(noopLogger, noopLogger, jq, authToken, WithGuests(reg), WithModeration())
+
+		if rec := do(h, http.MethodPost, "/enqueue?url=spotify:track:1301WleyT98MSxVHPZCA6M", bob); rec.Code != http.StatusAccepted {
+			t.Errorf("Got %d, expected 202", rec.Code)
+		}
+		if rec := do(h, http.MethodPost, "/enqueue?url=spotify:track:4u7EnebtmKWzUH433cf5Qv", authToken); rec.Code != http.StatusAccepted {
+			t.Errorf("Got %d, expected 202", rec.Code)
+		}
+		if n != 2 {
+			t.Errorf("Got %d, expected 2", n)
+		}
+	})
+
+	t.Run("Approve failed", func(t *testing.T) {
+		reg, alice, _ := newGuests(t)
+		jq := mock.Jobqueue{
+			PutFunc: func(ctx context.Context, j jobqueue.Job) (string, error) {
+				return "", errors.New("some error")
+			},
+		}
+		h := New(noopLogger, noopLogger, jq, authToken, WithGuests(reg), WithModeration())
+
+		first := enqueue(t, h, "spotify:track:1301WleyT98MSxVHPZCA6M", alice)
+		second := enqueue(t, h, "spotify:track:4u7EnebtmKWzUH433cf5Qv", alice)
+		if rec := do(h, http.MethodPost, "/approvals/approve?id="+first, authToken); rec.Code != http.StatusInternalServerError {
+			t.Errorf("Got %d, expected 500", rec.Code)
+		}
+		// It is still awaiting approval, in its original place.
+		if l := h.moderation.list(); len(l) != 2 || l[0].ID != first || l[1].ID != second {
+			t.Errorf("Got %v, expected %s and %s", l, first, second)
+		}
+	})
+
+	t.Run("Job status", func(t *testing.T) {
+		reg, alice, _ := newGuests(t)
+		jq := jobqueue.NewMemory()
+		defer jq.Close()
+		h := New(noopLogger, noopLogger, jq, authToken, WithGuests(reg), WithModeration(), WithJobStatus(jq))
+
+		id := enqueue(t, h, "spotify:track:1301WleyT98MSxVHPZCA6M", alice)
+		if rec := do(h, http.MethodPost, "/approvals/approve?id="+id, authToken); rec.Code != http.StatusNoContent {
+			t.Fatalf("Got %d, expected 204", rec.Code)
+		}
+		// The song is known to the jobqueue by the ID the guest got.
+		rec := do(h, http.MethodGet, "/jobs/"+id, alice)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("Got %d, expected 200", rec.Code)
+		}
+		var res struct {
+			ID     string `json:"id"`
+			Status string `json:"status"`
+		}
+		if err := json.NewDecoder(rec.Body).Decode(&res); err != nil {
+			t.Fatalf("Got %T (%s), expected nil", err, err)
+		}
+		if res.ID != id || res.Status != "pending" {
+			t.Errorf("Got %+v, expected %s pending", res, id)
+		}
+	})
+
+	t.Run("Party queue", func(t *testing.T) {
+		reg, alice, _ := newGuests(t)
+		pq := partyqueue.New()
+		jq := jobqueue.NewMemory()
+		defer jq.Close()
+		h := New(noopLogger, noopLogger, pq, authToken, WithGuests(reg), WithModeration(), WithPartyQueue(pq), WithJobStatus(jq))
+
+		id := enqueue(t, h, "spotify:track:1301WleyT98MSxVHPZCA6M", alice)
+		if rec := do(h, http.MethodPost, "/approvals/approve?id="+id, authToken); rec.Code != http.StatusNoContent {
+			t.Fatalf("Got %d, expected 204", rec.Code)
+		}
+		// The song waits in the party queue by the ID the guest got.
+		if items := pq.Items(); len(items) != 1 || items[0].ID != id {
+			t.Errorf("Got %+v, expected %s", items, id)
+		}
+		if rec := do(h, http.MethodGet, "/jobs/"+id, alice); rec.Code != http.StatusOK {
+			t.Errorf("Got %d, expected 200", rec.Code)
+		}
+	})
+}
@@ -0,0 +1,178 @@
+package handler
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/epels/sparty/events"
+	"github.com/epels/sparty/jobqueue"
+	"github.com/epels/sparty/spotify"
+)
+
+type nowPlayer interface {
+	// CurrentlyPlaying returns what is playing, or nil if nothing is.
+	CurrentlyPlaying(ctx context.Context) (*spotify.CurrentlyPlaying, error)
+	Queue(ctx context.Context) (*spotify.Queue, error)
+}
+
+// maxRequesters caps the number of songs whose requester is remembered, so it
+// is not kept forever.
+const maxRequesters = 1000
+
+// WithNowPlaying lets guests see what is playing through GET /now-playing, and
+// what is up next through GET /queue. Responses from p are cached for ttl, so
+// many guests polling don't hammer the Spotify Web API.
+func WithNowPlaying(p nowPlayer, ttl time.Duration) Option {
+	return func(h *handler) {
+		h.nowPlaying = &nowPlaying{p: p, ttl: ttl}
+		h.requesters = &requesters{names: make(map[string]string)}
+	}
+}
+
+// nowPlaying caches what is playing and what is up next.
+type nowPlaying struct {
+	p   nowPlayer
+	ttl time.Duration
+
+	// mu is held while fetching from p, so concurrent requests for a stale
+	// cache share a single request to the Spotify Web API.
+	mu   sync.Mutex
+	cp   *spotify.CurrentlyPlaying
+	cpAt time.Time
+	q    *spotify.Queue
+	qAt  time.Time
+}
+
+// currentlyPlaying returns what is playing, and when that was fetched.
+func (np *nowPlaying) currentlyPlaying(ctx context.Context, now time.Time) (*spotify.CurrentlyPlaying, time.Time, error) {
+	np.mu.Lock()
+	defer np.mu.Unlock()
+
+	if np.cpAt.IsZero() || now.Sub(np.cpAt) >= np.ttl {
+		cp, err := np.p.CurrentlyPlaying(ctx)
+		if err != nil {
+			return nil, time.Time{}, err
+		}
+		np.cp, np.cpAt = cp, now
+	}
+	return np.cp, np.cpAt, nil
+}
+
+func (np *nowPlaying) queue(ctx context.Context, now time.Time) (*spotify.Queue, error) {
+	np.mu.Lock()
+	defer np.mu.Unlock()
+
+	if np.qAt.IsZero() || now.Sub(np.qAt) >= np.ttl {
+		q, err := np.p.Queue(ctx)
+		if err != nil {
+			return nil, err
+		}
+		np.q, np.qAt = q, now
+	}
+	return np.q, nil
+}
+
+// requesters remembers who requested the songs put into the jobqueue most
+// recently, by URI.
+type requesters struct {
+	mu    sync.Mutex
+	names map[string]string
+	order []string
+}
+
+func (rs *requesters) add(j jobqueue.Job) {
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
+
+	if _, ok := rs.names[j.URI]; !ok {
+		rs.order = append(rs.order, j.URI)
+	}
+	rs.names[j.URI] = j.Requester
+	for len(rs.order) > maxRequesters {
+		delete(rs.names, rs.order[0])
+		rs.order = rs.order[1:]
+	}
+}
+
+func (rs *requesters) get(uri string) string {
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
+
+	return rs.names[uri]
+}
+
+// requested records who requested the song in j, once it was put into the
+// jobqueue, and publishes that it was.
+func (h *handler) requested(j jobqueue.Job) {
+	if h.requesters != nil {
+		h.requesters.add(j)
+	}
+	h.publish(events.SongRequested, events.Song{URI: j.URI, Requester: j.Requester})
+}
+
+// newRequestedTrack is like newTrack, but includes who requested t if known.
+func (h *handler) newRequestedTrack(t spotify.Track) track {
+	tr := newTrack(t)
+	tr.Requester = h.requesters.get(t.URI)
+	return tr
+}
+
+// nowPlayingHandler responds with the track that is playing, if any, and how
+// far along it is.
+func (h *handler) nowPlayingHandler(w http.ResponseWriter, r *http.Request) {
+	now := h.nowFunc()
+	cp, at, err := h.nowPlaying.currentlyPlaying(r.Context(), now)
+	if err != nil {
+		h.errLog.Printf("%T: CurrentlyPlaying: %s", h.nowPlaying.p, err)
+		h.upstreamError(w, err)
+		return
+	}
+
+	res := struct {
+		IsPlaying  bool   `json:"is_playing"`
+		ProgressMS int    `json:"progress_ms"`
+		Track      *track `json:"track"`
+	}{}
+	if cp != nil && cp.Item != nil {
+		res.IsPlaying = cp.IsPlaying
+		res.ProgressMS = cp.ProgressMS
+		if cp.IsPlaying {
+			// Account for the time the response was cached.
+			res.ProgressMS += int(now.Sub(at) / time.Millisecond)
+			if res.ProgressMS > cp.Item.DurationMS {
+				res.ProgressMS = cp.Item.DurationMS
+			}
+		}
+		t := h.newRequestedTrack(*cp.Item)
+		res.Track = &t
+	}
+	h.writeJSON(w, http.StatusOK, res)
+}
+
+// queueHandler responds with the track that is playing, if any, and the tracks
+// up next in Spotify's queue.
+func (h *handler) queueHandler(w http.ResponseWriter, r *http.Request) {
+	q, err := h.nowPlaying.queue(r.Context(), h.nowFunc())
+	if err != nil {
+		h.errLog.Printf("%T: Queue: %s", h.nowPlaying.p, err)
+		h.upstreamError(w, err)
+		return
+	}
+
+	res := struct {
+		CurrentlyPlaying *track  `json:"currently_playing"`
+		Queue            []track `json:"queue"`
+	}{
+		Queue: make([]track, 0, len(q.Queue)),
+	}
+	if q.CurrentlyPlaying != nil {
+		t := h.newRequestedTrack(*q.CurrentlyPlaying)
+		res.CurrentlyPlaying = &t
+	}
+	for _, t := range q.Queue {
+		res.Queue = append(res.Queue, h.newRequestedTrack(t))
+	}
+	h.writeJSON(w, http.StatusOK, res)
+}
@@ -0,0 +1,232 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/epels/sparty/guest"
+	"github.com/epels/sparty/internal/mock"
+	"github.com/epels/sparty/jobqueue"
+	"github.com/epels/sparty/spotify"
+)
+
+func TestNowPlaying(t *testing.T) {
+	noopLogger := log.New(ioutil.Discard, "", 0)
+	noopJobqueue := mock.Jobqueue{
+		PutFunc: func(ctx context.Context, j jobqueue.Job) (string, error) {
+			return "", nil
+		},
+	}
+	bohemianRhapsody := spotify.Track{
+		ID:         "4u7EnebtmKWzUH433cf5Qv",
+		URI:        "spotify:track:4u7EnebtmKWzUH433cf5Qv",
+		Name:       "Bohemian Rhapsody",
+		DurationMS: 354000,
+		Artists:    []spotify.Artist{{Name: "Queen"}},
+		Album: spotify.Album{
+			Name:   "A Night At The Opera",
+			Images: []spotify.Image{{URL: "https://i.scdn.co/image/large"}, {URL: "https://i.scdn.co/image/small"}},
+		},
+	}
+	type result struct {
+		IsPlaying  bool   `json:"is_playing"`
+		ProgressMS int    `json:"progress_ms"`
+		Track      *track `json:"track"`
+	}
+	get := func(t *testing.T, h http.Handler) result {
+		t.Helper()
+
+		rec := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodGet, "/now-playing", nil)
+		req.Header.Set("Authorization", "Token secret")
+		h.ServeHTTP(rec, req)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("Got %d, expected 200", rec.Code)
+		}
+		var res result
+		if err := json.NewDecoder(rec.Body).Decode(&res); err != nil {
+			t.Fatalf("Got %T (%s), expected nil", err, err)
+		}
+		return res
+	}
+
+	t.Run("Playing", func(t *testing.T) {
+		var calls int
+		p := mock.Player{
+			CurrentlyPlayingFunc: func(ctx context.Context) (*spotify.CurrentlyPlaying, error) {
+				calls++
+				return &spotify.CurrentlyPlaying{IsPlaying: true, ProgressMS: 1000, Item: &bohemianRhapsody}, nil
+			},
+		}
+		h := New(noopLogger, noopLogger, noopJobqueue, "secret", WithNowPlaying(p, 5*time.Second))
+		now := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+		h.nowFunc = func() time.Time {
+			return now
+		}
+
+		// Enqueue the track, so its requester is known.
+		rec := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodPost, "/enqueue?url="+bohemianRhapsody.URI, nil)
+		req.Header.Set("Authorization", "Token secret")
+		h.ServeHTTP(rec, req)
+		if rec.Code != http.StatusAccepted {
+			t.Fatalf("Got %d, expected 202", rec.Code)
+		}
+
+		res := get(t, h)
+		if !res.IsPlaying {
+			t.Error("Got false, expected true")
+		}
+		if res.ProgressMS != 1000 {
+			t.Errorf("Got %d, expected 1000", res.ProgressMS)
+		}
+		if res.Track == nil {
+			t.Fatal("Got nil, expected track")
+		}
+		if res.Track.Name != "Bohemian Rhapsody" {
+			t.Errorf("Got %q, expected Bohemian Rhapsody", res.Track.Name)
+		}
+		if len(res.Track.Artists) != 1 || res.Track.Artists[0] != "Queen" {
+			t.Errorf("Got %v, expected [Queen]", res.Track.Artists)
+		}
+		if res.Track.AlbumArtURL != "https://i.scdn.co/image/large" {
+			t.Errorf("Got %q, expected https://i.scdn.co/image/large", res.Track.AlbumArtURL)
+		}
+		if res.Track.Requester != "host" {
+			t.Errorf("Got %q, expected host", res.Track.Requester)
+		}
+
+		// Within the TTL, the cached response is used, and the progress
+		// accounts for the time passed.
+		now = now.Add(2 * time.Second)
+		if res := get(t, h); res.ProgressMS != 3000 {
+			t.Errorf("Got %d, expected 3000", res.ProgressMS)
+		}
+		if calls != 1 {
+			t.Errorf("Got %d, expected 1", calls)
+		}
+
+		now = now.Add(3 * time.Second)
+		get(t, h)
+		if calls != 2 {
+			t.Errorf("Got %d, expected 2", calls)
+		}
+	})
+
+	t.Run("Nothing playing", func(t *testing.T) {
+		p := mock.Player{
+			CurrentlyPlayingFunc: func(ctx context.Context) (*spotify.CurrentlyPlaying, error) {
+				return nil, nil
+			},
+		}
+		h := New(noopLogger, noopLogger, noopJobqueue, "secret", WithNowPlaying(p, 5*time.Second))
+
+		res := get(t, h)
+		if res.IsPlaying {
+			t.Error("Got true, expected false")
+		}
+		if res.Track != nil {
+			t.Errorf("Got %+v, expected nil", res.Track)
+		}
+	})
+
+	t.Run("Upstream error", func(t *testing.T) {
+		var calls int
+		p := mock.Player{
+			CurrentlyPlayingFunc: func(ctx context.Context) (*spotify.CurrentlyPlaying, error) {
+				calls++
+				return nil, errors.New("some error")
+			},
+		}
+		h := New(noopLogger, noopLogger, noopJobqueue, "secret", WithNowPlaying(p, 5*time.Second))
+
+		for i := 0; i < 2; i++ {
+			rec := httptest.NewRecorder()
+			req := httptest.NewRequest(http.MethodGet, "/now-playing", nil)
+			req.Header.Set("Authorization", "Token secret")
+			h.ServeHTTP(rec, req)
+			if rec.Code != http.StatusBadGateway {
+				t.Errorf("Got %d, expected 502", rec.Code)
+			}
+		}
+		// Errors are not cached.
+		if calls != 2 {
+			t.Errorf("Got %d, expected 2", calls)
+		}
+	})
+}
+
+func TestQueue(t *testing.T) {
+	noopLogger := log.New(ioutil.Discard, "", 0)
+	noopJobqueue := mock.Jobqueue{
+		PutFunc: func(ctx context.Context, j jobqueue.Job) (string, error) {
+			return "", nil
+		},
+	}
+	reg := guest.NewRegistry()
+	_, tok, err := reg.Issue("alice", 0, false)
+	if err != nil {
+		t.Fatalf("Got %T (%s), expected nil", err, err)
+	}
+	var calls int
+	p := mock.Player{
+		QueueFunc: func(ctx context.Context) (*spotify.Queue, error) {
+			calls++
+			return &spotify.Queue{
+				CurrentlyPlaying: &spotify.Track{URI: "spotify:track:4u7EnebtmKWzUH433cf5Qv", Name: "Bohemian Rhapsody"},
+				Queue: []spotify.Track{
+					{URI: "spotify:track:1301WleyT98MSxVHPZCA6M", Name: "Mr. Brightside"},
+					{URI: "spotify:track:7qiZfU4dY1lWllzX7mPBI3", Name: "Shape of You"},
+				},
+			}, nil
+		},
+	}
+	h := New(noopLogger, noopLogger, noopJobqueue, "secret", WithGuests(reg), WithNowPlaying(p, 5*time.Second))
+
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodPost, "/enqueue?url=spotify:track:1301WleyT98MSxVHPZCA6M", nil)
+	req.Header.Set("Authorization", "Token "+tok)
+	h.ServeHTTP(rec, req)
+	if rec.Code != http.StatusAccepted {
+		t.Fatalf("Got %d, expected 202", rec.Code)
+	}
+
+	var res struct {
+		CurrentlyPlaying *track  `json:"currently_playing"`
+		Queue            []track `json:"queue"`
+	}
+	for i := 0; i < 2; i++ {
+		rec = httptest.NewRecorder()
+		req = httptest.NewRequest(http.MethodGet, "/queue", nil)
+		req.Header.Set("Authorization", "Token "+tok)
+		h.ServeHTTP(rec, req)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("Got %d, expected 200", rec.Code)
+		}
+		if err := json.NewDecoder(rec.Body).Decode(&res); err != nil {
+			t.Fatalf("Got %T (%s), expected nil", err, err)
+		}
+	}
+	if calls != 1 {
+		t.Errorf("Got %d, expected 1", calls)
+	}
+	if res.CurrentlyPlaying == nil || res.CurrentlyPlaying.Name != "Bohemian Rhapsody" {
+		t.Errorf("Got %+v, expected Bohemian Rhapsody", res.CurrentlyPlaying)
+	}
+	if len(res.Queue) != 2 {
+		t.Fatalf("Got %d, expected 2", len(res.Queue))
+	}
+	if res.Queue[0].Requester != "alice" {
+		t.Errorf("Got %q, expected alice", res.Queue[0].Requester)
+	}
+	if res.Queue[1].Requester != "" {
+		t.Errorf("Got %q, expected no requester", res.Queue[1].Requester)
+	}
+}
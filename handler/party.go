@@ -0,0 +1,72 @@
+package handler
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/epels/sparty/guest"
+	"github.com/epels/sparty/partyqueue"
+)
+
+type partyQueue interface {
+	// Items returns the songs in the party queue, in the order they will be
+	// played.
+	Items() []partyqueue.Item
+	Vote(id, voter string, vote int) error
+}
+
+// votes maps the values of the vote parameter to votes.
+var votes = map[string]int{
+	"up":   partyqueue.Up,
+	"down": partyqueue.Down,
+	"none": partyqueue.None,
+}
+
+// WithPartyQueue lets guests vote on the songs in pq through the /party
+// endpoints. Pq should be the jobqueue passed to New as well: since songs in a
+// party queue are played one by one, only tracks can be requested.
+func WithPartyQueue(pq partyQueue) Option {
+	return func(h *handler) {
+		h.party = pq
+	}
+}
+
+// partyItems lists the songs in the party queue, in the order they will be
+// played.
+func (h *handler) partyItems(w http.ResponseWriter, r *http.Request) {
+	h.writeJSON(w, http.StatusOK, struct {
+		Items []partyqueue.Item `json:"items"`
+	}{h.party.Items()})
+}
+
+// vote casts the caller's vote in vote (up, down or none to withdraw it) on the
+// song in the party queue with the ID in id.
+func (h *handler) vote(w http.ResponseWriter, r *http.Request) {
+	id := r.URL.Query().Get("id")
+	if id == "" {
+		w.WriteHeader(http.StatusBadRequest)
+		_, _ = fmt.Fprintln(w, "Missing required parameter: id")
+		return
+	}
+	v := r.URL.Query().Get("vote")
+	vote, ok := votes[v]
+	if !ok {
+		w.WriteHeader(http.StatusBadRequest)
+		_, _ = fmt.Fprintf(w, "Invalid value for parameter: vote (%s): must be up, down or none\n", v)
+		return
+	}
+
+	g, _ := guest.FromContext(r.Context())
+	if err := h.party.Vote(id, g.Name, vote); err != nil {
+		if errors.Is(err, partyqueue.ErrNotFound) {
+			w.WriteHeader(http.StatusNotFound)
+			_, _ = fmt.Fprintf(w, "No song in the party queue with id: %s\n", id)
+			return
+		}
+		h.errLog.Printf("%T: Vote: %s", h.party, err)
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,84 @@
+package handler
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/epels/sparty/guest"
+	"github.com/epels/sparty/partyqueue"
+)
+
+func TestParty(t *testing.T) {
+	noopLogger := log.New(ioutil.Discard, "", 0)
+	do := func(h http.Handler, method, target, token string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		req := httptest.NewRequest(method, target, nil)
+		req.Header.Set("Authorization", "Token "+token)
+		h.ServeHTTP(rec, req)
+		return rec
+	}
+	reg := guest.NewRegistry()
+	_, alice, err := reg.Issue("alice", 0, false)
+	if err != nil {
+		t.Fatalf("Got %T (%s), expected nil", err, err)
+	}
+
+	pq := partyqueue.New()
+	h := New(noopLogger, noopLogger, pq, authToken, WithGuests(reg), WithPartyQueue(pq))
+	for _, uri := range []string{"spotify:track:1301WleyT98MSxVHPZCA6M", "spotify:track:4u7EnebtmKWzUH433cf5Qv"} {
+		if rec := do(h, http.MethodPost, "/enqueue?url="+uri, alice); rec.Code != http.StatusAccepted {
+			t.Fatalf("Got %d, expected 202", rec.Code)
+		}
+	}
+
+	t.Run("Album", func(t *testing.T) {
+		if rec := do(h, http.MethodPost, "/enqueue?url=spotify:album:1GbtB4zTqAsyfZEsm1RZfx", alice); rec.Code != http.StatusBadRequest {
+			t.Errorf("Got %d, expected 400", rec.Code)
+		}
+	})
+
+	items := pq.Items()
+	if len(items) != 2 {
+		t.Fatalf("Got %d, expected 2", len(items))
+	}
+	second := items[1].ID
+
+	t.Run("Vote", func(t *testing.T) {
+		if rec := do(h, http.MethodPost, "/party/vote?id="+second+"&vote=up", alice); rec.Code != http.StatusNoContent {
+			t.Errorf("Got %d, expected 204", rec.Code)
+		}
+
+		rec := do(h, http.MethodGet, "/party", alice)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("Got %d, expected 200", rec.Code)
+		}
+		var res struct {
+			Items []partyqueue.Item `json:"items"`
+		}
+		if err := json.NewDecoder(rec.Body).Decode(&res); err != nil {
+			t.Fatalf("Got %T (%s), expected nil", err, err)
+		}
+		if len(res.Items) != 2 {
+			t.Fatalf("Got %d, expected 2", len(res.Items))
+		}
+		if it := res.Items[0]; it.URI != "spotify:track:4u7EnebtmKWzUH433cf5Qv" || it.Score != 1 || it.Requester != "alice" {
+			t.Errorf("Got %+v, expected spotify:track:4u7EnebtmKWzUH433cf5Qv with score 1", it)
+		}
+	})
+
+	t.Run("Invalid vote", func(t *testing.T) {
+		if rec := do(h, http.MethodPost, "/party/vote?id="+second+"&vote=sideways", alice); rec.Code != http.StatusBadRequest {
+			t.Errorf("Got %d, expected 400", rec.Code)
+		}
+	})
+
+	t.Run("Not found", func(t *testing.T) {
+		if rec := do(h, http.MethodPost, "/party/vote?id=foo&vote=up", alice); rec.Code != http.StatusNotFound {
+			t.Errorf("Got %d, expected 404", rec.Code)
+		}
+	})
+}
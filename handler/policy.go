@@ -0,0 +1,52 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/epels/sparty/policy"
+	"github.com/epels/sparty/spotify"
+)
+
+type checker interface {
+	// Check returns a *policy.Violation if the song uri refers to may not be
+	// played.
+	Check(ctx context.Context, uri string) error
+}
+
+// WithPolicy rejects requests for songs that c does not allow with a 422.
+func WithPolicy(c checker) Option {
+	return func(h *handler) {
+		h.policy = c
+	}
+}
+
+// allowed checks the song uri against the policy. If it may not be played, it
+// responds accordingly and returns false.
+func (h *handler) allowed(w http.ResponseWriter, r *http.Request, uri string) bool {
+	if h.policy == nil {
+		return true
+	}
+	err := h.policy.Check(r.Context(), uri)
+	if err == nil {
+		return true
+	}
+
+	var v *policy.Violation
+	switch {
+	case errors.As(err, &v):
+		h.writeJSON(w, http.StatusUnprocessableEntity, struct {
+			Error string `json:"error"`
+			Rule  string `json:"rule"`
+		}{fmt.Sprintf("This song is not allowed: %s", v.Reason), v.Rule})
+	case errors.Is(err, spotify.ErrNotFound):
+		w.WriteHeader(http.StatusBadRequest)
+		_, _ = fmt.Fprintf(w, "No such track: %s\n", uri)
+	default:
+		h.errLog.Printf("%T: Check: %s", h.policy, err)
+		h.upstreamError(w, err)
+	}
+	return false
+}
@@ -0,0 +1,106 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/epels/sparty/internal/mock"
+	"github.com/epels/sparty/jobqueue"
+	"github.com/epels/sparty/policy"
+	"github.com/epels/sparty/spotify"
+)
+
+func TestEnqueuePolicy(t *testing.T) {
+	noopLogger := log.New(ioutil.Discard, "", 0)
+	enqueue := func(h http.Handler) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodPost, "/enqueue?url=spotify:track:1301WleyT98MSxVHPZCA6M", nil)
+		setAuth(t, req)
+		h.ServeHTTP(rec, req)
+		return rec
+	}
+
+	t.Run("Allowed", func(t *testing.T) {
+		var called bool
+		jq := mock.Jobqueue{
+			PutFunc: func(ctx context.Context, j jobqueue.Job) (string, error) {
+				called = true
+				return "", nil
+			},
+		}
+		c := mock.Checker{
+			CheckFunc: func(ctx context.Context, uri string) error {
+				if uri != "spotify:track:1301WleyT98MSxVHPZCA6M" {
+					t.Errorf("Got %q, expected spotify:track:1301WleyT98MSxVHPZCA6M", uri)
+				}
+				return nil
+			},
+		}
+		if rec := enqueue(New(noopLogger, noopLogger, jq, authToken, WithPolicy(c))); rec.Code != http.StatusAccepted {
+			t.Errorf("Got %d, expected 202", rec.Code)
+		}
+		if !called {
+			t.Error("Got false, expected true")
+		}
+	})
+
+	jq := mock.Jobqueue{
+		PutFunc: func(ctx context.Context, j jobqueue.Job) (string, error) {
+			t.Error("Unexpected call to Put")
+			return "", nil
+		},
+	}
+
+	t.Run("Violation", func(t *testing.T) {
+		c := mock.Checker{
+			CheckFunc: func(ctx context.Context, uri string) error {
+				return &policy.Violation{Rule: policy.RuleExplicit, Reason: "explicit tracks are not allowed"}
+			},
+		}
+		rec := enqueue(New(noopLogger, noopLogger, jq, authToken, WithPolicy(c)))
+		if rec.Code != http.StatusUnprocessableEntity {
+			t.Errorf("Got %d, expected 422", rec.Code)
+		}
+		var res struct {
+			Error string `json:"error"`
+			Rule  string `json:"rule"`
+		}
+		if err := json.NewDecoder(rec.Body).Decode(&res); err != nil {
+			t.Fatalf("Got %T (%s), expected nil", err, err)
+		}
+		if res.Rule != policy.RuleExplicit {
+			t.Errorf("Got %q, expected %q", res.Rule, policy.RuleExplicit)
+		}
+		if res.Error != "This song is not allowed: explicit tracks are not allowed" {
+			t.Errorf("Got %q", res.Error)
+		}
+	})
+
+	t.Run("Not found", func(t *testing.T) {
+		c := mock.Checker{
+			CheckFunc: func(ctx context.Context, uri string) error {
+				return spotify.ErrNotFound
+			},
+		}
+		if rec := enqueue(New(noopLogger, noopLogger, jq, authToken, WithPolicy(c))); rec.Code != http.StatusBadRequest {
+			t.Errorf("Got %d, expected 400", rec.Code)
+		}
+	})
+
+	t.Run("Upstream error", func(t *testing.T) {
+		c := mock.Checker{
+			CheckFunc: func(ctx context.Context, uri string) error {
+				return errors.New("some error")
+			},
+		}
+		if rec := enqueue(New(noopLogger, noopLogger, jq, authToken, WithPolicy(c))); rec.Code != http.StatusBadGateway {
+			t.Errorf("Got %d, expected 502", rec.Code)
+		}
+	})
+}
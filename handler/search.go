@@ -0,0 +1,136 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/epels/sparty/spotify"
+)
+
+type searcher interface {
+	// Search searches Spotify for tracks matching query, optionally limited to
+	// those playable in market.
+	Search(ctx context.Context, query, market string, limit int) ([]spotify.Track, error)
+}
+
+// track is the JSON representation of a Spotify track in API responses.
+type track struct {
+	URI         string   `json:"uri"`
+	Name        string   `json:"name"`
+	Artists     []string `json:"artists"`
+	Album       string   `json:"album"`
+	AlbumArtURL string   `json:"album_art_url,omitempty"`
+	DurationMS  int      `json:"duration_ms"`
+	// Requester is the name of the guest who requested the track, if known.
+	Requester string `json:"requester,omitempty"`
+}
+
+const (
+	defaultSearchLimit = 5
+	maxSearchLimit     = 20
+)
+
+// WithSearcher enables searching Spotify: both the GET /search endpoint and
+// enqueueing the top hit for a query through POST /enqueue?q=... Market is
+// passed on to s as is.
+func WithSearcher(s searcher, market string) Option {
+	return func(h *handler) {
+		h.searcher = s
+		h.market = market
+	}
+}
+
+func newTrack(t spotify.Track) track {
+	artists := make([]string, 0, len(t.Artists))
+	for _, a := range t.Artists {
+		artists = append(artists, a.Name)
+	}
+	tr := track{
+		URI:        t.URI,
+		Name:       t.Name,
+		Artists:    artists,
+		Album:      t.Album.Name,
+		DurationMS: t.DurationMS,
+	}
+	if len(t.Album.Images) > 0 {
+		tr.AlbumArtURL = t.Album.Images[0].URL
+	}
+	return tr
+}
+
+// search responds with the top candidates matching the query in q, so clients
+// can let guests pick the track they had in mind.
+func (h *handler) search(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query().Get("q")
+	if q == "" {
+		w.WriteHeader(http.StatusBadRequest)
+		_, _ = fmt.Fprintln(w, "Missing required parameter: q")
+		return
+	}
+	limit := defaultSearchLimit
+	if v := r.URL.Query().Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > maxSearchLimit {
+			w.WriteHeader(http.StatusBadRequest)
+			_, _ = fmt.Fprintf(w, "Invalid value for parameter: limit (%s)\n", v)
+			return
+		}
+		limit = n
+	}
+
+	tracks, err := h.searcher.Search(r.Context(), q, h.market, limit)
+	if err != nil {
+		h.errLog.Printf("%T: Search: %s", h.searcher, err)
+		h.upstreamError(w, err)
+		return
+	}
+
+	res := struct {
+		Tracks []track `json:"tracks"`
+	}{
+		Tracks: make([]track, 0, len(tracks)),
+	}
+	for _, t := range tracks {
+		res.Tracks = append(res.Tracks, newTrack(t))
+	}
+	h.writeJSON(w, http.StatusOK, res)
+}
+
+// searchTopHit gets the URI of the most relevant track for query. An empty
+// string is returned if nothing matches.
+func (h *handler) searchTopHit(ctx context.Context, query string) (string, error) {
+	tracks, err := h.searcher.Search(ctx, query, h.market, 1)
+	if err != nil {
+		return "", fmt.Errorf("%T: Search: %w", h.searcher, err)
+	}
+	if len(tracks) == 0 {
+		return "", nil
+	}
+	return tracks[0].URI, nil
+}
+
+// upstreamError responds to a failed request to the Spotify Web API. Being rate
+// limited is reported as such, so clients know to back off.
+func (h *handler) upstreamError(w http.ResponseWriter, err error) {
+	if errors.Is(err, spotify.ErrRateLimited) {
+		var serr *spotify.Error
+		if errors.As(err, &serr) && serr.RetryAfter > 0 {
+			setRetryAfter(w, serr.RetryAfter)
+		}
+		http.Error(w, http.StatusText(http.StatusServiceUnavailable), http.StatusServiceUnavailable)
+		return
+	}
+	http.Error(w, http.StatusText(http.StatusBadGateway), http.StatusBadGateway)
+}
+
+func (h *handler) writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		h.errLog.Printf("encoding/json: Encoder.Encode: %s", err)
+	}
+}
@@ -0,0 +1,216 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/epels/sparty/internal/mock"
+	"github.com/epels/sparty/jobqueue"
+	"github.com/epels/sparty/spotify"
+)
+
+var bohemianRhapsody = spotify.Track{
+	URI:        "spotify:track:4u7EnebtmKWzUH433cf5Qv",
+	Name:       "Bohemian Rhapsody",
+	DurationMS: 354320,
+	Artists:    []spotify.Artist{{Name: "Queen"}},
+	Album:      spotify.Album{Name: "A Night At The Opera"},
+}
+
+func TestSearch(t *testing.T) {
+	noopLogger := log.New(ioutil.Discard, "", 0)
+	noopJobqueue := mock.Jobqueue{
+		PutFunc: func(ctx context.Context, j jobqueue.Job) (string, error) {
+			return "", nil
+		},
+	}
+
+	t.Run("Disabled", func(t *testing.T) {
+		rec := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodGet, "/search?q=queen", nil)
+		setAuth(t, req)
+
+		New(noopLogger, noopLogger, noopJobqueue, authToken).ServeHTTP(rec, req)
+
+		if rec.Code != http.StatusNotFound {
+			t.Errorf("Got %d, expected 404", rec.Code)
+		}
+	})
+
+	t.Run("Validation error", func(t *testing.T) {
+		for _, target := range []string{"/search", "/search?q=queen&limit=0", "/search?q=queen&limit=21", "/search?q=queen&limit=foo"} {
+			rec := httptest.NewRecorder()
+			req := httptest.NewRequest(http.MethodGet, target, nil)
+			setAuth(t, req)
+
+			New(noopLogger, noopLogger, noopJobqueue, authToken, WithSearcher(mock.Searcher{}, "")).ServeHTTP(rec, req)
+
+			if rec.Code != http.StatusBadRequest {
+				t.Errorf("%s: Got %d, expected 400", target, rec.Code)
+			}
+		}
+	})
+
+	t.Run("Searcher failure", func(t *testing.T) {
+		rec := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodGet, "/search?q=queen", nil)
+		setAuth(t, req)
+
+		s := mock.Searcher{
+			SearchFunc: func(ctx context.Context, query, market string, limit int) ([]spotify.Track, error) {
+				return nil, errors.New("some error")
+			},
+		}
+		New(noopLogger, noopLogger, noopJobqueue, authToken, WithSearcher(s, "")).ServeHTTP(rec, req)
+
+		if rec.Code != http.StatusBadGateway {
+			t.Errorf("Got %d, expected 502", rec.Code)
+		}
+	})
+
+	t.Run("Rate limited", func(t *testing.T) {
+		rec := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodGet, "/search?q=queen", nil)
+		setAuth(t, req)
+
+		s := mock.Searcher{
+			SearchFunc: func(ctx context.Context, query, market string, limit int) ([]spotify.Track, error) {
+				return nil, fmt.Errorf("foo: %w", &spotify.Error{Status: http.StatusTooManyRequests, RetryAfter: 1500 * time.Millisecond})
+			},
+		}
+		New(noopLogger, noopLogger, noopJobqueue, authToken, WithSearcher(s, "")).ServeHTTP(rec, req)
+
+		if rec.Code != http.StatusServiceUnavailable {
+			t.Errorf("Got %d, expected 503", rec.Code)
+		}
+		if ra := rec.Header().Get("Retry-After"); ra != "2" {
+			t.Errorf("Got %q, expected 2", ra)
+		}
+	})
+
+	t.Run("OK", func(t *testing.T) {
+		rec := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodGet, "/search?q=queen&limit=3", nil)
+		setAuth(t, req)
+
+		s := mock.Searcher{
+			SearchFunc: func(ctx context.Context, query, market string, limit int) ([]spotify.Track, error) {
+				if query != "queen" {
+					t.Errorf("Got %q, expected queen", query)
+				}
+				if market != "NL" {
+					t.Errorf("Got %q, expected NL", market)
+				}
+				if limit != 3 {
+					t.Errorf("Got %d, expected 3", limit)
+				}
+				return []spotify.Track{bohemianRhapsody}, nil
+			},
+		}
+		New(noopLogger, noopLogger, noopJobqueue, authToken, WithSearcher(s, "NL")).ServeHTTP(rec, req)
+
+		if rec.Code != http.StatusOK {
+			t.Errorf("Got %d, expected 200", rec.Code)
+		}
+		if ct := rec.Header().Get("Content-Type"); ct != "application/json" {
+			t.Errorf("Got %q, expected application/json", ct)
+		}
+		var res struct {
+			Tracks []track `json:"tracks"`
+		}
+		if err := json.NewDecoder(rec.Body).Decode(&res); err != nil {
+			t.Fatalf("Got %T (%s), expected nil", err, err)
+		}
+		if len(res.Tracks) != 1 {
+			t.Fatalf("Got %d, expected 1", len(res.Tracks))
+		}
+		tr := res.Tracks[0]
+		if tr.URI != "spotify:track:4u7EnebtmKWzUH433cf5Qv" {
+			t.Errorf("Got %q, expected spotify:track:4u7EnebtmKWzUH433cf5Qv", tr.URI)
+		}
+		if tr.Name != "Bohemian Rhapsody" {
+			t.Errorf("Got %q, expected Bohemian Rhapsody", tr.Name)
+		}
+		if len(tr.Artists) != 1 || tr.Artists[0] != "Queen" {
+			t.Errorf("Got %q, expected [Queen]", tr.Artists)
+		}
+		if tr.Album != "A Night At The Opera" {
+			t.Errorf("Got %q, expected A Night At The Opera", tr.Album)
+		}
+		if tr.DurationMS != 354320 {
+			t.Errorf("Got %d, expected 354320", tr.DurationMS)
+		}
+	})
+}
+
+func TestEnqueueQuery(t *testing.T) {
+	noopLogger := log.New(ioutil.Discard, "", 0)
+
+	t.Run("No results", func(t *testing.T) {
+		rec := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodPost, "/enqueue?q=nothing", nil)
+		setAuth(t, req)
+
+		jq := mock.Jobqueue{
+			PutFunc: func(ctx context.Context, j jobqueue.Job) (string, error) {
+				t.Error("Unexpected call to Put")
+				return "", nil
+			},
+		}
+		s := mock.Searcher{
+			SearchFunc: func(ctx context.Context, query, market string, limit int) ([]spotify.Track, error) {
+				return nil, nil
+			},
+		}
+		New(noopLogger, noopLogger, jq, authToken, WithSearcher(s, "")).ServeHTTP(rec, req)
+
+		if rec.Code != http.StatusNotFound {
+			t.Errorf("Got %d, expected 404", rec.Code)
+		}
+	})
+
+	t.Run("OK", func(t *testing.T) {
+		rec := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodPost, "/enqueue?q=queen+bohemian+rhapsody", nil)
+		setAuth(t, req)
+
+		var called bool
+		jq := mock.Jobqueue{
+			PutFunc: func(ctx context.Context, j jobqueue.Job) (string, error) {
+				called = true
+
+				if j.URI != "spotify:track:4u7EnebtmKWzUH433cf5Qv" {
+					t.Errorf("Got %q, expected spotify:track:4u7EnebtmKWzUH433cf5Qv", j.URI)
+				}
+				return "", nil
+			},
+		}
+		s := mock.Searcher{
+			SearchFunc: func(ctx context.Context, query, market string, limit int) ([]spotify.Track, error) {
+				if query != "queen bohemian rhapsody" {
+					t.Errorf("Got %q, expected queen bohemian rhapsody", query)
+				}
+				if limit != 1 {
+					t.Errorf("Got %d, expected 1", limit)
+				}
+				return []spotify.Track{bohemianRhapsody}, nil
+			},
+		}
+		New(noopLogger, noopLogger, jq, authToken, WithSearcher(s, "")).ServeHTTP(rec, req)
+
+		if rec.Code != http.StatusAccepted {
+			t.Errorf("Got %d, expected 202", rec.Code)
+		}
+		if !called {
+			t.Error("Got false, expected true")
+		}
+	})
+}
@@ -0,0 +1,170 @@
+package handler
+
+import (
+	"context"
+	"math"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/epels/sparty/events"
+	"github.com/epels/sparty/guest"
+	"github.com/epels/sparty/spotify"
+)
+
+type skipper interface {
+	// CurrentlyPlaying returns what is playing, or nil if nothing is.
+	CurrentlyPlaying(ctx context.Context) (*spotify.CurrentlyPlaying, error)
+	SkipToNext(ctx context.Context) error
+}
+
+// SkipVotes configures how many votes it takes to skip a track. If both Votes
+// and Fraction are set, reaching either one suffices. At least one vote is
+// always needed.
+type SkipVotes struct {
+	// Votes is the number of votes needed.
+	Votes int
+	// Fraction is the fraction of active guests, i.e. those who used the API
+	// within the last activeWindow, whose votes are needed.
+	Fraction float64
+}
+
+// activeWindow is how long guests count as active after their last request.
+const activeWindow = 30 * time.Minute
+
+// WithSkip lets guests vote to skip the track that is playing through POST
+// /skip. Once enough guests voted, s skips it.
+func WithSkip(s skipper, v SkipVotes) Option {
+	return func(h *handler) {
+		h.skipper = s
+		h.skipVotes = v
+		h.skips = &skips{}
+		h.activity = &activity{lastSeen: make(map[string]time.Time)}
+	}
+}
+
+// skips holds the votes to skip the track that is playing.
+type skips struct {
+	mu      sync.Mutex
+	trackID string
+	voters  map[string]bool
+	// skipped is set once the track got enough votes.
+	skipped bool
+}
+
+// vote records the vote of voter to skip the track with the given ID, and
+// returns the number of votes for it. Votes for other tracks are discarded.
+//
+// Skip is true for the vote that makes the track reach needed votes, and for
+// that vote only: even if guests vote at the same time, the track is skipped
+// once. Votes for a track that got enough votes already are ignored: ok is
+// false for them.
+func (s *skips) vote(trackID, voter string, needed int) (votes int, skip, ok bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if trackID != s.trackID || s.voters == nil {
+		s.trackID = trackID
+		s.voters = make(map[string]bool)
+		s.skipped = false
+	}
+	if s.skipped {
+		return len(s.voters), false, false
+	}
+	s.voters[voter] = true
+	s.skipped = len(s.voters) >= needed
+	return len(s.voters), s.skipped, true
+}
+
+// undo lets the track with the given ID be voted on again, after skipping it
+// failed.
+func (s *skips) undo(trackID string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if trackID == s.trackID {
+		s.skipped = false
+	}
+}
+
+// activity keeps track of when guests last used the API.
+type activity struct {
+	mu       sync.Mutex
+	lastSeen map[string]time.Time
+}
+
+func (a *activity) seen(name string, now time.Time) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	a.lastSeen[name] = now
+}
+
+// active returns the number of guests seen within activeWindow before now.
+func (a *activity) active(now time.Time) int {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	for name, t := range a.lastSeen {
+		if now.Sub(t) > activeWindow {
+			delete(a.lastSeen, name)
+		}
+	}
+	return len(a.lastSeen)
+}
+
+// needed returns the number of votes needed to skip a track, given the number
+// of active guests.
+func (v SkipVotes) needed(active int) int {
+	var n int
+	if v.Fraction > 0 {
+		n = int(math.Ceil(v.Fraction * float64(active)))
+	}
+	if v.Votes > 0 && (n == 0 || v.Votes < n) {
+		n = v.Votes
+	}
+	if n < 1 {
+		n = 1
+	}
+	return n
+}
+
+// skip casts the caller's vote to skip the track that is playing, and skips it
+// once enough guests voted.
+func (h *handler) skip(w http.ResponseWriter, r *http.Request) {
+	cp, err := h.skipper.CurrentlyPlaying(r.Context())
+	if err != nil {
+		h.errLog.Printf("%T: CurrentlyPlaying: %s", h.skipper, err)
+		h.upstreamError(w, err)
+		return
+	}
+	if cp == nil || !cp.IsPlaying || cp.Item == nil {
+		http.Error(w, "Nothing is playing", http.StatusConflict)
+		return
+	}
+
+	g, _ := guest.FromContext(r.Context())
+	needed := h.skipVotes.needed(h.activity.active(h.nowFunc()))
+	votes, skipped, ok := h.skips.vote(cp.Item.ID, g.Name, needed)
+	if !ok {
+		http.Error(w, "Track was skipped already", http.StatusConflict)
+		return
+	}
+	if skipped {
+		if err := h.skipper.SkipToNext(r.Context()); err != nil {
+			h.skips.undo(cp.Item.ID)
+			h.errLog.Printf("%T: SkipToNext: %s", h.skipper, err)
+			h.upstreamError(w, err)
+			return
+		}
+		h.infoLog.Printf("Skipped %s with %d of %d votes", cp.Item.URI, votes, needed)
+	}
+	res := struct {
+		Track   string `json:"track"`
+		Votes   int    `json:"votes"`
+		Needed  int    `json:"needed"`
+		Skipped bool   `json:"skipped"`
+	}{cp.Item.URI, votes, needed, skipped}
+	h.publish(events.SkipVote, res)
+	h.writeJSON(w, http.StatusOK, res)
+}
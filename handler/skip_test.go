@@ -0,0 +1,236 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/epels/sparty/guest"
+	"github.com/epels/sparty/internal/mock"
+	"github.com/epels/sparty/jobqueue"
+	"github.com/epels/sparty/spotify"
+)
+
+func TestSkipVotesNeeded(t *testing.T) {
+	for _, tc := range []struct {
+		v      SkipVotes
+		active int
+		exp    int
+	}{
+		{SkipVotes{}, 10, 1},
+		{SkipVotes{Votes: 3}, 10, 3},
+		{SkipVotes{Fraction: 0.5}, 5, 3},
+		{SkipVotes{Fraction: 0.5}, 0, 1},
+		{SkipVotes{Votes: 3, Fraction: 0.5}, 4, 2},
+		{SkipVotes{Votes: 3, Fraction: 0.5}, 10, 3},
+	} {
+		if n := tc.v.needed(tc.active); n != tc.exp {
+			t.Errorf("%+v with %d active: Got %d, expected %d", tc.v, tc.active, n, tc.exp)
+		}
+	}
+}
+
+func TestSkip(t *testing.T) {
+	noopLogger := log.New(ioutil.Discard, "", 0)
+	noopJobqueue := mock.Jobqueue{
+		PutFunc: func(ctx context.Context, j jobqueue.Job) (string, error) {
+			return "", nil
+		},
+	}
+	reg := guest.NewRegistry()
+	tokens := make(map[string]string)
+	for _, name := range []string{"alice", "bob", "carol"} {
+		_, tok, err := reg.Issue(name, 0, false)
+		if err != nil {
+			t.Fatalf("Got %T (%s), expected nil", err, err)
+		}
+		tokens[name] = tok
+	}
+	type result struct {
+		Track   string `json:"track"`
+		Votes   int    `json:"votes"`
+		Needed  int    `json:"needed"`
+		Skipped bool   `json:"skipped"`
+	}
+	skip := func(t *testing.T, h http.Handler, name string) result {
+		t.Helper()
+
+		rec := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodPost, "/skip", nil)
+		req.Header.Set("Authorization", "Token "+tokens[name])
+		h.ServeHTTP(rec, req)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("Got %d, expected 200", rec.Code)
+		}
+		var res result
+		if err := json.NewDecoder(rec.Body).Decode(&res); err != nil {
+			t.Fatalf("Got %T (%s), expected nil", err, err)
+		}
+		return res
+	}
+
+	playing := "a"
+	var skipped int
+	p := mock.Player{
+		CurrentlyPlayingFunc: func(ctx context.Context) (*spotify.CurrentlyPlaying, error) {
+			return &spotify.CurrentlyPlaying{
+				IsPlaying: true,
+				Item:      &spotify.Track{ID: playing, URI: "spotify:track:" + playing},
+			}, nil
+		},
+		SkipToNextFunc: func(ctx context.Context) error {
+			skipped++
+			return nil
+		},
+	}
+
+	t.Run("Votes", func(t *testing.T) {
+		h := New(noopLogger, noopLogger, noopJobqueue, authToken, WithGuests(reg), WithSkip(p, SkipVotes{Votes: 2}))
+		skipped = 0
+
+		if res := skip(t, h, "alice"); res.Votes != 1 || res.Needed != 2 || res.Skipped {
+			t.Errorf("Got %+v, expected 1 of 2 votes", res)
+		}
+		// Voting twice does not count.
+		if res := skip(t, h, "alice"); res.Votes != 1 || res.Skipped {
+			t.Errorf("Got %+v, expected 1 of 2 votes", res)
+		}
+		if res := skip(t, h, "bob"); res.Votes != 2 || !res.Skipped {
+			t.Errorf("Got %+v, expected skipped", res)
+		}
+		if skipped != 1 {
+			t.Errorf("Got %d, expected 1", skipped)
+		}
+
+		// Once skipped, further votes for the track are ignored.
+		rec := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodPost, "/skip", nil)
+		req.Header.Set("Authorization", "Token "+tokens["carol"])
+		h.ServeHTTP(rec, req)
+		if rec.Code != http.StatusConflict {
+			t.Errorf("Got %d, expected 409", rec.Code)
+		}
+		if skipped != 1 {
+			t.Errorf("Got %d, expected 1", skipped)
+		}
+	})
+
+	t.Run("Concurrent votes", func(t *testing.T) {
+		var skipped int32
+		p := mock.Player{
+			CurrentlyPlayingFunc: func(ctx context.Context) (*spotify.CurrentlyPlaying, error) {
+				return &spotify.CurrentlyPlaying{
+					IsPlaying: true,
+					Item:      &spotify.Track{ID: "a", URI: "spotify:track:a"},
+				}, nil
+			},
+			SkipToNextFunc: func(ctx context.Context) error {
+				atomic.AddInt32(&skipped, 1)
+				// Give the other votes a chance to come in meanwhile.
+				time.Sleep(10 * time.Millisecond)
+				return nil
+			},
+		}
+		h := New(noopLogger, noopLogger, noopJobqueue, authToken, WithGuests(reg), WithSkip(p, SkipVotes{Votes: 1}))
+
+		var wg sync.WaitGroup
+		for name := range tokens {
+			wg.Add(1)
+			go func(name string) {
+				defer wg.Done()
+				rec := httptest.NewRecorder()
+				req := httptest.NewRequest(http.MethodPost, "/skip", nil)
+				req.Header.Set("Authorization", "Token "+tokens[name])
+				h.ServeHTTP(rec, req)
+			}(name)
+		}
+		wg.Wait()
+		if n := atomic.LoadInt32(&skipped); n != 1 {
+			t.Errorf("Got %d, expected 1", n)
+		}
+	})
+
+	t.Run("Skip failed", func(t *testing.T) {
+		fail := true
+		p := mock.Player{
+			CurrentlyPlayingFunc: p.CurrentlyPlayingFunc,
+			SkipToNextFunc: func(ctx context.Context) error {
+				if fail {
+					return errors.New("some error")
+				}
+				return nil
+			},
+		}
+		h := New(noopLogger, noopLogger, noopJobqueue, authToken, WithGuests(reg), WithSkip(p, SkipVotes{Votes: 1}))
+		playing = "a"
+
+		rec := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodPost, "/skip", nil)
+		req.Header.Set("Authorization", "Token "+tokens["alice"])
+		h.ServeHTTP(rec, req)
+		if rec.Code == http.StatusOK {
+			t.Errorf("Got %d, expected an error", rec.Code)
+		}
+		// The next vote tries again.
+		fail = false
+		if res := skip(t, h, "bob"); !res.Skipped {
+			t.Errorf("Got %+v, expected skipped", res)
+		}
+	})
+
+	t.Run("Track changed", func(t *testing.T) {
+		h := New(noopLogger, noopLogger, noopJobqueue, authToken, WithGuests(reg), WithSkip(p, SkipVotes{Votes: 2}))
+		skipped = 0
+
+		playing = "a"
+		if res := skip(t, h, "alice"); res.Votes != 1 {
+			t.Errorf("Got %+v, expected 1 vote", res)
+		}
+		playing = "b"
+		if res := skip(t, h, "bob"); res.Votes != 1 || res.Track != "spotify:track:b" || res.Skipped {
+			t.Errorf("Got %+v, expected 1 vote for b", res)
+		}
+		if skipped != 0 {
+			t.Errorf("Got %d, expected 0", skipped)
+		}
+	})
+
+	t.Run("Fraction", func(t *testing.T) {
+		now := time.Date(2020, 1, 1, 20, 0, 0, 0, time.UTC)
+		h := New(noopLogger, noopLogger, noopJobqueue, authToken, WithGuests(reg), WithSkip(p, SkipVotes{Fraction: 0.5}))
+		h.nowFunc = func() time.Time { return now }
+		skipped = 0
+
+		// Carol and bob are active, but carol went home.
+		h.activity.seen("carol", now.Add(-time.Hour))
+		h.activity.seen("bob", now)
+		if res := skip(t, h, "alice"); res.Needed != 1 || !res.Skipped {
+			t.Errorf("Got %+v, expected skipped with 1 vote", res)
+		}
+	})
+
+	t.Run("Nothing playing", func(t *testing.T) {
+		p := mock.Player{
+			CurrentlyPlayingFunc: func(ctx context.Context) (*spotify.CurrentlyPlaying, error) {
+				return nil, nil
+			},
+		}
+		h := New(noopLogger, noopLogger, noopJobqueue, authToken, WithSkip(p, SkipVotes{}))
+
+		rec := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodPost, "/skip", nil)
+		setAuth(t, req)
+		h.ServeHTTP(rec, req)
+		if rec.Code != http.StatusConflict {
+			t.Errorf("Got %d, expected 409", rec.Code)
+		}
+	})
+}
@@ -0,0 +1,401 @@
+package handler
+
+import (
+	"io"
+	"net/http"
+)
+
+// asset is a static file of the guest web app. The assets are compiled into the
+// binary, so spartyd stays a single file to deploy.
+type asset struct {
+	contentType string
+	body        string
+}
+
+// uiAssets are the assets of the guest web app, by path.
+var uiAssets = map[string]asset{
+	"/":        {"text/html; charset=utf-8", uiHTML},
+	"/app.css": {"text/css; charset=utf-8", uiCSS},
+	"/app.js":  {"application/javascript; charset=utf-8", uiJS},
+}
+
+// uiCSP only allows the app's own assets, and album art from Spotify.
+const uiCSP = "default-src 'self'; img-src 'self' https://i.scdn.co; style-src 'self'; script-src 'self'; connect-src 'self'"
+
+// WithUI serves a small web app to guests on /, where they can request songs
+// by link or search, see what is playing and what is up next, and follow what
+// becomes of their requests. It talks to the API with the guest's token, which
+// it asks for, or takes from a link like /#token=<token>.
+func WithUI() Option {
+	return func(h *handler) {
+		h.ui = true
+	}
+}
+
+// uiHandler serves the assets of the guest web app. It is registered for /, so
+// it responds to any path the API doesn't know with a 404, whatever the method.
+func (h *handler) uiHandler(w http.ResponseWriter, r *http.Request) {
+	if _, ok := uiAssets[r.URL.Path]; !ok {
+		http.NotFound(w, r)
+		return
+	}
+	h.method(http.MethodGet, func(w http.ResponseWriter, r *http.Request) {
+		serveAsset(w, r, uiAssets)
+	})(w, r)
+}
+
+// serveAsset serves the asset in assets for the requested path, or a 404.
+func serveAsset(w http.ResponseWriter, r *http.Request, assets map[string]asset) {
+	a, ok := assets[r.URL.Path]
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	w.Header().Set("Content-Type", a.contentType)
+	w.Header().Set("Content-Security-Policy", uiCSP)
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.Header().Set("Referrer-Policy", "no-referrer")
+	w.Header().Set("Cache-Control", "no-cache")
+	_, _ = io.WriteString(w, a.body)
+}
+
+const uiHTML = `<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<title>sparty</title>
+<link rel="stylesheet" href="/app.css">
+</head>
+<body>
+<header><h1>sparty</h1></header>
+
+<section id="login" hidden>
+<h2>Join the party</h2>
+<p>Enter the token the host gave you.</p>
+<form id="login-form">
+<input id="token" type="password" autocomplete="off" placeholder="Token" required>
+<button type="submit">Join</button>
+</form>
+</section>
+
+<main id="app" hidden>
+<section>
+<h2>Request a song</h2>
+<form id="request-form">
+<input id="request" type="text" autocomplete="off" placeholder="Paste a link, or search" required>
+<button type="submit">Go</button>
+</form>
+<p id="feedback" role="status"></p>
+<ul id="results" class="tracks"></ul>
+</section>
+
+<section>
+<h2>Now playing</h2>
+<div id="now-playing" class="now-playing"><p class="muted">Nothing is playing.</p></div>
+</section>
+
+<section>
+<h2>Up next</h2>
+<ul id="queue" class="tracks"><li class="muted">Nothing is queued.</li></ul>
+</section>
+
+<footer><button id="logout" type="button" class="link">Leave</button></footer>
+</main>
+
+<script src="/app.js"></script>
+</body>
+</html>
+`
+
+const uiCSS = `* { box-sizing: border-box; }
+body { margin: 0 auto; max-width: 40em; padding: 0 1em 2em; font-family: system-ui, sans-serif; background: #121212; color: #eee; }
+h1 { color: #1db954; }
+h2 { font-size: 1.1em; margin-top: 2em; }
+form { display: flex; gap: .5em; }
+input { flex: 1; padding: .6em; border: 0; border-radius: .3em; font-size: 1em; }
+button { padding: .6em 1em; border: 0; border-radius: .3em; background: #1db954; color: #fff; font-size: 1em; cursor: pointer; }
+button:disabled { opacity: .5; cursor: default; }
+button.link { background: none; color: #aaa; padding: 0; text-decoration: underline; }
+.muted { color: #888; }
+.error { color: #f66; }
+.ok { color: #1db954; }
+.tracks { list-style: none; padding: 0; }
+.tracks li { display: flex; align-items: center; gap: .75em; padding: .4em 0; border-bottom: 1px solid #282828; }
+.tracks img, .now-playing img { width: 48px; height: 48px; border-radius: .2em; }
+.now-playing { display: flex; align-items: center; gap: 1em; }
+.now-playing img { width: 96px; height: 96px; }
+.track { flex: 1; min-width: 0; }
+.track .name { font-weight: bold; overflow: hidden; text-overflow: ellipsis; white-space: nowrap; }
+.track .meta { color: #aaa; font-size: .9em; }
+progress { width: 100%; height: .4em; }
+footer { margin-top: 3em; }
+`
+
+const uiJS = `(function () {
+  "use strict";
+
+  var token = "";
+  var pollTimer = null;
+
+  function $(id) { return document.getElementById(id); }
+
+  function el(tag, className, text) {
+    var e = document.createElement(tag);
+    if (className) { e.className = className; }
+    if (text !== undefined) { e.textContent = text; }
+    return e;
+  }
+
+  function api(method, path) {
+    return fetch(path, {
+      method: method,
+      headers: { "Authorization": "Token " + token }
+    }).then(function (res) {
+      if (res.status === 401) {
+        logout("Your token is not valid (anymore).");
+        throw new Error("unauthorized");
+      }
+      return res;
+    });
+  }
+
+  function json(res) {
+    return res.json().catch(function () { return {}; });
+  }
+
+  function feedback(msg, className) {
+    var f = $("feedback");
+    f.textContent = msg;
+    f.className = className || "";
+  }
+
+  function retryAfter(res) {
+    var s = parseInt(res.headers.get("Retry-After"), 10);
+    if (!s) { return ""; }
+    if (s < 120) { return " Try again in " + s + " seconds."; }
+    return " Try again in " + Math.ceil(s / 60) + " minutes.";
+  }
+
+  function trackItem(t, action) {
+    var li = el("li");
+    if (t.album_art_url) {
+      var img = el("img");
+      img.src = t.album_art_url;
+      img.alt = "";
+      li.appendChild(img);
+    }
+    var info = el("div", "track");
+    info.appendChild(el("div", "name", t.name));
+    var meta = (t.artists || []).join(", ");
+    if (t.requester) { meta += " · requested by " + t.requester; }
+    info.appendChild(el("div", "meta", meta));
+    li.appendChild(info);
+    if (action) { li.appendChild(action); }
+    return li;
+  }
+
+  // Requests.
+
+  function isLink(s) {
+    return /^(https?:\/\/|spotify:)/i.test(s);
+  }
+
+  function enqueue(url) {
+    feedback("Requesting…", "muted");
+    return api("POST", "/enqueue?url=" + encodeURIComponent(url)).then(function (res) {
+      return json(res).then(function (body) { handleEnqueue(res, body); });
+    }).catch(networkError);
+  }
+
+  function handleEnqueue(res, body) {
+    switch (res.status) {
+    case 202:
+      $("results").textContent = "";
+      $("request").value = "";
+      if (body.status === "awaiting_approval") {
+        feedback("Your song awaits the host's approval.", "ok");
+      } else if (res.headers.get("Location")) {
+        feedback("Your song is on its way…", "ok");
+        followJob(res.headers.get("Location"), 0);
+      } else {
+        feedback("Your song was accepted.", "ok");
+      }
+      break;
+    case 409:
+      feedback("That song is queued already, or was played recently." + retryAfter(res), "error");
+      break;
+    case 422:
+      feedback("That song is not allowed here: " + (body.error || "it breaks a rule") + ".", "error");
+      break;
+    case 429:
+      feedback("Easy there: you requested a lot of songs." + retryAfter(res), "error");
+      break;
+    case 400:
+    case 404:
+      feedback("That doesn't look like a song we can play.", "error");
+      break;
+    case 503:
+      feedback("The party is too busy to take your song right now." + retryAfter(res), "error");
+      break;
+    default:
+      feedback("Something went wrong. Please try again.", "error");
+    }
+  }
+
+  // followJob polls the status of a job until it was sent or failed.
+  function followJob(location, n) {
+    if (n >= 30) { return; }
+    setTimeout(function () {
+      api("GET", location).then(function (res) {
+        if (res.status !== 200) { return; }
+        return json(res).then(function (job) {
+          if (job.status === "sent") {
+            feedback("Your song was added to the queue!", "ok");
+            refresh();
+          } else if (job.status === "failed") {
+            feedback("Your song could not be added to the queue: " + (job.error || "unknown error") + ".", "error");
+          } else {
+            followJob(location, n + 1);
+          }
+        });
+      }).catch(function () {});
+    }, 2000);
+  }
+
+  function search(q) {
+    feedback("Searching…", "muted");
+    api("GET", "/search?q=" + encodeURIComponent(q)).then(function (res) {
+      if (res.status === 404) {
+        // Search is not enabled: let the server pick the top hit.
+        return api("POST", "/enqueue?q=" + encodeURIComponent(q)).then(function (res) {
+          return json(res).then(function (body) { handleEnqueue(res, body); });
+        });
+      }
+      if (res.status !== 200) {
+        feedback("Searching failed. Please try again.", "error");
+        return;
+      }
+      return json(res).then(function (body) {
+        var ul = $("results");
+        ul.textContent = "";
+        var tracks = body.tracks || [];
+        if (tracks.length === 0) {
+          feedback("No songs found.", "error");
+          return;
+        }
+        feedback("");
+        tracks.forEach(function (t) {
+          var b = el("button", "", "Add");
+          b.type = "button";
+          b.addEventListener("click", function () {
+            b.disabled = true;
+            enqueue(t.uri);
+          });
+          ul.appendChild(trackItem(t, b));
+        });
+      });
+    }).catch(networkError);
+  }
+
+  function networkError(err) {
+    if (err && err.message === "unauthorized") { return; }
+    feedback("Could not reach the party. Please try again.", "error");
+  }
+
+  // Now playing and up next.
+
+  function renderNowPlaying(body) {
+    var div = $("now-playing");
+    div.textContent = "";
+    if (!body.track) {
+      div.appendChild(el("p", "muted", "Nothing is playing."));
+      return;
+    }
+    var item = trackItem(body.track);
+    while (item.firstChild) { div.appendChild(item.firstChild); }
+    var info = div.querySelector(".track");
+    var p = el("progress");
+    p.max = body.track.duration_ms || 1;
+    p.value = body.progress_ms || 0;
+    info.appendChild(p);
+  }
+
+  function renderQueue(body) {
+    var ul = $("queue");
+    ul.textContent = "";
+    var tracks = body.queue || [];
+    if (tracks.length === 0) {
+      ul.appendChild(el("li", "muted", "Nothing is queued."));
+      return;
+    }
+    tracks.slice(0, 20).forEach(function (t) { ul.appendChild(trackItem(t)); });
+  }
+
+  function refresh() {
+    api("GET", "/now-playing").then(function (res) {
+      if (res.status === 200) { return json(res).then(renderNowPlaying); }
+    }).catch(function () {});
+    api("GET", "/queue").then(function (res) {
+      if (res.status === 200) { return json(res).then(renderQueue); }
+    }).catch(function () {});
+  }
+
+  function listen() {
+    if (!window.EventSource) { return; }
+    var es = new EventSource("/events?token=" + encodeURIComponent(token));
+    ["song_requested", "job_sent", "track_changed"].forEach(function (type) {
+      es.addEventListener(type, refresh);
+    });
+    es.addEventListener("error", function () {
+      // Events may not be enabled: polling keeps the page up to date.
+      if (es.readyState === EventSource.CLOSED) { es.close(); }
+    });
+  }
+
+  // Logging in and out.
+
+  function start() {
+    $("login").hidden = true;
+    $("app").hidden = false;
+    refresh();
+    pollTimer = setInterval(refresh, 15000);
+    listen();
+  }
+
+  function logout(msg) {
+    token = "";
+    localStorage.removeItem("sparty-token");
+    clearInterval(pollTimer);
+    $("app").hidden = true;
+    $("login").hidden = false;
+    if (msg) { alert(msg); }
+  }
+
+  $("login-form").addEventListener("submit", function (e) {
+    e.preventDefault();
+    token = $("token").value.trim();
+    localStorage.setItem("sparty-token", token);
+    start();
+  });
+
+  $("request-form").addEventListener("submit", function (e) {
+    e.preventDefault();
+    var q = $("request").value.trim();
+    if (!q) { return; }
+    if (isLink(q)) { enqueue(q); } else { search(q); }
+  });
+
+  $("logout").addEventListener("click", function () { logout(); });
+
+  // The host can share a link like /#token=<token>, which is not sent to the
+  // server, nor kept in the browser history.
+  var m = /token=([^&]+)/.exec(location.hash);
+  if (m) {
+    localStorage.setItem("sparty-token", decodeURIComponent(m[1]));
+    history.replaceState(null, "", location.pathname);
+  }
+  token = localStorage.getItem("sparty-token") || "";
+  if (token) { start(); } else { $("login").hidden = false; }
+})();
+`
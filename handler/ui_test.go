@@ -0,0 +1,89 @@
+package handler
+
+import (
+	"context"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/epels/sparty/internal/mock"
+	"github.com/epels/sparty/jobqueue"
+)
+
+func TestUI(t *testing.T) {
+	noopLogger := log.New(ioutil.Discard, "", 0)
+	noopJobqueue := mock.Jobqueue{
+		PutFunc: func(ctx context.Context, j jobqueue.Job) (string, error) {
+			return "", nil
+		},
+	}
+	h := New(noopLogger, noopLogger, noopJobqueue, authToken, WithUI())
+
+	for _, tc := range []struct {
+		path, contentType string
+	}{
+		{"/", "text/html; charset=utf-8"},
+		{"/app.css", "text/css; charset=utf-8"},
+		{"/app.js", "application/javascript; charset=utf-8"},
+	} {
+		t.Run(tc.path, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, tc.path, nil))
+
+			if rec.Code != http.StatusOK {
+				t.Errorf("Got %d, expected 200", rec.Code)
+			}
+			if ct := rec.Header().Get("Content-Type"); ct != tc.contentType {
+				t.Errorf("Got %q, expected %q", ct, tc.contentType)
+			}
+			if csp := rec.Header().Get("Content-Security-Policy"); csp == "" {
+				t.Error("Got empty Content-Security-Policy, expected one")
+			}
+			if rec.Body.Len() == 0 {
+				t.Error("Got empty body, expected asset")
+			}
+		})
+	}
+
+	t.Run("Assets", func(t *testing.T) {
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+		for _, path := range []string{"/app.css", "/app.js"} {
+			if !strings.Contains(rec.Body.String(), `"`+path+`"`) {
+				t.Errorf("Got no reference to %s, expected one", path)
+			}
+		}
+	})
+
+	t.Run("Not found", func(t *testing.T) {
+		for _, m := range []string{http.MethodGet, http.MethodPost} {
+			rec := httptest.NewRecorder()
+			h.ServeHTTP(rec, httptest.NewRequest(m, "/enqeue", nil))
+
+			if rec.Code != http.StatusNotFound {
+				t.Errorf("%s: Got %d, expected 404", m, rec.Code)
+			}
+		}
+	})
+
+	t.Run("Method not allowed", func(t *testing.T) {
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/", nil))
+
+		if rec.Code != http.StatusMethodNotAllowed {
+			t.Errorf("Got %d, expected 405", rec.Code)
+		}
+	})
+
+	t.Run("API", func(t *testing.T) {
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/enqueue?url=spotify:track:1301WleyT98MSxVHPZCA6M", nil))
+
+		if rec.Code != http.StatusUnauthorized {
+			t.Errorf("Got %d, expected 401", rec.Code)
+		}
+	})
+}
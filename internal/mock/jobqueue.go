@@ -1,9 +1,15 @@
 package mock
 
+import (
+	"context"
+
+	"github.com/epels/sparty/jobqueue"
+)
+
 type Jobqueue struct {
-	PutFunc func(url string) error
+	PutFunc func(ctx context.Context, j jobqueue.Job) (string, error)
 }
 
-func (jq Jobqueue) Put(url string) error {
-	return jq.PutFunc(url)
+func (jq Jobqueue) Put(ctx context.Context, j jobqueue.Job) (string, error) {
+	return jq.PutFunc(ctx, j)
 }
@@ -0,0 +1,11 @@
+package mock
+
+import "context"
+
+type Checker struct {
+	CheckFunc func(ctx context.Context, uri string) error
+}
+
+func (c Checker) Check(ctx context.Context, uri string) error {
+	return c.CheckFunc(ctx, uri)
+}
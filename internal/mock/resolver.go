@@ -0,0 +1,11 @@
+package mock
+
+import "context"
+
+type Resolver struct {
+	ResolveFunc func(ctx context.Context, link string) (string, error)
+}
+
+func (r Resolver) Resolve(ctx context.Context, link string) (string, error) {
+	return r.ResolveFunc(ctx, link)
+}
@@ -0,0 +1,59 @@
+package mock
+
+import (
+	"context"
+
+	"github.com/epels/sparty/spotify"
+)
+
+type Searcher struct {
+	SearchFunc func(ctx context.Context, query, market string, limit int) ([]spotify.Track, error)
+}
+
+func (s Searcher) Search(ctx context.Context, query, market string, limit int) ([]spotify.Track, error) {
+	return s.SearchFunc(ctx, query, market, limit)
+}
+
+type Authenticator struct {
+	AuthCodeURLFunc func(redirectURI, state, challenge string) string
+	ExchangeFunc    func(ctx context.Context, code, redirectURI, verifier string) error
+}
+
+func (a Authenticator) AuthCodeURL(redirectURI, state, challenge string) string {
+	return a.AuthCodeURLFunc(redirectURI, state, challenge)
+}
+
+func (a Authenticator) Exchange(ctx context.Context, code, redirectURI, verifier string) error {
+	return a.ExchangeFunc(ctx, code, redirectURI, verifier)
+}
+
+type Catalog struct {
+	GetTrackFunc   func(ctx context.Context, id string) (spotify.Track, error)
+	GetArtistsFunc func(ctx context.Context, ids []string) ([]spotify.Artist, error)
+}
+
+func (c Catalog) GetTrack(ctx context.Context, id string) (spotify.Track, error) {
+	return c.GetTrackFunc(ctx, id)
+}
+
+func (c Catalog) GetArtists(ctx context.Context, ids []string) ([]spotify.Artist, error) {
+	return c.GetArtistsFunc(ctx, ids)
+}
+
+type Player struct {
+	CurrentlyPlayingFunc func(ctx context.Context) (*spotify.CurrentlyPlaying, error)
+	SkipToNextFunc       func(ctx context.Context) error
+	QueueFunc            func(ctx context.Context) (*spotify.Queue, error)
+}
+
+func (p Player) CurrentlyPlaying(ctx context.Context) (*spotify.CurrentlyPlaying, error) {
+	return p.CurrentlyPlayingFunc(ctx)
+}
+
+func (p Player) SkipToNext(ctx context.Context) error {
+	return p.SkipToNextFunc(ctx)
+}
+
+func (p Player) Queue(ctx context.Context) (*spotify.Queue, error) {
+	return p.QueueFunc(ctx)
+}
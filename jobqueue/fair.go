@@ -0,0 +1,288 @@
+package jobqueue
+
+import (
+	"context"
+	"fmt"
+	"sync"
+)
+
+// fair is an in-memory job queue that keeps a queue per requester, and takes
+// turns between them: one guest requesting ten songs in a row does not keep
+// the others waiting for all of them. Each requester's own jobs are processed
+// in the order they were put. Jobs that fail are retried according to its
+// RetryPolicy, and kept as dead letters once it is exhausted.
+type fair struct {
+	gate
+
+	retry    RetryPolicy
+	weights  map[string]int
+	capacity int
+	// onDone is called once a job was processed.
+	onDone func(j Job, st Status)
+
+	mu     sync.Mutex
+	queues map[string][]Job
+	// turns holds the requesters with jobs in their queue, in the order they
+	// take turns. The one at turn is up, and had taken jobs of its turn.
+	turns    []string
+	turn     int
+	taken    int
+	busy     []Job
+	dead     []DeadLetter
+	statuses statuses
+	closed   bool
+	notify   chan struct{}
+}
+
+// WithWeights gives the requesters in weights a turn of more (or less) than
+// one job in the fair jobqueue. Requesters not in weights have a weight of 1.
+// Other jobqueues ignore it.
+func WithWeights(weights map[string]int) Option {
+	return func(o *options) {
+		o.weights = weights
+	}
+}
+
+func NewFair(opts ...Option) *fair {
+	o := newOptions(opts)
+	return &fair{
+		retry:    o.retry,
+		weights:  o.weights,
+		capacity: o.capacity,
+		onDone:   o.done,
+		queues:   make(map[string][]Job),
+		notify:   make(chan struct{}, 1),
+	}
+}
+
+func (q *fair) Close() error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if !q.closed {
+		q.closed = true
+		close(q.notify)
+	}
+	return nil
+}
+
+// Consume will watch the fair jobqueue for new jobs, and pass them on to fn as
+// they become available, taking turns between requesters, unless it is paused.
+// If fn returns an error, the job is retried after a delay. Invocation blocks
+// until the context is cancelled: then, the context error is returned.
+func (q *fair) Consume(ctx context.Context, fn func(j Job) error) error {
+	for {
+		paused, err := q.wait(ctx)
+		if err != nil {
+			return err
+		}
+
+		q.mu.Lock()
+		if q.closed {
+			q.mu.Unlock()
+			return ErrChannelClosed
+		}
+		j, ok := q.next()
+		if ok {
+			q.busy = append(q.busy, j)
+		}
+		q.mu.Unlock()
+
+		if !ok {
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-paused:
+			case <-q.notify:
+			}
+			continue
+		}
+
+		dl, err := q.retry.attempt(ctx, j, fn)
+		q.mu.Lock()
+		for i, b := range q.busy {
+			if b == j {
+				q.busy = append(q.busy[:i], q.busy[i+1:]...)
+				break
+			}
+		}
+		if err == nil {
+			q.statuses.set(j, statusOf(dl))
+		}
+		if dl != nil {
+			q.dead = appendDeadLetter(q.dead, *dl)
+		}
+		q.mu.Unlock()
+		if err != nil {
+			return err
+		}
+		q.onDone(j, statusOf(dl))
+	}
+}
+
+// next takes the job that is up next. Callers must hold q.mu.
+func (q *fair) next() (Job, bool) {
+	return take(q.queues, &q.turns, &q.turn, &q.taken, q.weight)
+}
+
+// take takes the next job from queues, given the turns and how many jobs the
+// requester that is up has taken, and updates those.
+func take(queues map[string][]Job, turns *[]string, turn, taken *int, weight func(string) int) (Job, bool) {
+	if len(*turns) == 0 {
+		return Job{}, false
+	}
+	r := (*turns)[*turn]
+	j := queues[r][0]
+	queues[r] = queues[r][1:]
+	*taken++
+
+	if len(queues[r]) == 0 {
+		delete(queues, r)
+		*turns = append((*turns)[:*turn], (*turns)[*turn+1:]...)
+		*taken = 0
+	} else if *taken >= weight(r) {
+		*turn++
+		*taken = 0
+	}
+	if *turn >= len(*turns) {
+		*turn = 0
+	}
+	return j, true
+}
+
+func (q *fair) weight(requester string) int {
+	if w, ok := q.weights[requester]; ok && w > 0 {
+		return w
+	}
+	return 1
+}
+
+// Pending returns the jobs that were put but not processed yet, in the order
+// they will be processed. Jobs being processed come first.
+func (q *fair) Pending() []Job {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	return q.pending()
+}
+
+// Len returns the number of jobs that were put but not processed yet.
+func (q *fair) Len() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	return q.len()
+}
+
+// len is like Len, but callers must hold q.mu.
+func (q *fair) len() int {
+	n := len(q.busy)
+	for _, js := range q.queues {
+		n += len(js)
+	}
+	return n
+}
+
+// pending is like Pending, but callers must hold q.mu.
+func (q *fair) pending() []Job {
+	jobs := append([]Job(nil), q.busy...)
+	queues := make(map[string][]Job, len(q.queues))
+	for r, js := range q.queues {
+		queues[r] = js
+	}
+	turns := append([]string(nil), q.turns...)
+	turn, taken := q.turn, q.taken
+	for {
+		j, ok := take(queues, &turns, &turn, &taken, q.weight)
+		if !ok {
+			return jobs
+		}
+		jobs = append(jobs, j)
+	}
+}
+
+// Clear drops the jobs that are waiting to be processed, and returns how many
+// there were. Jobs being processed are not affected.
+func (q *fair) Clear() (int, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	var n int
+	for _, js := range q.queues {
+		for _, j := range js {
+			q.statuses.set(j, Status{State: StateCleared})
+			n++
+		}
+	}
+	q.queues = make(map[string][]Job)
+	q.turns = nil
+	q.turn, q.taken = 0, 0
+	return n, nil
+}
+
+// Status returns the status of the job with the given ID. It returns false if
+// the job is not known, e.g. because it was processed long ago.
+func (q *fair) Status(id string) (Status, bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	return q.statuses.status(id, q.pending())
+}
+
+// DeadLetters returns the jobs that failed permanently, oldest first.
+func (q *fair) DeadLetters() []DeadLetter {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	return append([]DeadLetter(nil), q.dead...)
+}
+
+// Redrive puts all dead letters back into the jobqueue, and returns how many
+// there were.
+func (q *fair) Redrive() (int, error) {
+	q.mu.Lock()
+	dead := q.dead
+	q.dead = nil
+	q.mu.Unlock()
+
+	for i, dl := range dead {
+		if _, err := q.Put(context.Background(), dl.Job); err != nil {
+			q.mu.Lock()
+			q.dead = append(dead[i:], q.dead...)
+			q.mu.Unlock()
+			return i, err
+		}
+	}
+	return len(dead), nil
+}
+
+// Put enqueues a job at the end of the queue of its requester, and returns its
+// ID. It does not block if the jobqueue is full, but returns ErrQueueFull.
+func (q *fair) Put(ctx context.Context, j Job) (string, error) {
+	if err := ctx.Err(); err != nil {
+		return "", err
+	}
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if q.closed {
+		return "", ErrClosed
+	}
+	if q.len()-len(q.busy) >= q.capacity {
+		return "", ErrQueueFull
+	}
+	j, err := withID(j)
+	if err != nil {
+		return "", fmt.Errorf("withID: %s", err)
+	}
+	if _, ok := q.queues[j.Requester]; !ok {
+		q.turns = append(q.turns, j.Requester)
+	}
+	q.queues[j.Requester] = append(q.queues[j.Requester], j)
+
+	select {
+	case q.notify <- struct{}{}:
+	default:
+	}
+	return j.ID, nil
+}
@@ -0,0 +1,142 @@
+package jobqueue
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func putAll(t *testing.T, q *fair, jobs ...Job) {
+	t.Helper()
+
+	for _, j := range jobs {
+		if _, err := q.Put(context.Background(), j); err != nil {
+			t.Fatalf("Got %T (%s), expected nil", err, err)
+		}
+	}
+}
+
+// consumeFair consumes n jobs from q, and returns their URIs.
+func consumeFair(t *testing.T, q *fair, n int) string {
+	t.Helper()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	var uris []string
+	err := q.Consume(ctx, func(j Job) error {
+		uris = append(uris, j.URI)
+		if len(uris) == n {
+			cancel()
+		}
+		return nil
+	})
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("Got %T (%s), expected context.Canceled", err, err)
+	}
+	return strings.Join(uris, ",")
+}
+
+func pendingURIs(jobs []Job) string {
+	var uris []string
+	for _, j := range jobs {
+		uris = append(uris, j.URI)
+	}
+	return strings.Join(uris, ",")
+}
+
+var partyJobs = []Job{
+	{URI: "a1", Requester: "alice"},
+	{URI: "a2", Requester: "alice"},
+	{URI: "a3", Requester: "alice"},
+	{URI: "b1", Requester: "bob"},
+	{URI: "b2", Requester: "bob"},
+	{URI: "c1", Requester: "carol"},
+}
+
+func TestFairConsume(t *testing.T) {
+	t.Run("Round-robin", func(t *testing.T) {
+		q := NewFair()
+		putAll(t, q, partyJobs...)
+
+		const exp = "a1,b1,c1,a2,b2,a3"
+		if s := pendingURIs(q.Pending()); s != exp {
+			t.Errorf("Got %q, expected %q", s, exp)
+		}
+		if s := consumeFair(t, q, 6); s != exp {
+			t.Errorf("Got %q, expected %q", s, exp)
+		}
+	})
+
+	t.Run("Weighted", func(t *testing.T) {
+		q := NewFair(WithWeights(map[string]int{"alice": 2}))
+		putAll(t, q, partyJobs...)
+
+		const exp = "a1,a2,b1,c1,a3,b2"
+		if s := pendingURIs(q.Pending()); s != exp {
+			t.Errorf("Got %q, expected %q", s, exp)
+		}
+		if s := consumeFair(t, q, 6); s != exp {
+			t.Errorf("Got %q, expected %q", s, exp)
+		}
+	})
+
+	t.Run("Late requester", func(t *testing.T) {
+		q := NewFair()
+		putAll(t, q, partyJobs[:3]...)
+		if s := consumeFair(t, q, 1); s != "a1" {
+			t.Errorf("Got %q, expected a1", s)
+		}
+		// Bob gets his turn after alice's next job.
+		putAll(t, q, partyJobs[3:5]...)
+		if s := consumeFair(t, q, 4); s != "a2,b1,a3,b2" {
+			t.Errorf("Got %q, expected a2,b1,a3,b2", s)
+		}
+	})
+}
+
+func TestFairClose(t *testing.T) {
+	q := NewFair()
+	if err := q.Close(); err != nil {
+		t.Errorf("Got %T (%s), expected nil", err, err)
+	}
+	if _, err := q.Put(context.Background(), Job{URI: "foo"}); !errors.Is(err, ErrClosed) {
+		t.Errorf("Got %v, expected %v", err, ErrClosed)
+	}
+	err := q.Consume(context.Background(), func(j Job) error {
+		t.Error("Unexpected call to fn")
+		return nil
+	})
+	if !errors.Is(err, ErrChannelClosed) {
+		t.Errorf("Got %v, expected %v", err, ErrChannelClosed)
+	}
+}
+
+func TestFairDeadLetters(t *testing.T) {
+	q := NewFair(WithRetryPolicy(fastRetry))
+	putAll(t, q, Job{URI: "foo", Requester: "alice"}, Job{URI: "bar", Requester: "bob"})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	err := q.Consume(ctx, func(j Job) error {
+		if j.URI == "foo" {
+			return errors.New("some error")
+		}
+		cancel()
+		return nil
+	})
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("Got %T (%s), expected context.Canceled", err, err)
+	}
+
+	dead := q.DeadLetters()
+	if len(dead) != 1 || dead[0].URI != "foo" || dead[0].Requester != "alice" {
+		t.Fatalf("Got %+v, expected foo", dead)
+	}
+	if n, err := q.Redrive(); n != 1 || err != nil {
+		t.Errorf("Got %d (%v), expected 1 (nil)", n, err)
+	}
+	if s := pendingURIs(q.Pending()); s != "foo" {
+		t.Errorf("Got %q, expected foo", s)
+	}
+}
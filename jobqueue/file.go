@@ -0,0 +1,475 @@
+package jobqueue
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// file is a job queue backed by an append-only log on local disk, so accepted
+// jobs survive restarts. Every put and every acknowledgement (after a job has
+// been consumed) is appended to the log and fsynced before returning. Jobs that
+// were put but never acknowledged are replayed on startup: delivery is thus
+// at-least-once. Jobs that fail are retried according to its RetryPolicy, and
+// logged as dead letters once it is exhausted.
+//
+// The log is compacted on startup and periodically while consuming, so it only
+// grows with the number of pending jobs.
+type file struct {
+	gate
+
+	retry    RetryPolicy
+	capacity int
+	// onDone is called once a job was processed.
+	onDone func(j Job, st Status)
+
+	mu       sync.Mutex
+	path     string
+	f        *os.File
+	pending  []record
+	dead     []record
+	statuses statuses
+	nextID   uint64
+	closed   bool
+	// busy is the ID of the job being processed, if isBusy is set.
+	busy   uint64
+	isBusy bool
+	// acks counts acknowledgements since the last compaction.
+	acks int
+
+	// notify is signalled whenever a job is put.
+	notify chan struct{}
+}
+
+// record is a single line in the log.
+type record struct {
+	Op        string      `json:"op"`
+	ID        uint64      `json:"id"`
+	JobID     string      `json:"job_id,omitempty"`
+	URI       string      `json:"uri,omitempty"`
+	Requester string      `json:"requester,omitempty"`
+	Dead      *DeadLetter `json:"dead,omitempty"`
+}
+
+func (rec record) job() Job {
+	return Job{ID: rec.JobID, URI: rec.URI, Requester: rec.Requester}
+}
+
+// A put adds a pending job, and both an ack and a dead record remove it. A dead
+// record adds a dead letter, which an ack removes again (when it is redriven).
+const (
+	opPut  = "put"
+	opAck  = "ack"
+	opDead = "dead"
+
+	// compactEvery is the number of acknowledgements after which the log is
+	// compacted.
+	compactEvery = 100
+)
+
+// NewFile opens (or creates) the log at path, and replays any jobs in it that
+// have not been acknowledged yet.
+func NewFile(path string, opts ...Option) (*file, error) {
+	o := newOptions(opts)
+	q := file{
+		retry:    o.retry,
+		capacity: o.capacity,
+		onDone:   o.done,
+		path:     path,
+		notify:   make(chan struct{}, 1),
+	}
+	if err := q.replay(); err != nil {
+		return nil, fmt.Errorf("replay: %s", err)
+	}
+	if err := q.compact(); err != nil {
+		return nil, fmt.Errorf("compact: %s", err)
+	}
+	if len(q.pending) > 0 {
+		q.notify <- struct{}{}
+	}
+	return &q, nil
+}
+
+func (q *file) replay() error {
+	f, err := os.Open(q.path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("os: Open: %s", err)
+	}
+	defer func() {
+		_ = f.Close()
+	}()
+
+	var recs []record
+	s := bufio.NewScanner(f)
+	for s.Scan() {
+		var rec record
+		if err := json.Unmarshal(s.Bytes(), &rec); err != nil {
+			// A crash halfway through writing a record leaves a partial
+			// last line. That job was never acknowledged to the caller, so
+			// it's safe to discard. Anything else is corruption.
+			if s.Scan() {
+				return fmt.Errorf("encoding/json: Unmarshal: %s", err)
+			}
+			break
+		}
+		recs = append(recs, rec)
+	}
+	if err := s.Err(); err != nil {
+		return fmt.Errorf("bufio: Scanner.Scan: %s", err)
+	}
+
+	// Only the last record for an ID determines its state.
+	last := make(map[uint64]string)
+	for _, rec := range recs {
+		last[rec.ID] = rec.Op
+		if rec.ID >= q.nextID {
+			q.nextID = rec.ID + 1
+		}
+	}
+	for _, rec := range recs {
+		switch {
+		case rec.Op == opPut && last[rec.ID] == opPut:
+			q.pending = append(q.pending, rec)
+		case rec.Op == opDead && last[rec.ID] == opDead && rec.Dead != nil:
+			q.dead = append(q.dead, rec)
+		}
+	}
+	return nil
+}
+
+// compact rewrites the log to only contain pending jobs. The new log is written
+// to a temporary file first, and then renamed over the old one, so a crash
+// halfway through never loses jobs. Callers must hold q.mu, or have exclusive
+// access to q otherwise.
+func (q *file) compact() error {
+	tmp := q.path + ".tmp"
+	f, err := os.OpenFile(tmp, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0600)
+	if err != nil {
+		return fmt.Errorf("os: OpenFile: %s", err)
+	}
+	w := bufio.NewWriter(f)
+	for _, rec := range append(append([]record(nil), q.dead...), q.pending...) {
+		if err := writeRecord(w, rec); err != nil {
+			_ = f.Close()
+			return fmt.Errorf("writeRecord: %s", err)
+		}
+	}
+	if err := w.Flush(); err != nil {
+		_ = f.Close()
+		return fmt.Errorf("bufio: Writer.Flush: %s", err)
+	}
+	if err := f.Sync(); err != nil {
+		_ = f.Close()
+		return fmt.Errorf("os: File.Sync: %s", err)
+	}
+	if err := f.Close(); err != nil {
+		return fmt.Errorf("os: File.Close: %s", err)
+	}
+	if err := os.Rename(tmp, q.path); err != nil {
+		return fmt.Errorf("os: Rename: %s", err)
+	}
+	// Make sure the rename itself is durable.
+	if d, err := os.Open(filepath.Dir(q.path)); err == nil {
+		_ = d.Sync()
+		_ = d.Close()
+	}
+
+	if q.f != nil {
+		_ = q.f.Close()
+	}
+	q.f, err = os.OpenFile(q.path, os.O_APPEND|os.O_WRONLY, 0600)
+	if err != nil {
+		return fmt.Errorf("os: OpenFile: %s", err)
+	}
+	q.acks = 0
+	return nil
+}
+
+// append durably appends rec to the log. Callers must hold q.mu.
+func (q *file) append(rec record) error {
+	if err := writeRecord(q.f, rec); err != nil {
+		return fmt.Errorf("writeRecord: %s", err)
+	}
+	if err := q.f.Sync(); err != nil {
+		return fmt.Errorf("os: File.Sync: %s", err)
+	}
+	return nil
+}
+
+func writeRecord(w io.Writer, rec record) error {
+	b, err := json.Marshal(rec)
+	if err != nil {
+		return fmt.Errorf("encoding/json: Marshal: %s", err)
+	}
+	// Write the record and its newline at once, so a record is never split
+	// over multiple writes.
+	if _, err := w.Write(append(b, '\n')); err != nil {
+		return fmt.Errorf("write: %s", err)
+	}
+	return nil
+}
+
+func (q *file) Close() error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if q.closed {
+		return nil
+	}
+	q.closed = true
+	close(q.notify)
+	if err := q.f.Close(); err != nil {
+		return fmt.Errorf("os: File.Close: %s", err)
+	}
+	return nil
+}
+
+// Consume will watch the file jobqueue for new jobs, and pass them on to fn as
+// they become available, unless it is paused. If fn returns an error, the job
+// is retried after a delay. A job is only acknowledged, and thus removed from
+// the log, once fn succeeds or the job is moved to the dead letters. Invocation
+// blocks until the context is cancelled: then, the context error is returned.
+func (q *file) Consume(ctx context.Context, fn func(j Job) error) error {
+	for {
+		paused, err := q.wait(ctx)
+		if err != nil {
+			return err
+		}
+		q.mu.Lock()
+		closed := q.closed
+		var rec record
+		ok := len(q.pending) > 0 && !closed
+		if ok {
+			rec = q.pending[0]
+			q.busy, q.isBusy = rec.ID, true
+		}
+		q.mu.Unlock()
+
+		if closed {
+			return ErrChannelClosed
+		}
+		if !ok {
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-paused:
+			case <-q.notify:
+			}
+			continue
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		dl, err := q.retry.attempt(ctx, rec.job(), fn)
+		if err != nil {
+			return err
+		}
+		if err := q.ack(rec.ID, dl); err != nil {
+			return fmt.Errorf("ack: %s", err)
+		}
+		q.onDone(rec.job(), statusOf(dl))
+	}
+}
+
+// Pending returns the jobs that were put but not acknowledged yet, oldest
+// first.
+func (q *file) Pending() []Job {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	return q.pendingJobs()
+}
+
+// Len returns the number of jobs that were put but not acknowledged yet.
+func (q *file) Len() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	return len(q.pending)
+}
+
+// pendingJobs is like Pending, but callers must hold q.mu.
+func (q *file) pendingJobs() []Job {
+	jobs := make([]Job, 0, len(q.pending))
+	for _, rec := range q.pending {
+		jobs = append(jobs, rec.job())
+	}
+	return jobs
+}
+
+// Status returns the status of the job with the given ID. It returns false if
+// the job is not known, e.g. because it was processed long ago. Only the
+// status of pending jobs and dead letters survives a restart.
+func (q *file) Status(id string) (Status, bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if st, ok := q.statuses.status(id, q.pendingJobs()); ok {
+		return st, true
+	}
+	for _, rec := range q.dead {
+		if rec.Dead.ID == id {
+			return Status{State: StateFailed, Err: rec.Dead.Err, Requester: rec.Dead.Requester}, true
+		}
+	}
+	return Status{}, false
+}
+
+// ack removes the pending job with the given ID. If dl is not nil, the job is
+// kept as a dead letter.
+func (q *file) ack(id uint64, dl *DeadLetter) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	q.isBusy = false
+	if q.closed {
+		// The job will be replayed upon the next start.
+		return nil
+	}
+	for i, rec := range q.pending {
+		if rec.ID == id {
+			q.pending = append(q.pending[:i], q.pending[i+1:]...)
+			q.statuses.set(rec.job(), statusOf(dl))
+			break
+		}
+	}
+	rec := record{Op: opAck, ID: id}
+	if dl != nil {
+		rec = record{Op: opDead, ID: id, Dead: dl}
+		q.dead = append(q.dead, rec)
+		if len(q.dead) > maxDeadLetters {
+			// Dropped dead letters are gone upon the next compaction.
+			q.dead = q.dead[len(q.dead)-maxDeadLetters:]
+		}
+	}
+	if err := q.append(rec); err != nil {
+		return fmt.Errorf("append: %s", err)
+	}
+
+	q.acks++
+	if q.acks >= compactEvery {
+		if err := q.compact(); err != nil {
+			return fmt.Errorf("compact: %s", err)
+		}
+	}
+	return nil
+}
+
+// Clear drops the jobs that are waiting to be processed, and returns how many
+// there were. The job being processed, if any, is not affected.
+func (q *file) Clear() (int, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if q.closed {
+		return 0, ErrClosed
+	}
+	var keep []record
+	for i, rec := range q.pending {
+		if q.isBusy && rec.ID == q.busy {
+			keep = append(keep, rec)
+			continue
+		}
+		if err := q.append(record{Op: opAck, ID: rec.ID}); err != nil {
+			n := i - len(keep)
+			q.pending = append(keep, q.pending[i:]...)
+			return n, fmt.Errorf("append: %s", err)
+		}
+		q.statuses.set(rec.job(), Status{State: StateCleared})
+		q.acks++
+	}
+	n := len(q.pending) - len(keep)
+	q.pending = keep
+	if q.acks >= compactEvery {
+		if err := q.compact(); err != nil {
+			return n, fmt.Errorf("compact: %s", err)
+		}
+	}
+	return n, nil
+}
+
+// DeadLetters returns the jobs that failed permanently, oldest first.
+func (q *file) DeadLetters() []DeadLetter {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	dead := make([]DeadLetter, 0, len(q.dead))
+	for _, rec := range q.dead {
+		dead = append(dead, *rec.Dead)
+	}
+	return dead
+}
+
+// Redrive puts all dead letters back into the jobqueue, and returns how many
+// there were.
+func (q *file) Redrive() (int, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	var n int
+	for len(q.dead) > 0 {
+		rec := q.dead[0]
+		if _, err := q.put(context.Background(), rec.Dead.Job); err != nil {
+			return n, fmt.Errorf("put: %s", err)
+		}
+		if err := q.append(record{Op: opAck, ID: rec.ID}); err != nil {
+			return n, fmt.Errorf("append: %s", err)
+		}
+		q.dead = q.dead[1:]
+		n++
+	}
+	return n, nil
+}
+
+// Put durably enqueues a job, and returns its ID: once it returns, the job
+// survives a restart. It does not block if the jobqueue is full, but returns
+// ErrQueueFull. Jobs replayed on startup count towards its capacity as well.
+func (q *file) Put(ctx context.Context, j Job) (string, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	return q.put(ctx, j)
+}
+
+// put is like Put, but callers must hold q.mu.
+func (q *file) put(ctx context.Context, j Job) (string, error) {
+	if err := ctx.Err(); err != nil {
+		return "", err
+	}
+	if q.closed {
+		return "", ErrClosed
+	}
+	waiting := len(q.pending)
+	if q.isBusy {
+		waiting--
+	}
+	if waiting >= q.capacity {
+		return "", ErrQueueFull
+	}
+	j, err := withID(j)
+	if err != nil {
+		return "", fmt.Errorf("withID: %s", err)
+	}
+	rec := record{Op: opPut, ID: q.nextID, JobID: j.ID, URI: j.URI, Requester: j.Requester}
+	if err := q.append(rec); err != nil {
+		return "", fmt.Errorf("append: %s", err)
+	}
+	q.nextID++
+	q.pending = append(q.pending, rec)
+
+	select {
+	case q.notify <- struct{}{}:
+	default:
+		// Consumer is already due to wake up.
+	}
+	return j.ID, nil
+}
@@ -0,0 +1,311 @@
+package jobqueue
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func tempLog(t *testing.T) (string, func()) {
+	t.Helper()
+
+	dir, err := ioutil.TempDir("", "sparty")
+	if err != nil {
+		t.Fatalf("Got %T (%s), expected nil", err, err)
+	}
+	return filepath.Join(dir, "jobs.log"), func() {
+		_ = os.RemoveAll(dir)
+	}
+}
+
+// consumeN consumes n jobs from q, and returns their URIs.
+func consumeN(t *testing.T, q *file, n int) []string {
+	t.Helper()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	var uris []string
+	err := q.Consume(ctx, func(j Job) error {
+		uris = append(uris, j.URI)
+		if len(uris) == n {
+			cancel()
+		}
+		return nil
+	})
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("Got %T (%s), expected context.Canceled", err, err)
+	}
+	return uris
+}
+
+func TestFileConsume(t *testing.T) {
+	path, cleanup := tempLog(t)
+	defer cleanup()
+
+	q, err := NewFile(path)
+	if err != nil {
+		t.Fatalf("Got %T (%s), expected nil", err, err)
+	}
+	defer func() {
+		_ = q.Close()
+	}()
+	for _, uri := range []string{"foo", "bar", "baz"} {
+		if _, err := q.Put(context.Background(), Job{URI: uri}); err != nil {
+			t.Errorf("Got %T (%s), expected nil", err, err)
+		}
+	}
+
+	if s := strings.Join(consumeN(t, q, 3), ","); s != "foo,bar,baz" {
+		t.Errorf("Got %q, expected foo,bar,baz", s)
+	}
+}
+
+func TestFileReplay(t *testing.T) {
+	t.Run("Unacknowledged", func(t *testing.T) {
+		path, cleanup := tempLog(t)
+		defer cleanup()
+
+		q, err := NewFile(path)
+		if err != nil {
+			t.Fatalf("Got %T (%s), expected nil", err, err)
+		}
+		for _, uri := range []string{"foo", "bar", "baz"} {
+			if _, err := q.Put(context.Background(), Job{URI: uri}); err != nil {
+				t.Errorf("Got %T (%s), expected nil", err, err)
+			}
+		}
+		if s := strings.Join(consumeN(t, q, 1), ","); s != "foo" {
+			t.Errorf("Got %q, expected foo", s)
+		}
+		if err := q.Close(); err != nil {
+			t.Errorf("Got %T (%s), expected nil", err, err)
+		}
+
+		q, err = NewFile(path)
+		if err != nil {
+			t.Fatalf("Got %T (%s), expected nil", err, err)
+		}
+		defer func() {
+			_ = q.Close()
+		}()
+		if _, err := q.Put(context.Background(), Job{URI: "qux"}); err != nil {
+			t.Errorf("Got %T (%s), expected nil", err, err)
+		}
+		if s := strings.Join(consumeN(t, q, 3), ","); s != "bar,baz,qux" {
+			t.Errorf("Got %q, expected bar,baz,qux", s)
+		}
+	})
+
+	t.Run("Requester", func(t *testing.T) {
+		path, cleanup := tempLog(t)
+		defer cleanup()
+
+		q, err := NewFile(path)
+		if err != nil {
+			t.Fatalf("Got %T (%s), expected nil", err, err)
+		}
+		if _, err := q.Put(context.Background(), Job{URI: "foo", Requester: "alice"}); err != nil {
+			t.Errorf("Got %T (%s), expected nil", err, err)
+		}
+		if err := q.Close(); err != nil {
+			t.Errorf("Got %T (%s), expected nil", err, err)
+		}
+
+		q, err = NewFile(path)
+		if err != nil {
+			t.Fatalf("Got %T (%s), expected nil", err, err)
+		}
+		defer func() {
+			_ = q.Close()
+		}()
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		_ = q.Consume(ctx, func(j Job) error {
+			if j.Requester != "alice" {
+				t.Errorf("Got %q, expected alice", j.Requester)
+			}
+			cancel()
+			return nil
+		})
+	})
+
+	t.Run("Partial record", func(t *testing.T) {
+		path, cleanup := tempLog(t)
+		defer cleanup()
+
+		log := `{"op":"put","id":0,"uri":"foo"}` + "\n" + `{"op":"put","id":1,"ur`
+		if err := ioutil.WriteFile(path, []byte(log), 0600); err != nil {
+			t.Fatalf("Got %T (%s), expected nil", err, err)
+		}
+
+		q, err := NewFile(path)
+		if err != nil {
+			t.Fatalf("Got %T (%s), expected nil", err, err)
+		}
+		defer func() {
+			_ = q.Close()
+		}()
+		if _, err := q.Put(context.Background(), Job{URI: "bar"}); err != nil {
+			t.Errorf("Got %T (%s), expected nil", err, err)
+		}
+		if s := strings.Join(consumeN(t, q, 2), ","); s != "foo,bar" {
+			t.Errorf("Got %q, expected foo,bar", s)
+		}
+	})
+
+	t.Run("Corrupt", func(t *testing.T) {
+		path, cleanup := tempLog(t)
+		defer cleanup()
+
+		log := `{"op":"put","id":0,"uri":"foo"}` + "\n" + "garbage\n" + `{"op":"put","id":1,"uri":"bar"}` + "\n"
+		if err := ioutil.WriteFile(path, []byte(log), 0600); err != nil {
+			t.Fatalf("Got %T (%s), expected nil", err, err)
+		}
+
+		if _, err := NewFile(path); err == nil {
+			t.Error("Got nil, expected error")
+		}
+	})
+}
+
+func TestFileCompact(t *testing.T) {
+	path, cleanup := tempLog(t)
+	defer cleanup()
+
+	q, err := NewFile(path, WithCapacity(compactEvery+1))
+	if err != nil {
+		t.Fatalf("Got %T (%s), expected nil", err, err)
+	}
+	defer func() {
+		_ = q.Close()
+	}()
+	for i := 0; i < compactEvery+1; i++ {
+		if _, err := q.Put(context.Background(), Job{ID: "bar", URI: "foo"}); err != nil {
+			t.Errorf("Got %T (%s), expected nil", err, err)
+		}
+	}
+	consumeN(t, q, compactEvery)
+
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatalf("Got %T (%s), expected nil", err, err)
+	}
+	exp := `{"op":"put","id":100,"job_id":"bar","uri":"foo"}` + "\n"
+	if s := string(b); s != exp {
+		t.Errorf("Got %q, expected %q", s, exp)
+	}
+}
+
+func TestFileClose(t *testing.T) {
+	path, cleanup := tempLog(t)
+	defer cleanup()
+
+	q, err := NewFile(path)
+	if err != nil {
+		t.Fatalf("Got %T (%s), expected nil", err, err)
+	}
+	if err := q.Close(); err != nil {
+		t.Errorf("Got %T (%s), expected nil", err, err)
+	}
+	if _, err := q.Put(context.Background(), Job{URI: "foo"}); !errors.Is(err, ErrClosed) {
+		t.Errorf("Got %T (%v), expected ErrClosed", err, err)
+	}
+	err = q.Consume(context.Background(), func(j Job) error {
+		t.Error("Unexpected call to fn")
+		return nil
+	})
+	if !errors.Is(err, ErrChannelClosed) {
+		t.Errorf("Got %T (%s), expected ErrChannelClosed", err, err)
+	}
+}
+
+func TestFileDeadLetters(t *testing.T) {
+	path, cleanup := tempLog(t)
+	defer cleanup()
+
+	q, err := NewFile(path, WithRetryPolicy(fastRetry))
+	if err != nil {
+		t.Fatalf("Got %T (%s), expected nil", err, err)
+	}
+	for _, uri := range []string{"foo", "bar"} {
+		if _, err := q.Put(context.Background(), Job{URI: uri}); err != nil {
+			t.Errorf("Got %T (%s), expected nil", err, err)
+		}
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	err = q.Consume(ctx, func(j Job) error {
+		if j.URI == "foo" {
+			return errors.New("some error")
+		}
+		cancel()
+		return nil
+	})
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("Got %T (%s), expected context.Canceled", err, err)
+	}
+	if err := q.Close(); err != nil {
+		t.Errorf("Got %T (%s), expected nil", err, err)
+	}
+
+	// Dead letters survive a restart.
+	q, err = NewFile(path, WithRetryPolicy(fastRetry))
+	if err != nil {
+		t.Fatalf("Got %T (%s), expected nil", err, err)
+	}
+	defer func() {
+		_ = q.Close()
+	}()
+	dead := q.DeadLetters()
+	if len(dead) != 1 {
+		t.Fatalf("Got %d, expected 1", len(dead))
+	}
+	if dead[0].URI != "foo" {
+		t.Errorf("Got %q, expected foo", dead[0].URI)
+	}
+	if dead[0].Err != "some error" {
+		t.Errorf("Got %q, expected some error", dead[0].Err)
+	}
+
+	n, err := q.Redrive()
+	if err != nil {
+		t.Errorf("Got %T (%s), expected nil", err, err)
+	}
+	if n != 1 {
+		t.Errorf("Got %d, expected 1", n)
+	}
+	if dead := q.DeadLetters(); len(dead) != 0 {
+		t.Errorf("Got %d, expected 0", len(dead))
+	}
+	if s := strings.Join(consumeN(t, q, 1), ","); s != "foo" {
+		t.Errorf("Got %q, expected foo", s)
+	}
+}
+
+func TestFilePending(t *testing.T) {
+	path, cleanup := tempLog(t)
+	defer cleanup()
+
+	q, err := NewFile(path)
+	if err != nil {
+		t.Fatalf("Got %T (%s), expected nil", err, err)
+	}
+	defer func() {
+		_ = q.Close()
+	}()
+	for _, uri := range []string{"foo", "bar"} {
+		if _, err := q.Put(context.Background(), Job{URI: uri, Requester: "alice"}); err != nil {
+			t.Errorf("Got %T (%s), expected nil", err, err)
+		}
+	}
+	if p := q.Pending(); len(p) != 2 || p[0].URI != "foo" || p[0].Requester != "alice" {
+		t.Errorf("Got %v, expected foo and bar", p)
+	}
+	consumeN(t, q, 1)
+	if p := q.Pending(); len(p) != 1 || p[0].URI != "bar" {
+		t.Errorf("Got %v, expected bar", p)
+	}
+}
@@ -0,0 +1,36 @@
+// Package jobqueue implements the queues that jobs, accepted by the API, wait
+// in until a worker sends them over to Spotify.
+package jobqueue
+
+import "errors"
+
+var (
+	// ErrQueueFull is returned when putting a job into a jobqueue that holds
+	// as many jobs waiting to be processed as its capacity.
+	ErrQueueFull = errors.New("jobqueue is full")
+	// ErrClosed is returned when putting a job into a jobqueue that was
+	// closed.
+	ErrClosed = errors.New("jobqueue was closed")
+)
+
+// DefaultCapacity is the number of jobs waiting to be processed a jobqueue
+// holds, unless overridden with WithCapacity.
+const DefaultCapacity = 100
+
+// WithCapacity overrides DefaultCapacity.
+func WithCapacity(n int) Option {
+	return func(o *options) {
+		o.capacity = n
+	}
+}
+
+// Job is a request to add a song to the user's Spotify queue.
+type Job struct {
+	// ID identifies the job. It is set when the job is put into a jobqueue,
+	// unless it was set already.
+	ID string `json:"id,omitempty"`
+	// URI is the Spotify URI of the track, album or playlist to add.
+	URI string `json:"uri"`
+	// Requester is the name of the guest that requested the song, if known.
+	Requester string `json:"requester,omitempty"`
+}
@@ -0,0 +1,77 @@
+package jobqueue
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+type boundedQueue interface {
+	Put(ctx context.Context, j Job) (string, error)
+	Consume(ctx context.Context, fn func(j Job) error) error
+	Len() int
+}
+
+func TestCapacity(t *testing.T) {
+	path, cleanup := tempLog(t)
+	defer cleanup()
+	f, err := NewFile(path, WithCapacity(2))
+	if err != nil {
+		t.Fatalf("Got %T (%s), expected nil", err, err)
+	}
+	defer func() {
+		_ = f.Close()
+	}()
+
+	for name, q := range map[string]boundedQueue{
+		"Memory": NewMemory(WithCapacity(2)),
+		"File":   f,
+		"Fair":   NewFair(WithCapacity(2)),
+	} {
+		t.Run(name, func(t *testing.T) {
+			for _, id := range []string{"foo", "bar"} {
+				if _, err := q.Put(context.Background(), Job{ID: id, URI: id}); err != nil {
+					t.Fatalf("Got %T (%s), expected nil", err, err)
+				}
+			}
+			if _, err := q.Put(context.Background(), Job{ID: "baz", URI: "baz"}); !errors.Is(err, ErrQueueFull) {
+				t.Errorf("Got %T (%v), expected ErrQueueFull", err, err)
+			}
+			if n := q.Len(); n != 2 {
+				t.Errorf("Got %d, expected 2", n)
+			}
+
+			// The job being processed no longer waits, so it makes room.
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			busy, release := make(chan struct{}), make(chan struct{})
+			done := make(chan struct{})
+			go func() {
+				defer close(done)
+				_ = q.Consume(ctx, func(j Job) error {
+					close(busy)
+					<-release
+					cancel()
+					return nil
+				})
+			}()
+			<-busy
+			if _, err := q.Put(context.Background(), Job{ID: "baz", URI: "baz"}); err != nil {
+				t.Errorf("Got %T (%s), expected nil", err, err)
+			}
+			if _, err := q.Put(context.Background(), Job{ID: "qux", URI: "qux"}); !errors.Is(err, ErrQueueFull) {
+				t.Errorf("Got %T (%v), expected ErrQueueFull", err, err)
+			}
+			close(release)
+			<-done
+		})
+	}
+
+	t.Run("Cancelled context", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		if _, err := NewMemory().Put(ctx, Job{URI: "foo"}); !errors.Is(err, context.Canceled) {
+			t.Errorf("Got %T (%v), expected context.Canceled", err, err)
+		}
+	})
+}
@@ -3,53 +3,195 @@ package jobqueue
 import (
 	"context"
 	"errors"
+	"fmt"
+	"sync"
 )
 
 // memory is a dead simple in-memory job queue that is only focused on
-// facilitating fast acceptance at the API level. It does not provide any other
-// "fancy" features like delays and retries.
+// facilitating fast acceptance at the API level. Jobs that fail are retried
+// according to its RetryPolicy, and kept as dead letters (in memory as well)
+// once it is exhausted.
 type memory struct {
-	consumer func(uri string)
-	ch       chan string
+	gate
+
+	ch    chan Job
+	retry RetryPolicy
+	// onDone is called once a job was processed.
+	onDone func(j Job, st Status)
+
+	mu     sync.Mutex
+	closed bool
+	// pending holds the jobs that were put but not processed yet, including
+	// the one being processed, in order.
+	pending  []Job
+	dead     []DeadLetter
+	statuses statuses
 }
 
 var ErrChannelClosed = errors.New("channel was closed")
 
-func NewMemory() *memory {
+func NewMemory(opts ...Option) *memory {
+	o := newOptions(opts)
 	return &memory{
-		ch: make(chan string, 100), // Arbitrary cap.
+		ch:     make(chan Job, o.capacity),
+		retry:  o.retry,
+		onDone: o.done,
 	}
 }
 
 func (m *memory) Close() error {
-	close(m.ch)
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if !m.closed {
+		m.closed = true
+		close(m.ch)
+	}
 	return nil
 }
 
 // Consume will watch the memory jobqueue for new jobs, and pass them on to fn
-// as they become available. Invocation blocks until the context is cancelled:
-// then, the context error is returned.
-func (m *memory) Consume(ctx context.Context, fn func(uri string)) error {
+// as they become available, unless it is paused. If fn returns an error, the
+// job is retried after a delay. Invocation blocks until the context is
+// cancelled: then, the context error is returned.
+func (m *memory) Consume(ctx context.Context, fn func(j Job) error) error {
 	for {
+		paused, err := m.wait(ctx)
+		if err != nil {
+			return err
+		}
 		select {
 		case <-ctx.Done():
 			return ctx.Err()
-		case uri, ok := <-m.ch:
+		case <-paused:
+		case j, ok := <-m.ch:
 			if !ok {
 				return ErrChannelClosed
 			}
-			// Block on fn so order is guaranteed and we won't flood the
-			// Spotify Web API. This won't impose performance bottlenecks as
-			// long as we're not going multi-tenant.
-			fn(uri)
+			// Block on fn (and its retries) so order is guaranteed and we
+			// won't flood the Spotify Web API. This won't impose performance
+			// bottlenecks as long as we're not going multi-tenant.
+			dl, err := m.retry.attempt(ctx, j, fn)
+			if err != nil {
+				return err
+			}
+			m.mu.Lock()
+			m.done(j)
+			m.statuses.set(j, statusOf(dl))
+			if dl != nil {
+				m.dead = appendDeadLetter(m.dead, *dl)
+			}
+			m.mu.Unlock()
+			m.onDone(j, statusOf(dl))
 		}
 	}
 }
 
-// Put enqueues a job. At the moment this never returns a non-nil error, but
-// return an error nonetheless to ease a potential migration towards a more
-// sophisticated jobqueue backend.
-func (m *memory) Put(uri string) error {
-	m.ch <- uri
-	return nil
+// done removes j from the pending jobs. Callers must hold m.mu.
+func (m *memory) done(j Job) {
+	for i, p := range m.pending {
+		if p == j {
+			m.pending = append(m.pending[:i], m.pending[i+1:]...)
+			return
+		}
+	}
+}
+
+// Pending returns the jobs that were put but not processed yet, oldest first.
+func (m *memory) Pending() []Job {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return append([]Job(nil), m.pending...)
+}
+
+// Len returns the number of jobs that were put but not processed yet.
+func (m *memory) Len() int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return len(m.pending)
+}
+
+// Clear drops the jobs that are waiting to be processed, and returns how many
+// there were. The job being processed, if any, is not affected.
+func (m *memory) Clear() (int, error) {
+	var n int
+	for {
+		select {
+		case j, ok := <-m.ch:
+			if !ok {
+				return n, nil
+			}
+			m.mu.Lock()
+			m.done(j)
+			m.statuses.set(j, Status{State: StateCleared})
+			m.mu.Unlock()
+			n++
+		default:
+			return n, nil
+		}
+	}
+}
+
+// Status returns the status of the job with the given ID. It returns false if
+// the job is not known, e.g. because it was processed long ago.
+func (m *memory) Status(id string) (Status, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.statuses.status(id, m.pending)
+}
+
+// DeadLetters returns the jobs that failed permanently, oldest first.
+func (m *memory) DeadLetters() []DeadLetter {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return append([]DeadLetter(nil), m.dead...)
+}
+
+// Redrive puts all dead letters back into the jobqueue, and returns how many
+// there were.
+func (m *memory) Redrive() (int, error) {
+	m.mu.Lock()
+	dead := m.dead
+	m.dead = nil
+	m.mu.Unlock()
+
+	for i, dl := range dead {
+		if _, err := m.Put(context.Background(), dl.Job); err != nil {
+			m.mu.Lock()
+			m.dead = append(dead[i:], m.dead...)
+			m.mu.Unlock()
+			return i, err
+		}
+	}
+	return len(dead), nil
+}
+
+// Put enqueues a job, and returns its ID. It does not block if the jobqueue is
+// full, but returns ErrQueueFull, so callers can push back rather than pile up
+// while the worker can't keep up.
+func (m *memory) Put(ctx context.Context, j Job) (string, error) {
+	if err := ctx.Err(); err != nil {
+		return "", err
+	}
+	j, err := withID(j)
+	if err != nil {
+		return "", fmt.Errorf("withID: %s", err)
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.closed {
+		return "", ErrClosed
+	}
+	select {
+	case m.ch <- j:
+	default:
+		return "", ErrQueueFull
+	}
+	m.pending = append(m.pending, j)
+	return j.ID, nil
 }
@@ -11,43 +11,55 @@ func TestClose(t *testing.T) {
 	if err := mem.Close(); err != nil {
 		t.Errorf("Got %T (%s), expected nil", err, err)
 	}
-	err := mem.Consume(context.Background(), func(uri string) {
+	err := mem.Consume(context.Background(), func(j Job) error {
 		t.Error("Unexpected call to fn")
+		return nil
 	})
 	if !errors.Is(err, ErrChannelClosed) {
 		t.Errorf("Got %T (%s), expected ErrChannelClosed", err, err)
 	}
+	// Closing twice is harmless, and putting after closing doesn't panic.
+	if err := mem.Close(); err != nil {
+		t.Errorf("Got %T (%s), expected nil", err, err)
+	}
+	if _, err := mem.Put(context.Background(), Job{URI: "foo"}); !errors.Is(err, ErrClosed) {
+		t.Errorf("Got %T (%v), expected ErrClosed", err, err)
+	}
+	if n := mem.Len(); n != 0 {
+		t.Errorf("Got %d, expected 0", n)
+	}
 }
 
 func TestConsume(t *testing.T) {
 	mem := NewMemory()
 	for _, uri := range []string{"foo", "bar", "baz"} {
-		if err := mem.Put(uri); err != nil {
+		if _, err := mem.Put(context.Background(), Job{URI: uri}); err != nil {
 			t.Errorf("Got %T (%s), expected nil", err, err)
 		}
 	}
 
 	ctx, cancel := context.WithCancel(context.Background())
 	var count int
-	fn := func(uri string) {
+	fn := func(j Job) error {
 		count++
 		switch count {
 		case 1:
-			if uri != "foo" {
-				t.Errorf("Got %q, expected foo", uri)
+			if j.URI != "foo" {
+				t.Errorf("Got %q, expected foo", j.URI)
 			}
 		case 2:
-			if uri != "bar" {
-				t.Errorf("Got %q, expected bar", uri)
+			if j.URI != "bar" {
+				t.Errorf("Got %q, expected bar", j.URI)
 			}
 		case 3:
-			if uri != "baz" {
-				t.Errorf("Got %q, expected baz", uri)
+			if j.URI != "baz" {
+				t.Errorf("Got %q, expected baz", j.URI)
 			}
 			cancel()
 		default:
 			cancel()
 		}
+		return nil
 	}
 	if err := mem.Consume(ctx, fn); !errors.Is(err, context.Canceled) {
 		t.Errorf("Got %T (%s), expected context.Canceled", err, err)
@@ -56,13 +68,97 @@ func TestConsume(t *testing.T) {
 
 func TestPut(t *testing.T) {
 	mem := NewMemory()
-	if err := mem.Put("foo"); err != nil {
+	if _, err := mem.Put(context.Background(), Job{URI: "foo"}); err != nil {
+		t.Errorf("Got %T (%s), expected nil", err, err)
+	}
+	if _, err := mem.Put(context.Background(), Job{URI: "bar"}); err != nil {
+		t.Errorf("Got %T (%s), expected nil", err, err)
+	}
+	if _, err := mem.Put(context.Background(), Job{URI: "baz"}); err != nil {
 		t.Errorf("Got %T (%s), expected nil", err, err)
 	}
-	if err := mem.Put("bar"); err != nil {
+}
+
+func TestDeadLetters(t *testing.T) {
+	mem := NewMemory(WithRetryPolicy(fastRetry))
+	if _, err := mem.Put(context.Background(), Job{URI: "foo"}); err != nil {
 		t.Errorf("Got %T (%s), expected nil", err, err)
 	}
-	if err := mem.Put("baz"); err != nil {
+	if _, err := mem.Put(context.Background(), Job{URI: "bar"}); err != nil {
 		t.Errorf("Got %T (%s), expected nil", err, err)
 	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	err := mem.Consume(ctx, func(j Job) error {
+		if j.URI == "foo" {
+			return errors.New("some error")
+		}
+		cancel()
+		return nil
+	})
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("Got %T (%s), expected context.Canceled", err, err)
+	}
+
+	dead := mem.DeadLetters()
+	if len(dead) != 1 {
+		t.Fatalf("Got %d, expected 1", len(dead))
+	}
+	if dead[0].URI != "foo" {
+		t.Errorf("Got %q, expected foo", dead[0].URI)
+	}
+	if dead[0].Attempts != 3 {
+		t.Errorf("Got %d, expected 3", dead[0].Attempts)
+	}
+
+	n, err := mem.Redrive()
+	if err != nil {
+		t.Errorf("Got %T (%s), expected nil", err, err)
+	}
+	if n != 1 {
+		t.Errorf("Got %d, expected 1", n)
+	}
+	if dead := mem.DeadLetters(); len(dead) != 0 {
+		t.Errorf("Got %d, expected 0", len(dead))
+	}
+
+	ctx, cancel = context.WithCancel(context.Background())
+	err = mem.Consume(ctx, func(j Job) error {
+		if j.URI != "foo" {
+			t.Errorf("Got %q, expected foo", j.URI)
+		}
+		cancel()
+		return nil
+	})
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("Got %T (%s), expected context.Canceled", err, err)
+	}
+}
+
+func TestPending(t *testing.T) {
+	mem := NewMemory()
+	for _, uri := range []string{"foo", "bar"} {
+		if _, err := mem.Put(context.Background(), Job{URI: uri, Requester: "alice"}); err != nil {
+			t.Errorf("Got %T (%s), expected nil", err, err)
+		}
+	}
+	if p := mem.Pending(); len(p) != 2 || p[0].URI != "foo" || p[1].URI != "bar" {
+		t.Errorf("Got %v, expected foo and bar", p)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	_ = mem.Consume(ctx, func(j Job) error {
+		// The job being processed is still pending.
+		if j.URI == "bar" {
+			if p := mem.Pending(); len(p) != 1 || p[0].URI != "bar" {
+				t.Errorf("Got %v, expected bar", p)
+			}
+			cancel()
+		}
+		return nil
+	})
+	if p := mem.Pending(); len(p) != 0 {
+		t.Errorf("Got %v, expected none", p)
+	}
 }
@@ -0,0 +1,74 @@
+package jobqueue
+
+import (
+	"context"
+	"sync"
+)
+
+// gate lets the consumer of a jobqueue be paused: while it is, jobs are still
+// put, but not taken. The zero value is open.
+type gate struct {
+	mu     sync.Mutex
+	paused bool
+	// changed is closed, and replaced, whenever paused changes.
+	changed chan struct{}
+}
+
+// Pause makes Consume hold off on taking jobs until Resume is called. Jobs are
+// still accepted meanwhile. A job that is being processed is finished first.
+func (g *gate) Pause() {
+	g.set(true)
+}
+
+// Resume makes Consume take jobs again after Pause.
+func (g *gate) Resume() {
+	g.set(false)
+}
+
+// Paused reports whether Consume was paused.
+func (g *gate) Paused() bool {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	return g.paused
+}
+
+func (g *gate) set(paused bool) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if g.paused == paused {
+		return
+	}
+	g.paused = paused
+	if g.changed != nil {
+		close(g.changed)
+		g.changed = nil
+	}
+}
+
+// wait blocks while the gate is paused, or until ctx is done. It returns a
+// channel that is closed once the gate is paused again, so consumers waiting
+// for jobs can stop doing so.
+func (g *gate) wait(ctx context.Context) (<-chan struct{}, error) {
+	for {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		g.mu.Lock()
+		if g.changed == nil {
+			g.changed = make(chan struct{})
+		}
+		paused, changed := g.paused, g.changed
+		g.mu.Unlock()
+
+		if !paused {
+			return changed, nil
+		}
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-changed:
+		}
+	}
+}
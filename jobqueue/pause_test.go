@@ -0,0 +1,97 @@
+package jobqueue
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+type pausableQueue interface {
+	Put(ctx context.Context, j Job) (string, error)
+	Consume(ctx context.Context, fn func(j Job) error) error
+	Pause()
+	Resume()
+	Paused() bool
+	Len() int
+}
+
+func TestPause(t *testing.T) {
+	path, cleanup := tempLog(t)
+	defer cleanup()
+	f, err := NewFile(path)
+	if err != nil {
+		t.Fatalf("Got %T (%s), expected nil", err, err)
+	}
+	defer func() {
+		_ = f.Close()
+	}()
+
+	for name, q := range map[string]pausableQueue{
+		"Memory": NewMemory(),
+		"File":   f,
+		"Fair":   NewFair(),
+	} {
+		t.Run(name, func(t *testing.T) {
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			consumed := make(chan Job)
+			done := make(chan struct{})
+			go func() {
+				defer close(done)
+				_ = q.Consume(ctx, func(j Job) error {
+					consumed <- j
+					return nil
+				})
+			}()
+
+			// Pause while the consumer waits for jobs.
+			q.Pause()
+			if !q.Paused() {
+				t.Error("Got false, expected true")
+			}
+			for _, id := range []string{"foo", "bar"} {
+				if _, err := q.Put(context.Background(), Job{ID: id, URI: id}); err != nil {
+					t.Fatalf("Got %T (%s), expected nil", err, err)
+				}
+			}
+			select {
+			case j := <-consumed:
+				t.Fatalf("Got %q, expected nothing to be consumed", j.ID)
+			case <-time.After(50 * time.Millisecond):
+			}
+			if n := q.Len(); n != 2 {
+				t.Errorf("Got %d, expected 2", n)
+			}
+
+			q.Resume()
+			if q.Paused() {
+				t.Error("Got true, expected false")
+			}
+			for _, exp := range []string{"foo", "bar"} {
+				select {
+				case j := <-consumed:
+					if j.ID != exp {
+						t.Errorf("Got %q, expected %q", j.ID, exp)
+					}
+				case <-time.After(time.Second):
+					t.Fatalf("Got nothing, expected %q to be consumed", exp)
+				}
+			}
+			cancel()
+			<-done
+			if n := q.Len(); n != 0 {
+				t.Errorf("Got %d, expected 0", n)
+			}
+		})
+	}
+
+	t.Run("Cancel while paused", func(t *testing.T) {
+		q := NewMemory()
+		q.Pause()
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		if err := q.Consume(ctx, func(j Job) error { return nil }); err != context.Canceled {
+			t.Errorf("Got %T (%s), expected context.Canceled", err, err)
+		}
+	})
+}
@@ -0,0 +1,150 @@
+package jobqueue
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"time"
+)
+
+// RetryPolicy configures how jobs are retried when the consumer fails to
+// process them. Retries are delayed with exponential backoff and jitter.
+type RetryPolicy struct {
+	// MaxAttempts is the maximum number of times a job is attempted, the
+	// first attempt included. Values below 1 are treated as 1.
+	MaxAttempts int
+	// BaseDelay is the delay before the first retry. It doubles for every
+	// subsequent retry, up to MaxDelay.
+	BaseDelay, MaxDelay time.Duration
+}
+
+// DefaultRetryPolicy retries a job for a little over a minute, which is
+// generally enough to ride out a network blip or a host that needs to wake up
+// their Spotify app.
+var DefaultRetryPolicy = RetryPolicy{
+	MaxAttempts: 5,
+	BaseDelay:   2 * time.Second,
+	MaxDelay:    30 * time.Second,
+}
+
+// Option configures optional behavior of a jobqueue.
+type Option func(o *options)
+
+type options struct {
+	retry    RetryPolicy
+	weights  map[string]int
+	done     func(j Job, st Status)
+	capacity int
+}
+
+func newOptions(opts []Option) options {
+	o := options{
+		retry:    DefaultRetryPolicy,
+		done:     func(Job, Status) {},
+		capacity: DefaultCapacity,
+	}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	return o
+}
+
+// WithRetryPolicy overrides DefaultRetryPolicy.
+func WithRetryPolicy(p RetryPolicy) Option {
+	return func(o *options) {
+		o.retry = p
+	}
+}
+
+// WithDoneFunc makes the jobqueue call fn once a job was processed: either
+// because it succeeded, or because it failed permanently. Fn is called from
+// the consuming goroutine, so it should return quickly.
+func WithDoneFunc(fn func(j Job, st Status)) Option {
+	return func(o *options) {
+		o.done = fn
+	}
+}
+
+// DeadLetter is a job that could not be processed, not even after retrying.
+type DeadLetter struct {
+	Job
+	Err      string    `json:"err"`
+	Attempts int       `json:"attempts"`
+	FailedAt time.Time `json:"failed_at"`
+}
+
+// maxDeadLetters caps the number of dead letters kept: the oldest are dropped
+// first.
+const maxDeadLetters = 1000
+
+func appendDeadLetter(dead []DeadLetter, dl DeadLetter) []DeadLetter {
+	dead = append(dead, dl)
+	if len(dead) > maxDeadLetters {
+		dead = dead[len(dead)-maxDeadLetters:]
+	}
+	return dead
+}
+
+type permanentError struct {
+	err error
+}
+
+func (e permanentError) Error() string {
+	return e.err.Error()
+}
+
+func (e permanentError) Unwrap() error {
+	return e.err
+}
+
+// Permanent marks err as a permanent failure: a job failing with such an error
+// is not retried, but moved to the dead letters right away.
+func Permanent(err error) error {
+	return permanentError{err: err}
+}
+
+// attempt calls fn for j until it succeeds, fails permanently or the policy is
+// exhausted. In the latter two cases, the job is returned as a dead letter. A
+// non-nil error is only returned if ctx is done while waiting for a retry.
+func (p RetryPolicy) attempt(ctx context.Context, j Job, fn func(j Job) error) (*DeadLetter, error) {
+	var err error
+	var n int
+	for n = 1; ; n++ {
+		if err = fn(j); err == nil {
+			return nil, nil
+		}
+		if errors.As(err, &permanentError{}) || n >= p.MaxAttempts {
+			break
+		}
+
+		t := time.NewTimer(p.delay(n))
+		select {
+		case <-ctx.Done():
+			t.Stop()
+			return nil, ctx.Err()
+		case <-t.C:
+		}
+	}
+	return &DeadLetter{
+		Job:      j,
+		Err:      err.Error(),
+		Attempts: n,
+		FailedAt: time.Now(),
+	}, nil
+}
+
+// delay returns how long to wait after the nth attempt failed. Jitter is
+// applied so the delay is somewhere between half and the full backoff.
+func (p RetryPolicy) delay(n int) time.Duration {
+	d := p.BaseDelay
+	for i := 1; i < n && d < p.MaxDelay; i++ {
+		d *= 2
+	}
+	if p.MaxDelay > 0 && d > p.MaxDelay {
+		d = p.MaxDelay
+	}
+	if d <= 0 {
+		return 0
+	}
+	return d/2 + time.Duration(rand.Int63n(int64(d/2)+1))
+}
@@ -0,0 +1,121 @@
+package jobqueue
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+var fastRetry = RetryPolicy{
+	MaxAttempts: 3,
+	BaseDelay:   time.Millisecond,
+	MaxDelay:    2 * time.Millisecond,
+}
+
+func TestAttempt(t *testing.T) {
+	t.Run("Eventual success", func(t *testing.T) {
+		var calls int
+		dl, err := fastRetry.attempt(context.Background(), Job{URI: "foo"}, func(j Job) error {
+			calls++
+			if calls < 3 {
+				return errors.New("some error")
+			}
+			return nil
+		})
+		if err != nil {
+			t.Errorf("Got %T (%s), expected nil", err, err)
+		}
+		if dl != nil {
+			t.Errorf("Got %+v, expected nil", dl)
+		}
+		if calls != 3 {
+			t.Errorf("Got %d, expected 3", calls)
+		}
+	})
+
+	t.Run("Exhausted", func(t *testing.T) {
+		var calls int
+		dl, err := fastRetry.attempt(context.Background(), Job{URI: "foo"}, func(j Job) error {
+			calls++
+			return errors.New("some error")
+		})
+		if err != nil {
+			t.Errorf("Got %T (%s), expected nil", err, err)
+		}
+		if dl == nil {
+			t.Fatal("Got nil, expected *DeadLetter")
+		}
+		if dl.URI != "foo" {
+			t.Errorf("Got %q, expected foo", dl.URI)
+		}
+		if dl.Err != "some error" {
+			t.Errorf("Got %q, expected some error", dl.Err)
+		}
+		if dl.Attempts != 3 {
+			t.Errorf("Got %d, expected 3", dl.Attempts)
+		}
+		if calls != 3 {
+			t.Errorf("Got %d, expected 3", calls)
+		}
+	})
+
+	t.Run("Permanent", func(t *testing.T) {
+		var calls int
+		dl, err := fastRetry.attempt(context.Background(), Job{URI: "foo"}, func(j Job) error {
+			calls++
+			return Permanent(errors.New("some error"))
+		})
+		if err != nil {
+			t.Errorf("Got %T (%s), expected nil", err, err)
+		}
+		if dl == nil {
+			t.Fatal("Got nil, expected *DeadLetter")
+		}
+		if dl.Attempts != 1 {
+			t.Errorf("Got %d, expected 1", dl.Attempts)
+		}
+		if calls != 1 {
+			t.Errorf("Got %d, expected 1", calls)
+		}
+	})
+
+	t.Run("Cancelled", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		p := RetryPolicy{MaxAttempts: 3, BaseDelay: time.Hour, MaxDelay: time.Hour}
+		_, err := p.attempt(ctx, Job{URI: "foo"}, func(j Job) error {
+			cancel()
+			return errors.New("some error")
+		})
+		if !errors.Is(err, context.Canceled) {
+			t.Errorf("Got %T (%v), expected context.Canceled", err, err)
+		}
+	})
+}
+
+func TestDelay(t *testing.T) {
+	p := RetryPolicy{BaseDelay: time.Second, MaxDelay: 5 * time.Second}
+	for _, tc := range []struct {
+		n        int
+		min, max time.Duration
+	}{
+		{1, 500 * time.Millisecond, time.Second},
+		{2, time.Second, 2 * time.Second},
+		{3, 2 * time.Second, 4 * time.Second},
+		{4, 2500 * time.Millisecond, 5 * time.Second},
+		{100, 2500 * time.Millisecond, 5 * time.Second},
+	} {
+		for i := 0; i < 100; i++ {
+			if d := p.delay(tc.n); d < tc.min || d > tc.max {
+				t.Fatalf("%d: Got %s, expected between %s and %s", tc.n, d, tc.min, tc.max)
+			}
+		}
+	}
+}
+
+func TestPermanent(t *testing.T) {
+	err := errors.New("some error")
+	if perr := Permanent(err); !errors.Is(perr, err) {
+		t.Errorf("Got %T (%s), expected to wrap %s", perr, perr, err)
+	}
+}
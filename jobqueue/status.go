@@ -0,0 +1,105 @@
+package jobqueue
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+)
+
+// State is where a job is in its lifecycle.
+type State string
+
+const (
+	// StatePending means the job waits in the jobqueue, or is being processed.
+	StatePending State = "pending"
+	// StateSent means the job was processed: its song was sent to Spotify.
+	StateSent State = "sent"
+	// StateFailed means the job could not be processed, not even after
+	// retrying. It is kept as a dead letter.
+	StateFailed State = "failed"
+	// StateCleared means the job was dropped from the jobqueue before it was
+	// processed.
+	StateCleared State = "cleared"
+)
+
+// Status is the status of a job.
+type Status struct {
+	State State
+	// Err is the error the job failed with, if it did.
+	Err string
+	// Requester is the Requester of the job.
+	Requester string
+}
+
+// maxStatuses caps the number of processed jobs whose status is kept: the
+// oldest are dropped first.
+const maxStatuses = 1000
+
+// statuses keeps the status of the jobs processed most recently. It is not
+// safe for concurrent use: callers guard it with the lock of their jobqueue.
+type statuses struct {
+	byID  map[string]Status
+	order []string
+}
+
+// set records the status of j, once it left the jobqueue.
+func (s *statuses) set(j Job, st Status) {
+	id := j.ID
+	st.Requester = j.Requester
+	if s.byID == nil {
+		s.byID = make(map[string]Status)
+	}
+	if _, ok := s.byID[id]; !ok {
+		s.order = append(s.order, id)
+	}
+	s.byID[id] = st
+	for len(s.order) > maxStatuses {
+		delete(s.byID, s.order[0])
+		s.order = s.order[1:]
+	}
+}
+
+// statusOf returns the status of a processed job, given its dead letter if it
+// failed.
+func statusOf(dl *DeadLetter) Status {
+	if dl != nil {
+		return Status{State: StateFailed, Err: dl.Err}
+	}
+	return Status{State: StateSent}
+}
+
+// status returns the status of the job with the given ID, given the jobs that
+// are pending.
+func (s *statuses) status(id string, pending []Job) (Status, bool) {
+	for _, j := range pending {
+		if j.ID == id {
+			return Status{State: StatePending, Requester: j.Requester}, true
+		}
+	}
+	st, ok := s.byID[id]
+	return st, ok
+}
+
+// withID gives j an ID from NewID, unless it has one already.
+func withID(j Job) (Job, error) {
+	if j.ID != "" {
+		return j, nil
+	}
+	id, err := NewID()
+	if err != nil {
+		return Job{}, err
+	}
+	j.ID = id
+	return j, nil
+}
+
+// NewID returns a random job ID. Songs that wait elsewhere before they are put
+// into a jobqueue, e.g. for approval, should get their ID from it as well, so
+// it does not collide with the IDs of jobs.
+func NewID() (string, error) {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("crypto/rand: Read: %s", err)
+	}
+	return hex.EncodeToString(b), nil
+}
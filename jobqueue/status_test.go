@@ -0,0 +1,196 @@
+package jobqueue
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+)
+
+type statusQueue interface {
+	Put(ctx context.Context, j Job) (string, error)
+	Consume(ctx context.Context, fn func(j Job) error) error
+	Status(id string) (Status, bool)
+	Clear() (int, error)
+}
+
+func TestStatus(t *testing.T) {
+	path, cleanup := tempLog(t)
+	defer cleanup()
+	f, err := NewFile(path, WithRetryPolicy(fastRetry))
+	if err != nil {
+		t.Fatalf("Got %T (%s), expected nil", err, err)
+	}
+	defer func() {
+		_ = f.Close()
+	}()
+
+	for name, q := range map[string]statusQueue{
+		"Memory": NewMemory(WithRetryPolicy(fastRetry)),
+		"File":   f,
+		"Fair":   NewFair(WithRetryPolicy(fastRetry)),
+	} {
+		t.Run(name, func(t *testing.T) {
+			foo, err := q.Put(context.Background(), Job{URI: "foo", Requester: "alice"})
+			if err != nil {
+				t.Fatalf("Got %T (%s), expected nil", err, err)
+			}
+			bar, err := q.Put(context.Background(), Job{ID: "bar", URI: "bar"})
+			if err != nil {
+				t.Fatalf("Got %T (%s), expected nil", err, err)
+			}
+			if foo == "" || foo == bar {
+				t.Errorf("Got %q, expected a new ID", foo)
+			}
+			if bar != "bar" {
+				t.Errorf("Got %q, expected bar", bar)
+			}
+			if st, ok := q.Status(foo); !ok || st.State != StatePending || st.Requester != "alice" {
+				t.Errorf("Got %+v (%t), expected pending by alice", st, ok)
+			}
+			if _, ok := q.Status("baz"); ok {
+				t.Error("Got true, expected false")
+			}
+
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			_ = q.Consume(ctx, func(j Job) error {
+				if j.ID == foo {
+					return errors.New("some error")
+				}
+				cancel()
+				return nil
+			})
+
+			if st, ok := q.Status(foo); !ok || st.State != StateFailed || st.Err != "some error" || st.Requester != "alice" {
+				t.Errorf("Got %+v (%t), expected failed with some error by alice", st, ok)
+			}
+			if st, ok := q.Status(bar); !ok || st.State != StateSent {
+				t.Errorf("Got %+v (%t), expected sent", st, ok)
+			}
+		})
+	}
+}
+
+func TestFileStatusReplay(t *testing.T) {
+	path, cleanup := tempLog(t)
+	defer cleanup()
+
+	q, err := NewFile(path, WithRetryPolicy(fastRetry))
+	if err != nil {
+		t.Fatalf("Got %T (%s), expected nil", err, err)
+	}
+	for _, id := range []string{"foo", "bar"} {
+		if _, err := q.Put(context.Background(), Job{ID: id, URI: id}); err != nil {
+			t.Errorf("Got %T (%s), expected nil", err, err)
+		}
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	_ = q.Consume(ctx, func(j Job) error {
+		cancel()
+		return Permanent(errors.New("some error"))
+	})
+	if err := q.Close(); err != nil {
+		t.Errorf("Got %T (%s), expected nil", err, err)
+	}
+
+	q, err = NewFile(path, WithRetryPolicy(fastRetry))
+	if err != nil {
+		t.Fatalf("Got %T (%s), expected nil", err, err)
+	}
+	defer func() {
+		_ = q.Close()
+	}()
+	if st, ok := q.Status("foo"); !ok || st.State != StateFailed || st.Err != "some error" {
+		t.Errorf("Got %+v (%t), expected failed with some error", st, ok)
+	}
+	if st, ok := q.Status("bar"); !ok || st.State != StatePending {
+		t.Errorf("Got %+v (%t), expected pending", st, ok)
+	}
+}
+
+func TestDoneFunc(t *testing.T) {
+	var done []string
+	q := NewMemory(WithRetryPolicy(fastRetry), WithDoneFunc(func(j Job, st Status) {
+		done = append(done, j.URI+":"+string(st.State)+":"+st.Err)
+	}))
+	for _, uri := range []string{"foo", "bar"} {
+		if _, err := q.Put(context.Background(), Job{URI: uri}); err != nil {
+			t.Errorf("Got %T (%s), expected nil", err, err)
+		}
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	_ = q.Consume(ctx, func(j Job) error {
+		if j.URI == "foo" {
+			return errors.New("some error")
+		}
+		cancel()
+		return nil
+	})
+
+	if s := strings.Join(done, ","); s != "foo:failed:some error,bar:sent:" {
+		t.Errorf("Got %q, expected foo:failed:some error,bar:sent:", s)
+	}
+}
+
+func TestClear(t *testing.T) {
+	path, cleanup := tempLog(t)
+	defer cleanup()
+	f, err := NewFile(path)
+	if err != nil {
+		t.Fatalf("Got %T (%s), expected nil", err, err)
+	}
+	defer func() {
+		_ = f.Close()
+	}()
+
+	for name, q := range map[string]statusQueue{
+		"Memory": NewMemory(),
+		"File":   f,
+		"Fair":   NewFair(),
+	} {
+		t.Run(name, func(t *testing.T) {
+			for _, id := range []string{"foo", "bar", "baz"} {
+				if _, err := q.Put(context.Background(), Job{ID: id, URI: id}); err != nil {
+					t.Fatalf("Got %T (%s), expected nil", err, err)
+				}
+			}
+
+			// Clear while foo is being processed.
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			busy, release := make(chan struct{}), make(chan struct{})
+			done := make(chan struct{})
+			go func() {
+				defer close(done)
+				_ = q.Consume(ctx, func(j Job) error {
+					if j.ID != "foo" {
+						t.Errorf("Got %q, expected foo", j.ID)
+					}
+					close(busy)
+					<-release
+					cancel()
+					return nil
+				})
+			}()
+			<-busy
+			n, err := q.Clear()
+			if err != nil {
+				t.Errorf("Got %T (%s), expected nil", err, err)
+			}
+			if n != 2 {
+				t.Errorf("Got %d, expected 2", n)
+			}
+			close(release)
+			<-done
+
+			if st, ok := q.Status("foo"); !ok || st.State != StateSent {
+				t.Errorf("Got %+v (%t), expected sent", st, ok)
+			}
+			if st, ok := q.Status("bar"); !ok || st.State != StateCleared {
+				t.Errorf("Got %+v (%t), expected cleared", st, ok)
+			}
+		})
+	}
+}
@@ -0,0 +1,275 @@
+// Package partyqueue implements a queue of songs guests can vote on. Rather
+// than sending every song to Spotify right away, where the queue is strictly
+// first come, first served, songs wait in the party queue until the track that
+// is playing is about to end. Only then the song with the most votes is sent,
+// so Spotify's own queue is at most one song deep.
+package partyqueue
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/epels/sparty/jobqueue"
+	"github.com/epels/sparty/spotify"
+)
+
+// ErrNotFound is returned when voting on a song that is not in the queue.
+var ErrNotFound = errors.New("song not found")
+
+// Votes a guest can cast on a song.
+const (
+	Down = -1
+	None = 0
+	Up   = 1
+)
+
+// Item is a song in the party queue.
+type Item struct {
+	ID          string    `json:"id"`
+	URI         string    `json:"uri"`
+	Requester   string    `json:"requester,omitempty"`
+	RequestedAt time.Time `json:"requested_at"`
+	// Score is the number of up votes minus the number of down votes.
+	Score int `json:"score"`
+}
+
+type entry struct {
+	Item
+	seq   uint64
+	votes map[string]int
+}
+
+type queue struct {
+	capacity int
+
+	mu      sync.Mutex
+	nextSeq uint64
+	entries []*entry
+
+	// nowFunc returns the current local time. Can be used to instrument tests.
+	nowFunc func() time.Time
+}
+
+// DefaultCapacity is the number of songs the party queue holds, unless
+// overridden with WithCapacity.
+const DefaultCapacity = 100
+
+// Option configures optional behavior of the party queue.
+type Option func(q *queue)
+
+// WithCapacity overrides DefaultCapacity.
+func WithCapacity(n int) Option {
+	return func(q *queue) {
+		q.capacity = n
+	}
+}
+
+func New(opts ...Option) *queue {
+	q := queue{
+		capacity: DefaultCapacity,
+		nowFunc:  time.Now,
+	}
+	for _, opt := range opts {
+		opt(&q)
+	}
+	return &q
+}
+
+// Put adds the song in j to the party queue, and returns its ID: that of j if
+// it has one, or a new one otherwise. The song keeps this ID once it is put
+// into the jobqueue. Like a jobqueue, it returns jobqueue.ErrQueueFull rather
+// than growing beyond its capacity.
+func (q *queue) Put(ctx context.Context, j jobqueue.Job) (string, error) {
+	if err := ctx.Err(); err != nil {
+		return "", err
+	}
+	id := j.ID
+	if id == "" {
+		var err error
+		if id, err = jobqueue.NewID(); err != nil {
+			return "", fmt.Errorf("jobqueue: NewID: %s", err)
+		}
+	}
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if len(q.entries) >= q.capacity {
+		return "", jobqueue.ErrQueueFull
+	}
+	q.nextSeq++
+	q.entries = append(q.entries, &entry{
+		Item: Item{
+			ID:          id,
+			URI:         j.URI,
+			Requester:   j.Requester,
+			RequestedAt: q.nowFunc(),
+		},
+		seq:   q.nextSeq,
+		votes: make(map[string]int),
+	})
+	return id, nil
+}
+
+// Items returns the songs in the party queue, in the order they will be played:
+// by score, and then first come, first served.
+func (q *queue) Items() []Item {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	items := make([]Item, 0, len(q.entries))
+	for _, e := range q.sorted() {
+		items = append(items, e.Item)
+	}
+	return items
+}
+
+// Pending returns the songs in the party queue as jobs, in the order they will
+// be played.
+func (q *queue) Pending() []jobqueue.Job {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	jobs := make([]jobqueue.Job, 0, len(q.entries))
+	for _, e := range q.sorted() {
+		jobs = append(jobs, jobqueue.Job{URI: e.URI, Requester: e.Requester})
+	}
+	return jobs
+}
+
+// Vote records the vote of voter (Up, Down or None to withdraw it) on the song
+// with the given ID. Every voter has one vote per song.
+func (q *queue) Vote(id, voter string, vote int) error {
+	if vote < Down || vote > Up {
+		return fmt.Errorf("invalid vote %d", vote)
+	}
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	for _, e := range q.entries {
+		if e.ID != id {
+			continue
+		}
+		e.Score += vote - e.votes[voter]
+		if vote == None {
+			delete(e.votes, voter)
+		} else {
+			e.votes[voter] = vote
+		}
+		return nil
+	}
+	return ErrNotFound
+}
+
+// peek returns the entry of the song that is up next.
+func (q *queue) peek() (*entry, bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if len(q.entries) == 0 {
+		return nil, false
+	}
+	return q.sorted()[0], true
+}
+
+// remove removes e from the queue.
+func (q *queue) remove(e *entry) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	for i, o := range q.entries {
+		if o == e {
+			q.entries = append(q.entries[:i], q.entries[i+1:]...)
+			return
+		}
+	}
+}
+
+// sorted returns the entries in the order they will be played. Callers must
+// hold q.mu.
+func (q *queue) sorted() []*entry {
+	es := append([]*entry(nil), q.entries...)
+	sort.Slice(es, func(i, j int) bool {
+		if es[i].Score != es[j].Score {
+			return es[i].Score > es[j].Score
+		}
+		return es[i].seq < es[j].seq
+	})
+	return es
+}
+
+type player interface {
+	// CurrentlyPlaying returns what is playing, or nil if nothing is.
+	CurrentlyPlaying(ctx context.Context) (*spotify.CurrentlyPlaying, error)
+}
+
+type putter interface {
+	Put(ctx context.Context, j jobqueue.Job) (string, error)
+}
+
+// Schedule polls p every interval, and puts the song that is up next into jq
+// once the track that is playing has less than lead left to play, or if nothing
+// is playing. It does so once per track. Errors are logged to errLog, after
+// which it tries again upon the next poll. Invocation blocks until the context
+// is cancelled: then, the context error is returned.
+func (q *queue) Schedule(ctx context.Context, p player, jq putter, interval, lead time.Duration, errLog *log.Logger) error {
+	t := time.NewTicker(interval)
+	defer t.Stop()
+
+	var s scheduler
+	for {
+		if err := s.tick(ctx, q, p, jq, lead); err != nil && ctx.Err() == nil {
+			errLog.Printf("partyqueue: Schedule: %s", err)
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-t.C:
+		}
+	}
+}
+
+// scheduler keeps track of the songs sent, so only one song is sent per track.
+type scheduler struct {
+	fed bool
+	// fedFor is the ID of the track that was playing when a song was last
+	// sent, or empty if nothing was.
+	fedFor string
+}
+
+func (s *scheduler) tick(ctx context.Context, q *queue, p player, jq putter, lead time.Duration) error {
+	cctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	cp, err := p.CurrentlyPlaying(cctx)
+	cancel()
+	if err != nil {
+		return fmt.Errorf("%T: CurrentlyPlaying: %w", p, err)
+	}
+
+	var playing string
+	if cp != nil && cp.IsPlaying && cp.Item != nil {
+		playing = cp.Item.ID
+		if cp.Remaining() > lead {
+			return nil
+		}
+	}
+	if s.fed && s.fedFor == playing {
+		return nil
+	}
+
+	e, ok := q.peek()
+	if !ok {
+		return nil
+	}
+	// If the jobqueue is full, the song stays up next until the next poll.
+	if _, err := jq.Put(ctx, jobqueue.Job{ID: e.ID, URI: e.URI, Requester: e.Requester}); err != nil {
+		return fmt.Errorf("%T: Put: %w", jq, err)
+	}
+	q.remove(e)
+	s.fed, s.fedFor = true, playing
+	return nil
+}
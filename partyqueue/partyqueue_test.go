@@ -0,0 +1,225 @@
+package partyqueue
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/epels/sparty/internal/mock"
+	"github.com/epels/sparty/jobqueue"
+	"github.com/epels/sparty/spotify"
+)
+
+func uris(items []Item) string {
+	var ss []string
+	for _, it := range items {
+		ss = append(ss, it.URI)
+	}
+	return strings.Join(ss, ",")
+}
+
+// newQueue returns a queue with the songs in uris, and their IDs.
+func newQueue(t *testing.T, uris ...string) (*queue, []string) {
+	t.Helper()
+
+	q := New()
+	var ids []string
+	for _, uri := range uris {
+		id, err := q.Put(context.Background(), jobqueue.Job{URI: uri, Requester: "alice"})
+		if err != nil {
+			t.Fatalf("Got %T (%s), expected nil", err, err)
+		}
+		ids = append(ids, id)
+	}
+	return q, ids
+}
+
+func TestVote(t *testing.T) {
+	t.Run("Order", func(t *testing.T) {
+		q, ids := newQueue(t, "foo", "bar", "baz")
+		if s := uris(q.Items()); s != "foo,bar,baz" {
+			t.Errorf("Got %q, expected foo,bar,baz", s)
+		}
+
+		for _, v := range []struct {
+			id, voter string
+			vote      int
+		}{
+			{ids[2], "alice", Up},
+			{ids[2], "bob", Up},
+			{ids[1], "alice", Up},
+			{ids[0], "bob", Down},
+		} {
+			if err := q.Vote(v.id, v.voter, v.vote); err != nil {
+				t.Errorf("Got %T (%s), expected nil", err, err)
+			}
+		}
+		items := q.Items()
+		if s := uris(items); s != "baz,bar,foo" {
+			t.Errorf("Got %q, expected baz,bar,foo", s)
+		}
+		if items[0].Score != 2 || items[2].Score != -1 {
+			t.Errorf("Got %d and %d, expected 2 and -1", items[0].Score, items[2].Score)
+		}
+	})
+
+	t.Run("One vote per voter", func(t *testing.T) {
+		q, ids := newQueue(t, "foo")
+		for _, vote := range []int{Up, Up, Down} {
+			if err := q.Vote(ids[0], "alice", vote); err != nil {
+				t.Errorf("Got %T (%s), expected nil", err, err)
+			}
+		}
+		if s := q.Items()[0].Score; s != -1 {
+			t.Errorf("Got %d, expected -1", s)
+		}
+		if err := q.Vote(ids[0], "alice", None); err != nil {
+			t.Errorf("Got %T (%s), expected nil", err, err)
+		}
+		if s := q.Items()[0].Score; s != 0 {
+			t.Errorf("Got %d, expected 0", s)
+		}
+	})
+
+	t.Run("Not found", func(t *testing.T) {
+		q, _ := newQueue(t, "foo")
+		if err := q.Vote("bar", "alice", Up); !errors.Is(err, ErrNotFound) {
+			t.Errorf("Got %v, expected %v", err, ErrNotFound)
+		}
+	})
+
+	t.Run("Invalid", func(t *testing.T) {
+		q, ids := newQueue(t, "foo")
+		if err := q.Vote(ids[0], "alice", 2); err == nil {
+			t.Error("Got nil, expected error")
+		}
+	})
+}
+
+func TestPut(t *testing.T) {
+	t.Run("Full", func(t *testing.T) {
+		q := New(WithCapacity(1))
+		if _, err := q.Put(context.Background(), jobqueue.Job{URI: "foo"}); err != nil {
+			t.Fatalf("Got %T (%s), expected nil", err, err)
+		}
+		if _, err := q.Put(context.Background(), jobqueue.Job{URI: "bar"}); !errors.Is(err, jobqueue.ErrQueueFull) {
+			t.Errorf("Got %v, expected %v", err, jobqueue.ErrQueueFull)
+		}
+		if s := uris(q.Items()); s != "foo" {
+			t.Errorf("Got %q, expected foo", s)
+		}
+	})
+
+	t.Run("Unique IDs", func(t *testing.T) {
+		_, ids := newQueue(t, "foo", "bar")
+		if ids[0] == "" || ids[0] == ids[1] {
+			t.Errorf("Got %q, expected unique IDs", ids)
+		}
+	})
+
+	t.Run("Kept ID", func(t *testing.T) {
+		q := New()
+		id, err := q.Put(context.Background(), jobqueue.Job{ID: "foo", URI: "bar"})
+		if err != nil {
+			t.Fatalf("Got %T (%s), expected nil", err, err)
+		}
+		if id != "foo" || q.Items()[0].ID != "foo" {
+			t.Errorf("Got %q, expected foo", id)
+		}
+	})
+}
+
+func TestTick(t *testing.T) {
+	var cp *spotify.CurrentlyPlaying
+	p := mock.Player{
+		CurrentlyPlayingFunc: func(ctx context.Context) (*spotify.CurrentlyPlaying, error) {
+			return cp, nil
+		},
+	}
+	playing := func(id string, progress time.Duration) *spotify.CurrentlyPlaying {
+		return &spotify.CurrentlyPlaying{
+			IsPlaying:  true,
+			ProgressMS: int(progress / time.Millisecond),
+			Item:       &spotify.Track{ID: id, DurationMS: 180000},
+		}
+	}
+	var put, ids []string
+	jq := mock.Jobqueue{
+		PutFunc: func(ctx context.Context, j jobqueue.Job) (string, error) {
+			put = append(put, j.URI)
+			ids = append(ids, j.ID)
+			return j.ID, nil
+		},
+	}
+
+	q, queued := newQueue(t, "foo", "bar", "baz")
+	if err := q.Vote(queued[1], "bob", Up); err != nil {
+		t.Fatalf("Got %T (%s), expected nil", err, err)
+	}
+	var s scheduler
+	for i, step := range []struct {
+		cp  *spotify.CurrentlyPlaying
+		exp string
+	}{
+		// Nothing is playing: send a song once.
+		{nil, "bar"},
+		{nil, "bar"},
+		// Far from the end.
+		{playing("a", time.Minute), "bar"},
+		// Near the end: send a song once.
+		{playing("a", 170*time.Second), "bar,foo"},
+		{playing("a", 175*time.Second), "bar,foo"},
+		{playing("b", 10*time.Second), "bar,foo"},
+		{playing("b", 165*time.Second), "bar,foo,baz"},
+		// The queue is empty.
+		{playing("c", 175*time.Second), "bar,foo,baz"},
+	} {
+		cp = step.cp
+		if err := s.tick(context.Background(), q, p, jq, 20*time.Second); err != nil {
+			t.Errorf("%d: Got %T (%s), expected nil", i, err, err)
+		}
+		if got := strings.Join(put, ","); got != step.exp {
+			t.Errorf("%d: Got %q, expected %q", i, got, step.exp)
+		}
+	}
+	// Songs keep their ID in the jobqueue.
+	if exp := strings.Join([]string{queued[1], queued[0], queued[2]}, ","); strings.Join(ids, ",") != exp {
+		t.Errorf("Got %q, expected %q", strings.Join(ids, ","), exp)
+	}
+}
+
+func TestTickPutFailed(t *testing.T) {
+	p := mock.Player{
+		CurrentlyPlayingFunc: func(ctx context.Context) (*spotify.CurrentlyPlaying, error) {
+			return nil, nil
+		},
+	}
+	fail := true
+	jq := mock.Jobqueue{
+		PutFunc: func(ctx context.Context, j jobqueue.Job) (string, error) {
+			if fail {
+				return "", errors.New("some error")
+			}
+			return "", nil
+		},
+	}
+
+	q, _ := newQueue(t, "foo")
+	var s scheduler
+	if err := s.tick(context.Background(), q, p, jq, 20*time.Second); err == nil {
+		t.Error("Got nil, expected error")
+	}
+	// The song stays in the queue, and is sent upon the next try.
+	if s := uris(q.Items()); s != "foo" {
+		t.Errorf("Got %q, expected foo", s)
+	}
+	fail = false
+	if err := s.tick(context.Background(), q, p, jq, 20*time.Second); err != nil {
+		t.Errorf("Got %T (%s), expected nil", err, err)
+	}
+	if n := len(q.Items()); n != 0 {
+		t.Errorf("Got %d, expected 0", n)
+	}
+}
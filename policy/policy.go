@@ -0,0 +1,255 @@
+// Package policy decides which songs may be played, according to rules set by
+// the host: no explicit tracks, no songs that are too long, no artists on the
+// ban list, and so on.
+package policy
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/epels/sparty/spotify"
+	"github.com/epels/sparty/spotifyurl"
+)
+
+// Names of the rules, as reported by a Violation.
+const (
+	RuleExplicit     = "no_explicit"
+	RuleMinDuration  = "min_duration"
+	RuleMaxDuration  = "max_duration"
+	RuleDenyTracks   = "deny_tracks"
+	RuleAllowTracks  = "allow_tracks"
+	RuleDenyArtists  = "deny_artists"
+	RuleAllowArtists = "allow_artists"
+	RuleDenyGenres   = "deny_genres"
+	RuleAllowGenres  = "allow_genres"
+)
+
+// Policy is a set of rules songs must satisfy. The zero value allows anything.
+//
+// Tracks and artists in the lists are matched by name (case insensitive), or by
+// Spotify link or URI. Genres are matched against the genres of all of a
+// track's artists by name (case insensitive). An allow list, if not empty,
+// requires a song to match at least one of its entries.
+type Policy struct {
+	NoExplicit   bool     `json:"no_explicit,omitempty"`
+	MinDuration  Duration `json:"min_duration,omitempty"`
+	MaxDuration  Duration `json:"max_duration,omitempty"`
+	DenyTracks   []string `json:"deny_tracks,omitempty"`
+	AllowTracks  []string `json:"allow_tracks,omitempty"`
+	DenyArtists  []string `json:"deny_artists,omitempty"`
+	AllowArtists []string `json:"allow_artists,omitempty"`
+	DenyGenres   []string `json:"deny_genres,omitempty"`
+	AllowGenres  []string `json:"allow_genres,omitempty"`
+}
+
+// Duration is a time.Duration that is encoded in JSON as a string like 8m30s.
+type Duration time.Duration
+
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).String())
+}
+
+func (d *Duration) UnmarshalJSON(b []byte) error {
+	var s string
+	if err := json.Unmarshal(b, &s); err != nil {
+		return fmt.Errorf("encoding/json: Unmarshal: %w", err)
+	}
+	v, err := time.ParseDuration(s)
+	if err != nil {
+		return fmt.Errorf("time: ParseDuration: %w", err)
+	}
+	*d = Duration(v)
+	return nil
+}
+
+// Load reads a policy from the JSON file at path.
+func Load(path string) (Policy, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return Policy{}, fmt.Errorf("io/ioutil: ReadFile: %w", err)
+	}
+	var p Policy
+	if err := json.Unmarshal(b, &p); err != nil {
+		return Policy{}, fmt.Errorf("encoding/json: Unmarshal: %w", err)
+	}
+	return p, nil
+}
+
+// Violation is returned for songs that violate a rule of the policy.
+type Violation struct {
+	// Rule is the name of the rule that was violated, e.g. RuleExplicit.
+	Rule   string
+	Reason string
+}
+
+func (v *Violation) Error() string {
+	return fmt.Sprintf("policy: violates rule %s: %s", v.Rule, v.Reason)
+}
+
+// isZero reports whether p allows anything, so songs need not be looked up.
+func (p Policy) isZero() bool {
+	return !p.NoExplicit && p.MinDuration == 0 && p.MaxDuration == 0 &&
+		len(p.DenyTracks) == 0 && len(p.AllowTracks) == 0 &&
+		len(p.DenyArtists) == 0 && len(p.AllowArtists) == 0 && !p.needsGenres()
+}
+
+// needsGenres reports whether evaluating p requires the genres of a track.
+func (p Policy) needsGenres() bool {
+	return len(p.DenyGenres) > 0 || len(p.AllowGenres) > 0
+}
+
+// Evaluate returns the first rule of p that t violates, or nil if it satisfies
+// all of them. Genres are the genres of t's artists.
+func (p Policy) Evaluate(t spotify.Track, genres []string) *Violation {
+	for _, e := range p.DenyTracks {
+		if matches(e, t.ID, t.Name) {
+			return &Violation{Rule: RuleDenyTracks, Reason: fmt.Sprintf("%q is not allowed", t.Name)}
+		}
+	}
+	if len(p.AllowTracks) > 0 && !anyMatches(p.AllowTracks, t.ID, t.Name) {
+		return &Violation{Rule: RuleAllowTracks, Reason: fmt.Sprintf("%q is not on the list of allowed tracks", t.Name)}
+	}
+	for _, a := range t.Artists {
+		for _, e := range p.DenyArtists {
+			if matches(e, a.ID, a.Name) {
+				return &Violation{Rule: RuleDenyArtists, Reason: fmt.Sprintf("%s is not allowed", a.Name)}
+			}
+		}
+	}
+	if len(p.AllowArtists) > 0 {
+		var ok bool
+		for _, a := range t.Artists {
+			ok = ok || anyMatches(p.AllowArtists, a.ID, a.Name)
+		}
+		if !ok {
+			return &Violation{Rule: RuleAllowArtists, Reason: "none of its artists are on the list of allowed artists"}
+		}
+	}
+	if p.NoExplicit && t.Explicit {
+		return &Violation{Rule: RuleExplicit, Reason: "explicit tracks are not allowed"}
+	}
+	d := time.Duration(t.DurationMS) * time.Millisecond
+	if p.MinDuration > 0 && d < time.Duration(p.MinDuration) {
+		return &Violation{Rule: RuleMinDuration, Reason: fmt.Sprintf("tracks must be at least %s long", time.Duration(p.MinDuration))}
+	}
+	if p.MaxDuration > 0 && d > time.Duration(p.MaxDuration) {
+		return &Violation{Rule: RuleMaxDuration, Reason: fmt.Sprintf("tracks must be at most %s long", time.Duration(p.MaxDuration))}
+	}
+	for _, g := range genres {
+		for _, e := range p.DenyGenres {
+			if strings.EqualFold(strings.TrimSpace(e), g) {
+				return &Violation{Rule: RuleDenyGenres, Reason: fmt.Sprintf("%s is not allowed", g)}
+			}
+		}
+	}
+	if len(p.AllowGenres) > 0 {
+		var ok bool
+		for _, g := range genres {
+			for _, e := range p.AllowGenres {
+				ok = ok || strings.EqualFold(strings.TrimSpace(e), g)
+			}
+		}
+		if !ok {
+			return &Violation{Rule: RuleAllowGenres, Reason: "none of its genres are on the list of allowed genres"}
+		}
+	}
+	return nil
+}
+
+// matches reports whether the list entry e refers to the track or artist with
+// the given ID and name.
+func matches(e, id, name string) bool {
+	if l, err := spotifyurl.Parse(e); err == nil {
+		return l.ID == id
+	}
+	return strings.EqualFold(strings.TrimSpace(e), name)
+}
+
+func anyMatches(list []string, id, name string) bool {
+	for _, e := range list {
+		if matches(e, id, name) {
+			return true
+		}
+	}
+	return false
+}
+
+type catalog interface {
+	GetTrack(ctx context.Context, id string) (spotify.Track, error)
+	// GetArtists gets artists including their genres.
+	GetArtists(ctx context.Context, ids []string) ([]spotify.Artist, error)
+}
+
+// engine evaluates a policy, that can be changed at any time, against songs it
+// looks up in the Spotify catalog.
+type engine struct {
+	c catalog
+
+	mu sync.RWMutex
+	p  Policy
+}
+
+func NewEngine(c catalog, p Policy) *engine {
+	return &engine{c: c, p: p}
+}
+
+// Policy returns the policy currently in effect.
+func (e *engine) Policy() Policy {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+
+	return e.p
+}
+
+// SetPolicy replaces the policy in effect by p.
+func (e *engine) SetPolicy(p Policy) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	e.p = p
+}
+
+// Check checks whether the song uri refers to satisfies the policy. If not, a
+// *Violation is returned. Only tracks are checked: albums and playlists should
+// be checked track by track once expanded.
+func (e *engine) Check(ctx context.Context, uri string) error {
+	p := e.Policy()
+	if p.isZero() {
+		return nil
+	}
+	l, err := spotifyurl.Parse(uri)
+	if err != nil {
+		return fmt.Errorf("spotifyurl: Parse: %w", err)
+	}
+	if l.Type != spotifyurl.TypeTrack {
+		return nil
+	}
+
+	t, err := e.c.GetTrack(ctx, l.ID)
+	if err != nil {
+		return fmt.Errorf("%T: GetTrack: %w", e.c, err)
+	}
+	var genres []string
+	if p.needsGenres() && len(t.Artists) > 0 {
+		ids := make([]string, 0, len(t.Artists))
+		for _, a := range t.Artists {
+			ids = append(ids, a.ID)
+		}
+		artists, err := e.c.GetArtists(ctx, ids)
+		if err != nil {
+			return fmt.Errorf("%T: GetArtists: %w", e.c, err)
+		}
+		for _, a := range artists {
+			genres = append(genres, a.Genres...)
+		}
+	}
+	if v := p.Evaluate(t, genres); v != nil {
+		return v
+	}
+	return nil
+}
@@ -0,0 +1,165 @@
+package policy
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/epels/sparty/internal/mock"
+	"github.com/epels/sparty/spotify"
+)
+
+var bohemianRhapsody = spotify.Track{
+	ID:         "4u7EnebtmKWzUH433cf5Qv",
+	URI:        "spotify:track:4u7EnebtmKWzUH433cf5Qv",
+	Name:       "Bohemian Rhapsody",
+	DurationMS: 354320,
+	Artists:    []spotify.Artist{{ID: "1dfeR4HaWDbWqFHLkxsg1d", Name: "Queen"}},
+}
+
+func TestEvaluate(t *testing.T) {
+	explicit := bohemianRhapsody
+	explicit.Explicit = true
+
+	for _, tc := range []struct {
+		name   string
+		p      Policy
+		t      spotify.Track
+		genres []string
+		rule   string
+	}{
+		{"Zero", Policy{}, explicit, nil, ""},
+		{"Explicit", Policy{NoExplicit: true}, explicit, nil, RuleExplicit},
+		{"Not explicit", Policy{NoExplicit: true}, bohemianRhapsody, nil, ""},
+		{"Too short", Policy{MinDuration: Duration(6 * time.Minute)}, bohemianRhapsody, nil, RuleMinDuration},
+		{"Too long", Policy{MaxDuration: Duration(5 * time.Minute)}, bohemianRhapsody, nil, RuleMaxDuration},
+		{"Within duration bounds", Policy{MinDuration: Duration(time.Minute), MaxDuration: Duration(6 * time.Minute)}, bohemianRhapsody, nil, ""},
+		{"Denied track by name", Policy{DenyTracks: []string{"bohemian rhapsody"}}, bohemianRhapsody, nil, RuleDenyTracks},
+		{"Denied track by link", Policy{DenyTracks: []string{"https://open.spotify.com/track/4u7EnebtmKWzUH433cf5Qv"}}, bohemianRhapsody, nil, RuleDenyTracks},
+		{"Allowed track", Policy{AllowTracks: []string{"spotify:track:4u7EnebtmKWzUH433cf5Qv"}}, bohemianRhapsody, nil, ""},
+		{"Not an allowed track", Policy{AllowTracks: []string{"Don't Stop Me Now"}}, bohemianRhapsody, nil, RuleAllowTracks},
+		{"Denied artist", Policy{DenyArtists: []string{" QUEEN "}}, bohemianRhapsody, nil, RuleDenyArtists},
+		{"Denied artist by URI", Policy{DenyArtists: []string{"spotify:artist:1dfeR4HaWDbWqFHLkxsg1d"}}, bohemianRhapsody, nil, RuleDenyArtists},
+		{"Not an allowed artist", Policy{AllowArtists: []string{"ABBA"}}, bohemianRhapsody, nil, RuleAllowArtists},
+		{"Allowed artist", Policy{AllowArtists: []string{"ABBA", "Queen"}}, bohemianRhapsody, nil, ""},
+		{"Denied genre", Policy{DenyGenres: []string{"Glam Rock"}}, bohemianRhapsody, []string{"classic rock", "glam rock"}, RuleDenyGenres},
+		{"Not an allowed genre", Policy{AllowGenres: []string{"europop"}}, bohemianRhapsody, []string{"classic rock"}, RuleAllowGenres},
+		{"Allowed genre", Policy{AllowGenres: []string{"europop", "classic rock"}}, bohemianRhapsody, []string{"classic rock"}, ""},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			v := tc.p.Evaluate(tc.t, tc.genres)
+			var rule string
+			if v != nil {
+				rule = v.Rule
+			}
+			if rule != tc.rule {
+				t.Errorf("Got %q (%v), expected %q", rule, v, tc.rule)
+			}
+		})
+	}
+}
+
+func TestCheck(t *testing.T) {
+	c := mock.Catalog{
+		GetTrackFunc: func(ctx context.Context, id string) (spotify.Track, error) {
+			if id != "4u7EnebtmKWzUH433cf5Qv" {
+				t.Errorf("Got %q, expected 4u7EnebtmKWzUH433cf5Qv", id)
+			}
+			return bohemianRhapsody, nil
+		},
+		GetArtistsFunc: func(ctx context.Context, ids []string) ([]spotify.Artist, error) {
+			if len(ids) != 1 || ids[0] != "1dfeR4HaWDbWqFHLkxsg1d" {
+				t.Errorf("Got %v, expected [1dfeR4HaWDbWqFHLkxsg1d]", ids)
+			}
+			return []spotify.Artist{{Name: "Queen", Genres: []string{"glam rock"}}}, nil
+		},
+	}
+
+	t.Run("Zero", func(t *testing.T) {
+		// Nothing is looked up.
+		e := NewEngine(mock.Catalog{}, Policy{})
+		if err := e.Check(context.Background(), "spotify:track:4u7EnebtmKWzUH433cf5Qv"); err != nil {
+			t.Errorf("Got %T (%s), expected nil", err, err)
+		}
+	})
+
+	t.Run("Album", func(t *testing.T) {
+		e := NewEngine(mock.Catalog{}, Policy{NoExplicit: true})
+		if err := e.Check(context.Background(), "spotify:album:1GbtB4zTqAsyfZEsm1RZfx"); err != nil {
+			t.Errorf("Got %T (%s), expected nil", err, err)
+		}
+	})
+
+	t.Run("Violation", func(t *testing.T) {
+		e := NewEngine(c, Policy{DenyGenres: []string{"glam rock"}})
+		err := e.Check(context.Background(), "spotify:track:4u7EnebtmKWzUH433cf5Qv")
+		var v *Violation
+		if !errors.As(err, &v) {
+			t.Fatalf("Got %T (%v), expected *Violation", err, err)
+		}
+		if v.Rule != RuleDenyGenres {
+			t.Errorf("Got %q, expected %q", v.Rule, RuleDenyGenres)
+		}
+	})
+
+	t.Run("Policy changed", func(t *testing.T) {
+		e := NewEngine(c, Policy{DenyGenres: []string{"glam rock"}})
+		e.SetPolicy(Policy{MaxDuration: Duration(10 * time.Minute)})
+		if err := e.Check(context.Background(), "spotify:track:4u7EnebtmKWzUH433cf5Qv"); err != nil {
+			t.Errorf("Got %T (%s), expected nil", err, err)
+		}
+	})
+
+	t.Run("Lookup failed", func(t *testing.T) {
+		c := mock.Catalog{
+			GetTrackFunc: func(ctx context.Context, id string) (spotify.Track, error) {
+				return spotify.Track{}, spotify.ErrNotFound
+			},
+		}
+		e := NewEngine(c, Policy{NoExplicit: true})
+		if err := e.Check(context.Background(), "spotify:track:4u7EnebtmKWzUH433cf5Qv"); !errors.Is(err, spotify.ErrNotFound) {
+			t.Errorf("Got %v, expected %v", err, spotify.ErrNotFound)
+		}
+	})
+}
+
+func TestLoad(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sparty")
+	if err != nil {
+		t.Fatalf("Got %T (%s), expected nil", err, err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "policy.json")
+	const data = `{"no_explicit":true,"max_duration":"8m","deny_artists":["Nickelback"]}`
+	if err := ioutil.WriteFile(path, []byte(data), 0600); err != nil {
+		t.Fatalf("Got %T (%s), expected nil", err, err)
+	}
+
+	p, err := Load(path)
+	if err != nil {
+		t.Fatalf("Got %T (%s), expected nil", err, err)
+	}
+	if !p.NoExplicit {
+		t.Error("Got false, expected true")
+	}
+	if d := time.Duration(p.MaxDuration); d != 8*time.Minute {
+		t.Errorf("Got %s, expected 8m0s", d)
+	}
+	if len(p.DenyArtists) != 1 || p.DenyArtists[0] != "Nickelback" {
+		t.Errorf("Got %v, expected [Nickelback]", p.DenyArtists)
+	}
+
+	// It encodes the same way.
+	b, err := json.Marshal(p)
+	if err != nil {
+		t.Fatalf("Got %T (%s), expected nil", err, err)
+	}
+	if s := string(b); s != `{"no_explicit":true,"max_duration":"8m0s","deny_artists":["Nickelback"]}` {
+		t.Errorf("Got %q", s)
+	}
+}
@@ -0,0 +1,326 @@
+// Package resolver resolves links to songs on other streaming services to
+// Spotify tracks.
+package resolver
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"html"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/epels/sparty/spotify"
+)
+
+// metadata resolves links by fetching the page they point to and extracting
+// the artist and title from its metadata (Open Graph tags, falling back to the
+// page title). These are then used to search Spotify for the best match.
+type metadata struct {
+	httpc  *http.Client
+	s      searcher
+	market string
+
+	// hosts are the domains links may point to: this guards against guests
+	// making sparty fetch arbitrary URLs. Subdomains are allowed too.
+	hosts []string
+}
+
+type searcher interface {
+	Search(ctx context.Context, query, market string, limit int) ([]spotify.Track, error)
+}
+
+var (
+	ErrNoMatch     = errors.New("no matching Spotify track found")
+	ErrUnsupported = errors.New("link is not from a supported service")
+)
+
+var defaultHosts = []string{
+	"music.amazon.com",
+	"music.apple.com",
+	"deezer.com",
+	"deezer.page.link",
+	"soundcloud.com",
+	"tidal.com",
+	"youtu.be",
+	"youtube.com",
+}
+
+const (
+	// maxBodySize caps how much of a page is read: the metadata lives in the
+	// head, so there's no need to read entire pages.
+	maxBodySize = 512 << 10
+
+	// searchLimit is the number of Spotify search results considered when
+	// picking the best match.
+	searchLimit = 10
+
+	// minScore is the minimum similarity for a search result to be considered
+	// a match at all.
+	minScore = 0.5
+)
+
+// NewMetadata creates a resolver that searches Spotify using s. Market is
+// passed on to s as is.
+func NewMetadata(s searcher, market string) *metadata {
+	m := metadata{
+		s:      s,
+		market: market,
+		hosts:  defaultHosts,
+	}
+	m.httpc = &http.Client{
+		Timeout: 3 * time.Second,
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			if len(via) >= 5 {
+				return errors.New("stopped after 5 redirects")
+			}
+			if !m.allowed(req.URL) {
+				return fmt.Errorf("%w: redirected to %q", ErrUnsupported, req.URL.Host)
+			}
+			return nil
+		},
+	}
+	return &m
+}
+
+// Resolve resolves link to the URI of the Spotify track that matches it best.
+func (m *metadata) Resolve(ctx context.Context, link string) (string, error) {
+	u, err := url.Parse(strings.TrimSpace(link))
+	if err != nil {
+		return "", fmt.Errorf("%w: %s", ErrUnsupported, err)
+	}
+	if !m.allowed(u) {
+		return "", ErrUnsupported
+	}
+
+	meta, err := m.fetch(ctx, u.String())
+	if err != nil {
+		return "", fmt.Errorf("fetch: %w", err)
+	}
+	s, ok := extract(meta)
+	if !ok {
+		return "", fmt.Errorf("%w: no song metadata at %s", ErrNoMatch, u)
+	}
+
+	tracks, err := m.s.Search(ctx, s.query(), m.market, searchLimit)
+	if err != nil {
+		return "", fmt.Errorf("%T: Search: %w", m.s, err)
+	}
+	t, ok := s.bestMatch(tracks)
+	if !ok {
+		return "", fmt.Errorf("%w: for %q", ErrNoMatch, s.query())
+	}
+	return t.URI, nil
+}
+
+func (m *metadata) allowed(u *url.URL) bool {
+	if u.Scheme != "https" && u.Scheme != "http" {
+		return false
+	}
+	h := strings.ToLower(u.Hostname())
+	for _, allowed := range m.hosts {
+		if h == allowed || strings.HasSuffix(h, "."+allowed) {
+			return true
+		}
+	}
+	return false
+}
+
+var (
+	metaRe  = regexp.MustCompile(`(?is)<meta\s[^>]*>`)
+	attrRe  = regexp.MustCompile(`(?is)([a-z:_-]+)\s*=\s*(?:"([^"]*)"|'([^']*)')`)
+	titleRe = regexp.MustCompile(`(?is)<title[^>]*>(.*?)</title>`)
+)
+
+// fetch gets the page at u and returns its metadata: the content of its meta
+// tags keyed by property (or name), and the page title keyed by "title".
+func (m *metadata) fetch(ctx context.Context, u string) (map[string]string, error) {
+	req, err := http.NewRequest(http.MethodGet, u, nil)
+	if err != nil {
+		return nil, fmt.Errorf("net/http: NewRequest: %s", err)
+	}
+	req = req.WithContext(ctx)
+	// Some services only serve metadata to clients that look like browsers or
+	// link preview bots.
+	req.Header.Set("User-Agent", "Mozilla/5.0 (compatible; sparty; +https://github.com/epels/sparty)")
+	req.Header.Set("Accept", "text/html")
+
+	res, err := m.httpc.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("net/http: Client.Do: %w", err)
+	}
+	defer func() {
+		_ = res.Body.Close()
+	}()
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected response status %d", res.StatusCode)
+	}
+
+	b, err := ioutil.ReadAll(io.LimitReader(res.Body, maxBodySize))
+	if err != nil {
+		return nil, fmt.Errorf("io/ioutil: ReadAll: %s", err)
+	}
+	return parseMeta(string(b)), nil
+}
+
+func parseMeta(doc string) map[string]string {
+	meta := make(map[string]string)
+	for _, tag := range metaRe.FindAllString(doc, -1) {
+		var key, content string
+		for _, a := range attrRe.FindAllStringSubmatch(tag, -1) {
+			val := a[2] + a[3]
+			switch strings.ToLower(a[1]) {
+			case "property", "name":
+				key = strings.ToLower(val)
+			case "content":
+				content = val
+			}
+		}
+		if key != "" && content != "" {
+			if _, ok := meta[key]; !ok {
+				meta[key] = html.UnescapeString(content)
+			}
+		}
+	}
+	if sm := titleRe.FindStringSubmatch(doc); sm != nil {
+		meta["title"] = html.UnescapeString(sm[1])
+	}
+	return meta
+}
+
+// song is what could be extracted from a page's metadata. If it is unknown
+// which part is the artist, as in "Foo - Bar", both parts end up in title and
+// artist is empty, and ambiguous is set.
+type song struct {
+	title, artist string
+	ambiguous     bool
+}
+
+var (
+	prefixRe = regexp.MustCompile(`(?i)^(listen to|stream)\s+`)
+	suffixRe = regexp.MustCompile(`(?i)(\s*[-|–·]\s*|\s+on\s+)(apple music|youtube music|youtube|deezer|tidal|soundcloud|amazon music|listen online.*)\s*$`)
+	noiseRe  = regexp.MustCompile(`(?i)\s*[(\[][^)\]]*(official|lyrics?|audio|video|visuali[sz]er|hd|hq|4k)[^)\]]*[)\]]`)
+	byRe     = regexp.MustCompile(`(?i)^(.+?)\s+-\s+(?:song|single|ep)\s+by\s+(.+)$|^(.+)\s+by\s+(.+)$`)
+	dashRe   = regexp.MustCompile(`^(.+?)\s+[-–]\s+(.+)$`)
+)
+
+func extract(meta map[string]string) (song, bool) {
+	var raw string
+	for _, key := range []string{"og:title", "twitter:title", "title"} {
+		if v := strings.TrimSpace(meta[key]); v != "" {
+			raw = v
+			break
+		}
+	}
+	raw = strings.TrimFunc(raw, func(r rune) bool {
+		return unicode.IsSpace(r) || unicode.Is(unicode.Cf, r)
+	})
+	// Strip service names repeatedly, as in "Foo by Bar | Listen online for
+	// free on SoundCloud".
+	for {
+		s := suffixRe.ReplaceAllString(raw, "")
+		if s == raw {
+			break
+		}
+		raw = s
+	}
+	raw = prefixRe.ReplaceAllString(raw, "")
+	raw = strings.TrimSpace(noiseRe.ReplaceAllString(raw, ""))
+	if raw == "" {
+		return song{}, false
+	}
+
+	if sm := byRe.FindStringSubmatch(raw); sm != nil {
+		if sm[1] != "" {
+			return song{title: sm[1], artist: sm[2]}, true
+		}
+		return song{title: sm[3], artist: sm[4]}, true
+	}
+	if dashRe.MatchString(raw) {
+		return song{title: raw, ambiguous: true}, true
+	}
+	// The artist may be in a separate tag.
+	return song{title: raw, artist: meta["music:musician_description"]}, true
+}
+
+func (s song) query() string {
+	if s.ambiguous {
+		return dashRe.ReplaceAllString(s.title, "$1 $2")
+	}
+	return strings.TrimSpace(s.title + " " + s.artist)
+}
+
+// bestMatch picks the track from tracks that is most similar to s. Tracks are
+// assumed to be ordered by relevance, so ties are won by the first.
+func (s song) bestMatch(tracks []spotify.Track) (spotify.Track, bool) {
+	var best spotify.Track
+	var bestScore float64
+	for _, t := range tracks {
+		if sc := s.score(t); sc > bestScore {
+			best, bestScore = t, sc
+		}
+	}
+	return best, bestScore >= minScore
+}
+
+var versionRe = regexp.MustCompile(`\s+-\s+.*$`)
+
+// score scores the similarity of t to s, from 0 (nothing in common) to 1.
+func (s song) score(t spotify.Track) float64 {
+	var names []string
+	for _, a := range t.Artists {
+		names = append(names, a.Name)
+	}
+	artists := strings.Join(names, " ")
+	name := t.Name
+	// Ignore version info, like "Foo - Remastered 2011".
+	if stripped := versionRe.ReplaceAllString(t.Name, ""); stripped != "" {
+		name = stripped
+	}
+
+	if s.ambiguous {
+		sm := dashRe.FindStringSubmatch(s.title)
+		a := song{title: sm[1], artist: sm[2]}.score(t)
+		b := song{title: sm[2], artist: sm[1]}.score(t)
+		if a > b {
+			return a
+		}
+		return b
+	}
+	if s.artist == "" {
+		return similarity(s.title, name+" "+artists)
+	}
+	return 0.6*similarity(s.title, name) + 0.4*similarity(s.artist, artists)
+}
+
+// similarity returns the Sørensen–Dice coefficient of the words in a and b.
+func similarity(a, b string) float64 {
+	at, bt := words(a), words(b)
+	if len(at) == 0 || len(bt) == 0 {
+		return 0
+	}
+	set := make(map[string]int)
+	for _, w := range bt {
+		set[w]++
+	}
+	var shared int
+	for _, w := range at {
+		if set[w] > 0 {
+			set[w]--
+			shared++
+		}
+	}
+	return 2 * float64(shared) / float64(len(at)+len(bt))
+}
+
+func words(s string) []string {
+	return strings.FieldsFunc(strings.ToLower(s), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsNumber(r)
+	})
+}
@@ -0,0 +1,191 @@
+package resolver
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/epels/sparty/internal/mock"
+	"github.com/epels/sparty/spotify"
+)
+
+var candidates = []spotify.Track{
+	{
+		URI:     "spotify:track:cover",
+		Name:    "Bohemian Rhapsody",
+		Artists: []spotify.Artist{{Name: "The Braids"}},
+	},
+	{
+		URI:     "spotify:track:original",
+		Name:    "Bohemian Rhapsody - Remastered 2011",
+		Artists: []spotify.Artist{{Name: "Queen"}},
+	},
+	{
+		URI:     "spotify:track:other",
+		Name:    "Don't Stop Me Now",
+		Artists: []spotify.Artist{{Name: "Queen"}},
+	},
+}
+
+func TestResolve(t *testing.T) {
+	t.Run("OK", func(t *testing.T) {
+		for _, tc := range []struct {
+			name, page, expQuery string
+		}{
+			{
+				name:     "Title by artist",
+				page:     `<html><head><meta property="og:title" content="Bohemian Rhapsody by Queen on TIDAL"></head></html>`,
+				expQuery: "Bohemian Rhapsody Queen",
+			},
+			{
+				name:     "Song by",
+				page:     `<meta property="og:title" content="&lrm;Bohemian Rhapsody - Song by Queen - Apple Music" />`,
+				expQuery: "Bohemian Rhapsody Queen",
+			},
+			{
+				name:     "Artist dash title",
+				page:     `<meta content='Queen - Bohemian Rhapsody (Official Video Remastered)' property='og:title'>`,
+				expQuery: "Queen Bohemian Rhapsody",
+			},
+			{
+				name:     "Title dash artist",
+				page:     `<meta name="twitter:title" content="Bohemian Rhapsody - Queen | Deezer">`,
+				expQuery: "Bohemian Rhapsody Queen",
+			},
+			{
+				name:     "Page title",
+				page:     `<title>Stream Bohemian Rhapsody by Queen | Listen online for free on SoundCloud</title>`,
+				expQuery: "Bohemian Rhapsody Queen",
+			},
+		} {
+			t.Run(tc.name, func(t *testing.T) {
+				ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+					if r.URL.Path != "/track/123" {
+						t.Errorf("Got %q, expected /track/123", r.URL.Path)
+					}
+					_, _ = fmt.Fprint(w, tc.page)
+				}))
+				defer ts.Close()
+
+				s := mock.Searcher{
+					SearchFunc: func(ctx context.Context, query, market string, limit int) ([]spotify.Track, error) {
+						if query != tc.expQuery {
+							t.Errorf("Got %q, expected %q", query, tc.expQuery)
+						}
+						return candidates, nil
+					},
+				}
+				m := NewMetadata(s, "")
+				m.hosts = []string{"127.0.0.1"}
+
+				uri, err := m.Resolve(context.Background(), ts.URL+"/track/123")
+				if err != nil {
+					t.Fatalf("Got %T (%s), expected nil", err, err)
+				}
+				if uri != "spotify:track:original" {
+					t.Errorf("Got %q, expected spotify:track:original", uri)
+				}
+			})
+		}
+	})
+
+	t.Run("Host not allowed", func(t *testing.T) {
+		ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			t.Error("Unexpected request to host that is not allowed")
+		}))
+		defer ts.Close()
+
+		m := NewMetadata(mock.Searcher{}, "")
+		if _, err := m.Resolve(context.Background(), ts.URL); !errors.Is(err, ErrUnsupported) {
+			t.Errorf("Got %T (%v), expected ErrUnsupported", err, err)
+		}
+	})
+
+	t.Run("Redirect to host not allowed", func(t *testing.T) {
+		var called bool
+		evil := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			called = true
+		}))
+		defer evil.Close()
+		ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			// Both listen on 127.0.0.1, so refer to evil by another name.
+			http.Redirect(w, r, strings.Replace(evil.URL, "127.0.0.1", "localhost", 1), http.StatusFound)
+		}))
+		defer ts.Close()
+
+		m := NewMetadata(mock.Searcher{}, "")
+		m.hosts = []string{"127.0.0.1"}
+		if _, err := m.Resolve(context.Background(), ts.URL); !errors.Is(err, ErrUnsupported) {
+			t.Errorf("Got %T (%v), expected ErrUnsupported", err, err)
+		}
+		if called {
+			t.Error("Got true, expected false")
+		}
+	})
+
+	t.Run("No metadata", func(t *testing.T) {
+		ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			_, _ = fmt.Fprint(w, `<html><body>Hello</body></html>`)
+		}))
+		defer ts.Close()
+
+		m := NewMetadata(mock.Searcher{}, "")
+		m.hosts = []string{"127.0.0.1"}
+		if _, err := m.Resolve(context.Background(), ts.URL); !errors.Is(err, ErrNoMatch) {
+			t.Errorf("Got %T (%v), expected ErrNoMatch", err, err)
+		}
+	})
+
+	t.Run("No good match", func(t *testing.T) {
+		ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			_, _ = fmt.Fprint(w, `<meta property="og:title" content="Something Else Entirely by Nobody">`)
+		}))
+		defer ts.Close()
+
+		s := mock.Searcher{
+			SearchFunc: func(ctx context.Context, query, market string, limit int) ([]spotify.Track, error) {
+				return candidates, nil
+			},
+		}
+		m := NewMetadata(s, "")
+		m.hosts = []string{"127.0.0.1"}
+		if _, err := m.Resolve(context.Background(), ts.URL); !errors.Is(err, ErrNoMatch) {
+			t.Errorf("Got %T (%v), expected ErrNoMatch", err, err)
+		}
+	})
+
+	t.Run("Source failure", func(t *testing.T) {
+		ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusNotFound)
+		}))
+		defer ts.Close()
+
+		m := NewMetadata(mock.Searcher{}, "")
+		m.hosts = []string{"127.0.0.1"}
+		if _, err := m.Resolve(context.Background(), ts.URL); err == nil {
+			t.Error("Got nil, expected error")
+		}
+	})
+
+	t.Run("Search failure", func(t *testing.T) {
+		ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			_, _ = fmt.Fprint(w, `<meta property="og:title" content="Bohemian Rhapsody by Queen">`)
+		}))
+		defer ts.Close()
+
+		s := mock.Searcher{
+			SearchFunc: func(ctx context.Context, query, market string, limit int) ([]spotify.Track, error) {
+				return nil, errors.New("some error")
+			},
+		}
+		m := NewMetadata(s, "")
+		m.hosts = []string{"127.0.0.1"}
+		if _, err := m.Resolve(context.Background(), ts.URL); err == nil {
+			t.Error("Got nil, expected error")
+		}
+	})
+}
@@ -0,0 +1,144 @@
+package spotify
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"strings"
+)
+
+// Scopes are the authorization scopes requested when the host connects their
+// Spotify account.
+var Scopes = []string{
+	"user-modify-playback-state",
+	"user-read-currently-playing",
+	"user-read-playback-state",
+}
+
+// ErrNotConnected is returned when no Spotify account was connected yet: there
+// is no refresh token to request access tokens with.
+var ErrNotConnected = errors.New("no Spotify account connected")
+
+// TokenStore persists the refresh token, so a connected Spotify account stays
+// connected across restarts.
+type TokenStore interface {
+	// Load loads the refresh token. If none was saved yet, it returns an
+	// empty string and a nil error.
+	Load() (string, error)
+	Save(refreshToken string) error
+}
+
+// WithTokenStore makes the client load its refresh token from s, and save any
+// new refresh token it obtains to s.
+func WithTokenStore(s TokenStore) Option {
+	return func(c *client) {
+		c.store = s
+	}
+}
+
+// AuthCodeURL returns the URL to send the host to in order to connect their
+// Spotify account using the authorization code flow with PKCE. After they
+// consent, Spotify redirects them to redirectURI with state and a code to pass
+// to Exchange. Challenge is the base64url encoded SHA-256 hash of the code
+// verifier.
+func (c *client) AuthCodeURL(redirectURI, state, challenge string) string {
+	vals := url.Values{}
+	vals.Set("client_id", c.clientID)
+	vals.Set("response_type", "code")
+	vals.Set("redirect_uri", redirectURI)
+	vals.Set("state", state)
+	vals.Set("scope", strings.Join(Scopes, " "))
+	vals.Set("code_challenge_method", "S256")
+	vals.Set("code_challenge", challenge)
+	return c.authBaseURL + "/authorize?" + vals.Encode()
+}
+
+// Exchange exchanges an authorization code for a refresh token (and an access
+// token), proving possession of the code verifier. From then on, the client
+// acts on behalf of the user that consented. If the client has a token store,
+// the refresh token is saved to it first: if that fails, the client sticks with
+// the account it had.
+func (c *client) Exchange(ctx context.Context, code, redirectURI, verifier string) error {
+	vals := url.Values{}
+	vals.Set("grant_type", "authorization_code")
+	vals.Set("code", code)
+	vals.Set("redirect_uri", redirectURI)
+	vals.Set("client_id", c.clientID)
+	vals.Set("code_verifier", verifier)
+	t, rt, err := c.requestToken(ctx, vals)
+	if err != nil {
+		return fmt.Errorf("requestToken: %w", err)
+	}
+	if rt == "" {
+		return errors.New("no refresh token in response")
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.store != nil {
+		if err := c.store.Save(rt); err != nil {
+			return fmt.Errorf("%T: Save: %w", c.store, err)
+		}
+	}
+	c.token = t
+	c.refreshToken = rt
+	c.loaded = true
+	// A token that is being refreshed is for the previous account: make sure
+	// it does not replace the new one.
+	c.refreshing = nil
+	return nil
+}
+
+// fileTokenStore stores the refresh token in a JSON file on local disk.
+type fileTokenStore struct {
+	path string
+}
+
+func NewFileTokenStore(path string) *fileTokenStore {
+	return &fileTokenStore{path: path}
+}
+
+func (s *fileTokenStore) Load() (string, error) {
+	b, err := ioutil.ReadFile(s.path)
+	if os.IsNotExist(err) {
+		return "", nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("io/ioutil: ReadFile: %w", err)
+	}
+	var data struct {
+		RefreshToken string `json:"refresh_token"`
+	}
+	if err := json.Unmarshal(b, &data); err != nil {
+		return "", fmt.Errorf("encoding/json: Unmarshal: %w", err)
+	}
+	return data.RefreshToken, nil
+}
+
+// Save saves the refresh token. It writes to a temporary file first, which is
+// then renamed over the old one, so a crash never leaves a corrupt store.
+func (s *fileTokenStore) Save(refreshToken string) error {
+	b, err := json.Marshal(struct {
+		RefreshToken string `json:"refresh_token"`
+	}{
+		RefreshToken: refreshToken,
+	})
+	if err != nil {
+		return fmt.Errorf("encoding/json: Marshal: %w", err)
+	}
+	tmp := s.path + ".tmp"
+	// The refresh token grants control over the host's account, so keep it
+	// private.
+	if err := ioutil.WriteFile(tmp, b, 0600); err != nil {
+		return fmt.Errorf("io/ioutil: WriteFile: %w", err)
+	}
+	if err := os.Rename(tmp, s.path); err != nil {
+		return fmt.Errorf("os: Rename: %w", err)
+	}
+	return nil
+}
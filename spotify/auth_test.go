@@ -0,0 +1,248 @@
+package spotify
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func tempStore(t *testing.T) (*fileTokenStore, func()) {
+	t.Helper()
+
+	dir, err := ioutil.TempDir("", "sparty")
+	if err != nil {
+		t.Fatalf("Got %T (%s), expected nil", err, err)
+	}
+	return NewFileTokenStore(filepath.Join(dir, "token.json")), func() {
+		_ = os.RemoveAll(dir)
+	}
+}
+
+func TestAuthCodeURL(t *testing.T) {
+	c := NewClient("foo", "bar", "")
+	u, err := url.Parse(c.AuthCodeURL("http://localhost/callback", "state", "challenge"))
+	if err != nil {
+		t.Fatalf("Got %T (%s), expected nil", err, err)
+	}
+	if s := u.Scheme + "://" + u.Host + u.Path; s != "https://accounts.spotify.com/authorize" {
+		t.Errorf("Got %q, expected https://accounts.spotify.com/authorize", s)
+	}
+	q := u.Query()
+	for key, exp := range map[string]string{
+		"client_id":             "foo",
+		"response_type":         "code",
+		"redirect_uri":          "http://localhost/callback",
+		"state":                 "state",
+		"scope":                 "user-modify-playback-state user-read-currently-playing user-read-playback-state",
+		"code_challenge_method": "S256",
+		"code_challenge":        "challenge",
+	} {
+		if v := q.Get(key); v != exp {
+			t.Errorf("%s: Got %q, expected %q", key, v, exp)
+		}
+	}
+}
+
+func TestExchange(t *testing.T) {
+	t.Run("OK", func(t *testing.T) {
+		ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Path != "/api/token" {
+				t.Errorf("Got %q, expected /api/token", r.URL.Path)
+			}
+			if err := r.ParseForm(); err != nil {
+				t.Errorf("Got %T (%s), expected nil", err, err)
+			}
+			for key, exp := range map[string]string{
+				"grant_type":    "authorization_code",
+				"code":          "code",
+				"redirect_uri":  "http://localhost/callback",
+				"client_id":     "foo",
+				"code_verifier": "verifier",
+			} {
+				if v := r.PostForm.Get(key); v != exp {
+					t.Errorf("%s: Got %q, expected %q", key, v, exp)
+				}
+			}
+
+			_, _ = fmt.Fprint(w, `{"access_token":"secret","token_type":"Bearer","expires_in":3600,"refresh_token":"refresh"}`)
+		}))
+		defer ts.Close()
+
+		store, cleanup := tempStore(t)
+		defer cleanup()
+
+		c := NewClient("foo", "bar", "", WithTokenStore(store))
+		c.authBaseURL = ts.URL
+		if err := c.Exchange(context.Background(), "code", "http://localhost/callback", "verifier"); err != nil {
+			t.Fatalf("Got %T (%s), expected nil", err, err)
+		}
+
+		bearer, err := c.bearerToken(context.Background())
+		if err != nil {
+			t.Fatalf("Got %T (%s), expected nil", err, err)
+		}
+		if bearer != "secret" {
+			t.Errorf("Got %q, expected secret", bearer)
+		}
+		rt, err := store.Load()
+		if err != nil {
+			t.Fatalf("Got %T (%s), expected nil", err, err)
+		}
+		if rt != "refresh" {
+			t.Errorf("Got %q, expected refresh", rt)
+		}
+	})
+
+	t.Run("Rejected", func(t *testing.T) {
+		ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusBadRequest)
+			_, _ = fmt.Fprint(w, `{"error":"invalid_grant","error_description":"Invalid authorization code"}`)
+		}))
+		defer ts.Close()
+
+		c := NewClient("foo", "bar", "")
+		c.authBaseURL = ts.URL
+		err := c.Exchange(context.Background(), "code", "http://localhost/callback", "verifier")
+		if !errors.Is(err, ErrUnauthorized) {
+			t.Errorf("Got %T (%v), expected ErrUnauthorized", err, err)
+		}
+	})
+}
+
+type failingStore struct{}
+
+func (failingStore) Load() (string, error)          { return "", nil }
+func (failingStore) Save(refreshToken string) error { return errors.New("some error") }
+
+func TestExchangeConnected(t *testing.T) {
+	received, release := make(chan struct{}), make(chan struct{})
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := r.ParseForm(); err != nil {
+			t.Errorf("Got %T (%s), expected nil", err, err)
+		}
+		if r.PostForm.Get("grant_type") == "refresh_token" {
+			close(received)
+			<-release
+			_, _ = fmt.Fprint(w, `{"access_token":"old","token_type":"Bearer","expires_in":3600,"refresh_token":"old-refresh"}`)
+			return
+		}
+		_, _ = fmt.Fprint(w, `{"access_token":"new","token_type":"Bearer","expires_in":3600,"refresh_token":"new-refresh"}`)
+	}))
+	defer ts.Close()
+
+	t.Run("During refresh", func(t *testing.T) {
+		c := NewClient("foo", "bar", "baz")
+		c.authBaseURL = ts.URL
+
+		type result struct {
+			bearer string
+			err    error
+		}
+		done := make(chan result, 1)
+		go func() {
+			bearer, err := c.bearerToken(context.Background())
+			done <- result{bearer, err}
+		}()
+		<-received
+		if err := c.Exchange(context.Background(), "code", "http://localhost/callback", "verifier"); err != nil {
+			t.Fatalf("Got %T (%s), expected nil", err, err)
+		}
+		close(release)
+
+		// The refresh for the previous account does not replace the new
+		// account's token.
+		res := <-done
+		if res.err != nil {
+			t.Fatalf("Got %T (%s), expected nil", res.err, res.err)
+		}
+		if res.bearer != "new" {
+			t.Errorf("Got %q, expected new", res.bearer)
+		}
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		if c.token.bearer != "new" || c.refreshToken != "new-refresh" {
+			t.Errorf("Got %q and %q, expected new and new-refresh", c.token.bearer, c.refreshToken)
+		}
+	})
+
+	t.Run("Save failed", func(t *testing.T) {
+		c := NewClient("foo", "bar", "baz", WithTokenStore(failingStore{}))
+		c.authBaseURL = ts.URL
+		c.token = &token{bearer: "old", expiresAt: time.Now().Add(time.Hour)}
+
+		if err := c.Exchange(context.Background(), "code", "http://localhost/callback", "verifier"); err == nil {
+			t.Fatal("Got nil, expected error")
+		}
+		// The client sticks with the account it had.
+		if c.token.bearer != "old" || c.refreshToken != "baz" {
+			t.Errorf("Got %q and %q, expected old and baz", c.token.bearer, c.refreshToken)
+		}
+	})
+}
+
+func TestTokenStore(t *testing.T) {
+	t.Run("Not connected", func(t *testing.T) {
+		store, cleanup := tempStore(t)
+		defer cleanup()
+
+		c := NewClient("foo", "bar", "", WithTokenStore(store))
+		if _, err := c.bearerToken(context.Background()); !errors.Is(err, ErrNotConnected) {
+			t.Errorf("Got %T (%v), expected ErrNotConnected", err, err)
+		}
+	})
+
+	t.Run("Loaded and rotated", func(t *testing.T) {
+		ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if err := r.ParseForm(); err != nil {
+				t.Errorf("Got %T (%s), expected nil", err, err)
+			}
+			if rt := r.PostForm.Get("refresh_token"); rt != "stored" {
+				t.Errorf("Got %q, expected stored", rt)
+			}
+			_, _ = fmt.Fprint(w, `{"access_token":"secret","token_type":"Bearer","expires_in":3600,"refresh_token":"rotated"}`)
+		}))
+		defer ts.Close()
+
+		store, cleanup := tempStore(t)
+		defer cleanup()
+		if err := store.Save("stored"); err != nil {
+			t.Fatalf("Got %T (%s), expected nil", err, err)
+		}
+
+		// The stored token takes precedence.
+		c := NewClient("foo", "bar", "env", WithTokenStore(store))
+		c.authBaseURL = ts.URL
+		if _, err := c.bearerToken(context.Background()); err != nil {
+			t.Fatalf("Got %T (%s), expected nil", err, err)
+		}
+
+		rt, err := store.Load()
+		if err != nil {
+			t.Fatalf("Got %T (%s), expected nil", err, err)
+		}
+		if rt != "rotated" {
+			t.Errorf("Got %q, expected rotated", rt)
+		}
+	})
+
+	t.Run("Empty store", func(t *testing.T) {
+		store, cleanup := tempStore(t)
+		defer cleanup()
+
+		rt, err := store.Load()
+		if err != nil {
+			t.Errorf("Got %T (%s), expected nil", err, err)
+		}
+		if rt != "" {
+			t.Errorf("Got %q, expected empty string", rt)
+		}
+	})
+}
@@ -6,20 +6,31 @@ import (
 	"context"
 	"encoding/base64"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
-	"io/ioutil"
 	"net/http"
 	"net/url"
+	"strconv"
 	"strings"
+	"sync"
 	"time"
 )
 
 type client struct {
-	httpc                    *http.Client
-	apiBaseURL, authBaseURL  string
-	authHeader, refreshToken string
-	token                    *token
+	httpc                   *http.Client
+	apiBaseURL, authBaseURL string
+	clientID, authHeader    string
+	limiter                 limiter
+	store                   TokenStore
+
+	// mu guards the fields below it.
+	mu           sync.Mutex
+	refreshToken string
+	token        *token
+	refreshing   *refresh
+	// loaded is set once the refresh token was loaded from the store.
+	loaded bool
 
 	// nowFunc returns the current local time. Can be used to instrument tests.
 	nowFunc func() time.Time
@@ -30,39 +41,153 @@ type token struct {
 	expiresAt time.Time
 }
 
+// refresh is an in-flight request for a new token. Done is closed once it
+// completes, after which err is set if it failed.
+type refresh struct {
+	done chan struct{}
+	err  error
+}
+
 // If the token expires within this duration, apiRequest a new one anyway: this
 // guards against the next apiRequest still failing due to an expired token.
 const expiryThreshold = 5 * time.Second
 
-func NewClient(cID, cSecret, refreshToken string) *client {
+// Option configures optional behavior of the client.
+type Option func(c *client)
+
+func NewClient(cID, cSecret, refreshToken string, opts ...Option) *client {
 	ah := "Basic " + base64.StdEncoding.EncodeToString([]byte(fmt.Sprintf("%s:%s", cID, cSecret)))
-	return &client{
+	c := client{
 		httpc: &http.Client{
 			Timeout: 5 * time.Second,
 		},
 		apiBaseURL:   "https://api.spotify.com",
 		authBaseURL:  "https://accounts.spotify.com",
+		clientID:     cID,
 		authHeader:   ah,
 		refreshToken: refreshToken,
 		nowFunc:      time.Now,
 	}
+	for _, opt := range opts {
+		opt(&c)
+	}
+	return &c
 }
 
-func (c *client) bearerToken(ctx context.Context) error {
-	if c.token != nil && c.token.bearer != "" {
-		// Already have a token, so no-op if it doesn't expire in the near
-		// future.
-		if !c.token.expiresAt.Before(c.nowFunc().Add(expiryThreshold)) {
-			return nil
+// bearerToken gets a valid access token, requesting a new one if there is no
+// token yet or it (nearly) expired. It is safe for concurrent use: if multiple
+// callers need a new token at the same time, only one request is sent to the
+// token endpoint, and all of them wait for its result. Should the caller that
+// sent it give up, another one sends a new request.
+func (c *client) bearerToken(ctx context.Context) (string, error) {
+	for {
+		c.mu.Lock()
+		if c.token != nil && c.token.bearer != "" {
+			// Already have a token, so no-op if it doesn't expire in the
+			// near future.
+			if !c.token.expiresAt.Before(c.nowFunc().Add(expiryThreshold)) {
+				bearer := c.token.bearer
+				c.mu.Unlock()
+				return bearer, nil
+			}
+		}
+		if r := c.refreshing; r != nil {
+			c.mu.Unlock()
+			select {
+			case <-ctx.Done():
+				return "", ctx.Err()
+			case <-r.done:
+			}
+			if r.err != nil && !isContextError(r.err) {
+				return "", r.err
+			}
+			// Check the new token like any other. If the request for it
+			// was given up on by its caller, this becomes the next one.
+			continue
+		}
+
+		if err := c.loadRefreshToken(); err != nil {
+			c.mu.Unlock()
+			return "", fmt.Errorf("loadRefreshToken: %w", err)
+		}
+		if c.refreshToken == "" {
+			c.mu.Unlock()
+			return "", ErrNotConnected
+		}
+
+		r := &refresh{done: make(chan struct{})}
+		c.refreshing = r
+		refreshToken := c.refreshToken
+		c.mu.Unlock()
+
+		vals := url.Values{}
+		vals.Set("grant_type", "refresh_token")
+		vals.Set("refresh_token", refreshToken)
+		t, rotated, err := c.requestToken(ctx, vals)
+
+		c.mu.Lock()
+		// If Exchange connected another account meanwhile, this token is
+		// for the previous one: drop it, and use the new account's.
+		stale := c.refreshing != r
+		if stale {
+			err = nil
+		} else if c.refreshing = nil; err == nil {
+			c.token = t
+			if rotated != "" && rotated != refreshToken {
+				c.refreshToken = rotated
+				if c.store != nil {
+					// If this fails, the old refresh token remains in
+					// the store. Spotify keeps accepting it for a while,
+					// and the next rotation gets another chance.
+					_ = c.store.Save(rotated)
+				}
+			}
 		}
+		r.err = err
+		close(r.done)
+		c.mu.Unlock()
+
+		if err != nil {
+			return "", err
+		}
+		if stale {
+			continue
+		}
+		return t.bearer, nil
 	}
+}
 
-	vals := url.Values{}
-	vals.Set("grant_type", "refresh_token")
-	vals.Set("refresh_token", c.refreshToken)
+// isContextError reports whether err is due to a context being canceled or
+// timing out.
+func isContextError(err error) bool {
+	return errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded)
+}
+
+// loadRefreshToken loads the refresh token from the store, if any, the first
+// time it is called. A stored token takes precedence over the one the client
+// was created with, as it is the most recent one. Callers must hold c.mu.
+func (c *client) loadRefreshToken() error {
+	if c.store == nil || c.loaded {
+		return nil
+	}
+	rt, err := c.store.Load()
+	if err != nil {
+		return fmt.Errorf("%T: Load: %w", c.store, err)
+	}
+	if rt != "" {
+		c.refreshToken = rt
+	}
+	c.loaded = true
+	return nil
+}
+
+// requestToken requests a new access token from the token endpoint, using the
+// grant in vals. Spotify may issue a (new) refresh token while at it: if so,
+// it is returned as well.
+func (c *client) requestToken(ctx context.Context, vals url.Values) (*token, string, error) {
 	req, err := http.NewRequest(http.MethodPost, c.authBaseURL+"/api/token", strings.NewReader(vals.Encode()))
 	if err != nil {
-		return fmt.Errorf("net/http: NewRequest: %s", err)
+		return nil, "", fmt.Errorf("net/http: NewRequest: %w", err)
 	}
 	req = req.WithContext(ctx)
 	req.Header.Set("Authorization", c.authHeader)
@@ -70,58 +195,109 @@ func (c *client) bearerToken(ctx context.Context) error {
 
 	res, err := c.httpc.Do(req)
 	if err != nil {
-		return fmt.Errorf("net/http: Request.Do: %s", err)
+		return nil, "", fmt.Errorf("net/http: Request.Do: %w", err)
 	}
 	defer func() {
 		_ = res.Body.Close()
 	}()
 
+	if res.StatusCode != http.StatusOK {
+		return nil, "", newAuthError(res)
+	}
 	var data struct {
 		ExpiresInSecs int    `json:"expires_in"`
 		Token         string `json:"access_token"`
+		RefreshToken  string `json:"refresh_token"`
 	}
 	if err := json.NewDecoder(res.Body).Decode(&data); err != nil {
-		return fmt.Errorf("encoding/json: Decoder.Decode: %s", err)
+		return nil, "", fmt.Errorf("encoding/json: Decoder.Decode: %w", err)
+	}
+	if data.Token == "" {
+		return nil, "", errors.New("no access token in response")
 	}
 
-	c.token = &token{
+	t := token{
 		bearer:    data.Token,
 		expiresAt: c.nowFunc().Add(time.Duration(data.ExpiresInSecs) * time.Second),
 	}
-	return nil
+	return &t, data.RefreshToken, nil
 }
 
 // apiRequest sends a request and gets the response. Data is optional, but if
 // set, it will be JSON encoded and written to the request body.
+//
+// Requests are subject to the client's rate limiter. If Spotify responds with
+// 429 Too Many Requests anyway, all requests back off as instructed by its
+// Retry-After header, and the request is retried once.
+//
+// If Spotify responds with 401 Unauthorized, the access token was rejected
+// before it expired, e.g. because it was revoked. It is dropped, and the
+// request is retried once with a new one.
 func (c *client) apiRequest(ctx context.Context, method, path string, data interface{}) (*http.Response, error) {
-	if err := c.bearerToken(ctx); err != nil {
-		return nil, fmt.Errorf("bearerToken: %s", err)
-	}
-
 	var ct string
-	var rr io.Reader
+	var b []byte
 	if data != nil {
-		b, err := json.Marshal(data)
+		var err error
+		b, err = json.Marshal(data)
 		if err != nil {
-			return nil, fmt.Errorf("encoding/json: Marshal: %s", err)
+			return nil, fmt.Errorf("encoding/json: Marshal: %w", err)
 		}
 		ct = "application/json"
-		rr = bytes.NewReader(b)
 	}
 
-	req, err := http.NewRequest(method, c.apiBaseURL+path, rr)
-	if err != nil {
-		return nil, fmt.Errorf("net/http: NewRequest: %s", err)
+	var retried, reauthorized bool
+	for {
+		bearer, err := c.bearerToken(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("bearerToken: %w", err)
+		}
+		if err := c.limiter.wait(ctx, c.nowFunc); err != nil {
+			return nil, fmt.Errorf("limiter.wait: %w", err)
+		}
+
+		var rr io.Reader
+		if b != nil {
+			rr = bytes.NewReader(b)
+		}
+		req, err := http.NewRequest(method, c.apiBaseURL+path, rr)
+		if err != nil {
+			return nil, fmt.Errorf("net/http: NewRequest: %w", err)
+		}
+		req = req.WithContext(ctx)
+		req.Header.Set("Authorization", "Bearer "+bearer)
+		req.Header.Set("Content-Type", ct)
+
+		res, err := c.httpc.Do(req)
+		if err != nil {
+			return nil, fmt.Errorf("net/http: Client.Do: %w", err)
+		}
+		switch {
+		case res.StatusCode == http.StatusUnauthorized && !reauthorized:
+			c.dropToken(bearer)
+			reauthorized = true
+		case res.StatusCode == http.StatusTooManyRequests:
+			c.limiter.backoff(c.nowFunc().Add(retryAfter(res.Header, c.nowFunc())))
+			if retried {
+				return res, nil
+			}
+			retried = true
+		default:
+			return res, nil
+		}
+		_ = res.Body.Close()
 	}
-	req = req.WithContext(ctx)
-	req.Header.Set("Authorization", "Bearer "+c.token.bearer)
-	req.Header.Set("Content-Type", ct)
+}
 
-	res, err := c.httpc.Do(req)
-	if err != nil {
-		return nil, fmt.Errorf("net/http: Client.Do: %s", err)
+// dropToken drops the access token if it is still bearer, so the next call to
+// bearerToken requests a new one. If another request replaced it already, the
+// new token is kept.
+func (c *client) dropToken(bearer string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.token != nil && c.token.bearer == bearer {
+		c.token = nil
 	}
-	return res, nil
 }
 
 // AddToQueue adds an item, defined by uri, to the end of the user's current
@@ -129,15 +305,181 @@ func (c *client) apiRequest(ctx context.Context, method, path string, data inter
 func (c *client) AddToQueue(ctx context.Context, uri string) error {
 	res, err := c.apiRequest(ctx, http.MethodPost, "/v1/me/player/queue?uri="+uri, nil)
 	if err != nil {
-		return fmt.Errorf("apiRequest: %s", err)
+		return fmt.Errorf("apiRequest: %w", err)
 	}
 	defer func() {
 		_ = res.Body.Close()
 	}()
 
 	if res.StatusCode != http.StatusNoContent {
-		rs, _ := ioutil.ReadAll(res.Body)
-		return fmt.Errorf("unexpected response status %d with body %s", res.StatusCode, rs)
+		return newError(res, c.nowFunc())
 	}
 	return nil
 }
+
+// getJSON sends a GET request to path and decodes the JSON response into v.
+// Any response status other than 200 OK is considered an error.
+func (c *client) getJSON(ctx context.Context, path string, v interface{}) error {
+	res, err := c.apiRequest(ctx, http.MethodGet, path, nil)
+	if err != nil {
+		return fmt.Errorf("apiRequest: %w", err)
+	}
+	defer func() {
+		_ = res.Body.Close()
+	}()
+
+	if res.StatusCode != http.StatusOK {
+		return newError(res, c.nowFunc())
+	}
+	if err := json.NewDecoder(res.Body).Decode(v); err != nil {
+		return fmt.Errorf("encoding/json: Decoder.Decode: %w", err)
+	}
+	return nil
+}
+
+// Page sizes are the maximum allowed by the Spotify Web API for the respective
+// endpoints.
+const (
+	albumTracksPageSize    = 50
+	playlistTracksPageSize = 100
+)
+
+// AlbumTracks gets the URIs of the tracks on the album with the given ID, in
+// album order. At most max URIs are returned.
+func (c *client) AlbumTracks(ctx context.Context, id string, max int) ([]string, error) {
+	var uris []string
+	for offset := 0; len(uris) < max; {
+		var page struct {
+			Items []struct {
+				URI string `json:"uri"`
+			} `json:"items"`
+			Total int `json:"total"`
+		}
+		path := "/v1/albums/" + url.PathEscape(id) + "/tracks?" + pageQuery(offset, albumTracksPageSize)
+		if err := c.getJSON(ctx, path, &page); err != nil {
+			return nil, fmt.Errorf("getJSON: %w", err)
+		}
+		for _, it := range page.Items {
+			if len(uris) == max {
+				break
+			}
+			uris = append(uris, it.URI)
+		}
+
+		offset += len(page.Items)
+		if len(page.Items) == 0 || offset >= page.Total {
+			break
+		}
+	}
+	return uris, nil
+}
+
+// PlaylistTracks gets the URIs of the tracks in the playlist with the given ID,
+// in playlist order. Items that cannot be queued, like local files, tracks that
+// are no longer available and podcast episodes, are skipped. At most max URIs
+// are returned.
+func (c *client) PlaylistTracks(ctx context.Context, id string, max int) ([]string, error) {
+	var uris []string
+	for offset := 0; len(uris) < max; {
+		var page struct {
+			Items []struct {
+				IsLocal bool `json:"is_local"`
+				Track   *struct {
+					Type string `json:"type"`
+					URI  string `json:"uri"`
+				} `json:"track"`
+			} `json:"items"`
+			Total int `json:"total"`
+		}
+		path := "/v1/playlists/" + url.PathEscape(id) + "/tracks?" + pageQuery(offset, playlistTracksPageSize)
+		if err := c.getJSON(ctx, path, &page); err != nil {
+			return nil, fmt.Errorf("getJSON: %w", err)
+		}
+		for _, it := range page.Items {
+			if len(uris) == max {
+				break
+			}
+			if it.IsLocal || it.Track == nil || it.Track.Type != "track" || it.Track.URI == "" {
+				continue
+			}
+			uris = append(uris, it.Track.URI)
+		}
+
+		offset += len(page.Items)
+		if len(page.Items) == 0 || offset >= page.Total {
+			break
+		}
+	}
+	return uris, nil
+}
+
+func pageQuery(offset, limit int) string {
+	vals := url.Values{}
+	vals.Set("limit", strconv.Itoa(limit))
+	vals.Set("offset", strconv.Itoa(offset))
+	return vals.Encode()
+}
+
+// Search searches the Spotify catalog for tracks matching query, and returns
+// at most limit of them ordered by relevance as determined by Spotify. Market
+// is an optional ISO 3166-1 alpha-2 country code (or "from_token"): if set,
+// only tracks playable in that market are returned.
+func (c *client) Search(ctx context.Context, query, market string, limit int) ([]Track, error) {
+	vals := url.Values{}
+	vals.Set("q", query)
+	vals.Set("type", "track")
+	vals.Set("limit", strconv.Itoa(limit))
+	if market != "" {
+		vals.Set("market", market)
+	}
+
+	var data struct {
+		Tracks struct {
+			Items []Track `json:"items"`
+		} `json:"tracks"`
+	}
+	if err := c.getJSON(ctx, "/v1/search?"+vals.Encode(), &data); err != nil {
+		return nil, fmt.Errorf("getJSON: %w", err)
+	}
+	return data.Tracks.Items, nil
+}
+
+// GetTrack gets the track with the given ID.
+func (c *client) GetTrack(ctx context.Context, id string) (Track, error) {
+	var t Track
+	if err := c.getJSON(ctx, "/v1/tracks/"+url.PathEscape(id), &t); err != nil {
+		return Track{}, fmt.Errorf("getJSON: %w", err)
+	}
+	return t, nil
+}
+
+// maxArtistIDs is the maximum number of artists that can be requested at once.
+const maxArtistIDs = 50
+
+// GetArtists gets the artists with the given IDs, including their genres.
+// Artists that do not exist are left out.
+func (c *client) GetArtists(ctx context.Context, ids []string) ([]Artist, error) {
+	var artists []Artist
+	for len(ids) > 0 {
+		n := len(ids)
+		if n > maxArtistIDs {
+			n = maxArtistIDs
+		}
+		vals := url.Values{}
+		vals.Set("ids", strings.Join(ids[:n], ","))
+		ids = ids[n:]
+
+		var data struct {
+			Artists []*Artist `json:"artists"`
+		}
+		if err := c.getJSON(ctx, "/v1/artists?"+vals.Encode(), &data); err != nil {
+			return nil, fmt.Errorf("getJSON: %w", err)
+		}
+		for _, a := range data.Artists {
+			if a != nil {
+				artists = append(artists, *a)
+			}
+		}
+	}
+	return artists, nil
+}
@@ -2,10 +2,14 @@ package spotify
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"io/ioutil"
 	"net/http"
 	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 )
@@ -48,7 +52,7 @@ func TestBearerToken(t *testing.T) {
 		c.authBaseURL = ts.URL
 		c.nowFunc = func() time.Time { return now }
 
-		if err := c.bearerToken(context.Background()); err != nil {
+		if _, err := c.bearerToken(context.Background()); err != nil {
 			t.Fatalf("Got %T (%s), expected nil", err, err)
 		}
 
@@ -82,7 +86,7 @@ func TestBearerToken(t *testing.T) {
 			bearer:    "secret",
 		}
 
-		if err := c.bearerToken(context.Background()); err != nil {
+		if _, err := c.bearerToken(context.Background()); err != nil {
 			t.Fatalf("Got %T (%s), expected nil", err, err)
 		}
 	})
@@ -128,7 +132,7 @@ func TestBearerToken(t *testing.T) {
 			expiresAt: now.Add(4 * time.Second),
 		}
 
-		if err := c.bearerToken(context.Background()); err != nil {
+		if _, err := c.bearerToken(context.Background()); err != nil {
 			t.Fatalf("Got %T (%s), expected nil", err, err)
 		}
 
@@ -148,6 +152,261 @@ func TestBearerToken(t *testing.T) {
 	})
 }
 
+func TestBearerTokenConcurrent(t *testing.T) {
+	t.Run("Single flight", func(t *testing.T) {
+		var calls int32
+		release := make(chan struct{})
+		ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			atomic.AddInt32(&calls, 1)
+			<-release
+			_, _ = fmt.Fprint(w, `{"access_token":"secret","token_type":"Bearer","expires_in":3600}`)
+		}))
+		defer ts.Close()
+
+		c := NewClient("foo", "bar", "baz")
+		c.authBaseURL = ts.URL
+
+		const n = 20
+		var wg sync.WaitGroup
+		errs := make(chan error, n)
+		for i := 0; i < n; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				bearer, err := c.bearerToken(context.Background())
+				if err == nil && bearer != "secret" {
+					err = fmt.Errorf("got %q, expected secret", bearer)
+				}
+				errs <- err
+			}()
+		}
+		// Give all goroutines a chance to pile up behind the first request.
+		time.Sleep(50 * time.Millisecond)
+		close(release)
+		wg.Wait()
+		close(errs)
+
+		for err := range errs {
+			if err != nil {
+				t.Errorf("Got %T (%s), expected nil", err, err)
+			}
+		}
+		if n := atomic.LoadInt32(&calls); n != 1 {
+			t.Errorf("Got %d, expected 1", n)
+		}
+	})
+
+	t.Run("Failure shared", func(t *testing.T) {
+		var calls int32
+		release := make(chan struct{})
+		ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			atomic.AddInt32(&calls, 1)
+			<-release
+			w.WriteHeader(http.StatusBadRequest)
+			_, _ = fmt.Fprint(w, `{"error":"invalid_grant","error_description":"Refresh token revoked"}`)
+		}))
+		defer ts.Close()
+
+		c := NewClient("foo", "bar", "baz")
+		c.authBaseURL = ts.URL
+
+		const n = 5
+		var wg sync.WaitGroup
+		errs := make(chan error, n)
+		for i := 0; i < n; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				_, err := c.bearerToken(context.Background())
+				errs <- err
+			}()
+		}
+		time.Sleep(50 * time.Millisecond)
+		close(release)
+		wg.Wait()
+		close(errs)
+
+		for err := range errs {
+			if !errors.Is(err, ErrUnauthorized) {
+				t.Errorf("Got %T (%v), expected ErrUnauthorized", err, err)
+			}
+		}
+		if n := atomic.LoadInt32(&calls); n != 1 {
+			t.Errorf("Got %d, expected 1", n)
+		}
+	})
+
+	t.Run("Leader gave up", func(t *testing.T) {
+		var calls int32
+		received, release := make(chan struct{}), make(chan struct{})
+		ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if atomic.AddInt32(&calls, 1) == 1 {
+				// Hang until the first caller gave up.
+				close(received)
+				<-release
+				return
+			}
+			_, _ = fmt.Fprint(w, `{"access_token":"secret","token_type":"Bearer","expires_in":3600}`)
+		}))
+		defer ts.Close()
+		defer close(release)
+
+		c := NewClient("foo", "bar", "baz")
+		c.authBaseURL = ts.URL
+
+		ctx, cancel := context.WithCancel(context.Background())
+		leaderErr := make(chan error, 1)
+		go func() {
+			_, err := c.bearerToken(ctx)
+			leaderErr <- err
+		}()
+		<-received
+		waiter := make(chan error, 1)
+		go func() {
+			bearer, err := c.bearerToken(context.Background())
+			if err == nil && bearer != "secret" {
+				err = fmt.Errorf("got %q, expected secret", bearer)
+			}
+			waiter <- err
+		}()
+		// Give the second caller a chance to wait for the first.
+		time.Sleep(50 * time.Millisecond)
+		cancel()
+
+		if err := <-leaderErr; !errors.Is(err, context.Canceled) {
+			t.Errorf("Got %T (%v), expected context.Canceled", err, err)
+		}
+		// The second caller is not bothered by the first giving up.
+		if err := <-waiter; err != nil {
+			t.Errorf("Got %T (%s), expected nil", err, err)
+		}
+		if n := atomic.LoadInt32(&calls); n != 2 {
+			t.Errorf("Got %d, expected 2", n)
+		}
+	})
+
+	t.Run("Concurrent API requests", func(t *testing.T) {
+		authTS := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			_, _ = fmt.Fprint(w, `{"access_token":"secret","token_type":"Bearer","expires_in":3600}`)
+		}))
+		defer authTS.Close()
+		apiTS := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if ah := r.Header.Get("Authorization"); ah != "Bearer secret" {
+				t.Errorf("Got %q, expected Bearer secret", ah)
+			}
+			w.WriteHeader(http.StatusNoContent)
+		}))
+		defer apiTS.Close()
+
+		c := NewClient("foo", "bar", "baz")
+		c.authBaseURL = authTS.URL
+		c.apiBaseURL = apiTS.URL
+
+		var wg sync.WaitGroup
+		for i := 0; i < 10; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				if err := c.AddToQueue(context.Background(), "foo"); err != nil {
+					t.Errorf("Got %T (%s), expected nil", err, err)
+				}
+			}()
+		}
+		wg.Wait()
+	})
+}
+
+func TestBearerTokenErrors(t *testing.T) {
+	t.Run("Error status", func(t *testing.T) {
+		ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusBadRequest)
+			_, _ = fmt.Fprint(w, `{"error":"invalid_grant","error_description":"Invalid refresh token"}`)
+		}))
+		defer ts.Close()
+
+		c := NewClient("foo", "bar", "baz")
+		c.authBaseURL = ts.URL
+		_, err := c.bearerToken(context.Background())
+		var aerr *AuthError
+		if !errors.As(err, &aerr) {
+			t.Fatalf("Got %T (%v), expected *AuthError", err, err)
+		}
+		if aerr.Code != "invalid_grant" {
+			t.Errorf("Got %q, expected invalid_grant", aerr.Code)
+		}
+		if aerr.Description != "Invalid refresh token" {
+			t.Errorf("Got %q, expected Invalid refresh token", aerr.Description)
+		}
+		if aerr.Temporary() {
+			t.Error("Got true, expected false")
+		}
+		if c.token != nil {
+			t.Errorf("Got %+v, expected nil", c.token)
+		}
+	})
+
+	t.Run("Server error", func(t *testing.T) {
+		ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			_, _ = fmt.Fprint(w, "<html>Down for maintenance</html>")
+		}))
+		defer ts.Close()
+
+		c := NewClient("foo", "bar", "baz")
+		c.authBaseURL = ts.URL
+		_, err := c.bearerToken(context.Background())
+		var aerr *AuthError
+		if !errors.As(err, &aerr) {
+			t.Fatalf("Got %T (%v), expected *AuthError", err, err)
+		}
+		if !aerr.Temporary() {
+			t.Error("Got false, expected true")
+		}
+	})
+
+	t.Run("No access token", func(t *testing.T) {
+		ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			_, _ = fmt.Fprint(w, `{}`)
+		}))
+		defer ts.Close()
+
+		c := NewClient("foo", "bar", "baz")
+		c.authBaseURL = ts.URL
+		if _, err := c.bearerToken(context.Background()); err == nil {
+			t.Error("Got nil, expected error")
+		}
+	})
+}
+
+func TestBearerTokenRotated(t *testing.T) {
+	var refreshTokens []string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := r.ParseForm(); err != nil {
+			t.Errorf("Got %T (%s), expected nil", err, err)
+		}
+		refreshTokens = append(refreshTokens, r.PostForm.Get("refresh_token"))
+		_, _ = fmt.Fprint(w, `{"access_token":"secret","token_type":"Bearer","expires_in":3600,"refresh_token":"rotated"}`)
+	}))
+	defer ts.Close()
+
+	now, _ := time.Parse(time.RFC3339, "2000-01-01T00:00:00Z")
+	c := NewClient("foo", "bar", "baz")
+	c.authBaseURL = ts.URL
+	c.nowFunc = func() time.Time { return now }
+
+	if _, err := c.bearerToken(context.Background()); err != nil {
+		t.Fatalf("Got %T (%s), expected nil", err, err)
+	}
+	now = now.Add(time.Hour)
+	if _, err := c.bearerToken(context.Background()); err != nil {
+		t.Fatalf("Got %T (%s), expected nil", err, err)
+	}
+
+	if s := strings.Join(refreshTokens, ","); s != "baz,rotated" {
+		t.Errorf("Got %q, expected baz,rotated", s)
+	}
+}
+
 func TestAPIRequest(t *testing.T) {
 	apiTS := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		if ah := r.Header.Get("Authorization"); ah != "Bearer secret" {
@@ -205,6 +464,82 @@ func TestAPIRequest(t *testing.T) {
 	}
 }
 
+func TestAPIRequestUnauthorized(t *testing.T) {
+	var tokens int32
+	authTS := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := atomic.AddInt32(&tokens, 1)
+		_, _ = fmt.Fprintf(w, `{"access_token":"secret%d","token_type":"Bearer","expires_in":3600}`, n)
+	}))
+	defer authTS.Close()
+
+	t.Run("Retried with a new token", func(t *testing.T) {
+		atomic.StoreInt32(&tokens, 0)
+		var bearers []string
+		apiTS := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ah := r.Header.Get("Authorization")
+			bearers = append(bearers, ah)
+			if ah == "Bearer secret1" {
+				// Revoked before it expired.
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			w.WriteHeader(http.StatusNoContent)
+		}))
+		defer apiTS.Close()
+
+		c := NewClient("foo", "bar", "baz")
+		c.apiBaseURL = apiTS.URL
+		c.authBaseURL = authTS.URL
+
+		res, err := c.apiRequest(context.Background(), http.MethodGet, "/foo", nil)
+		if err != nil {
+			t.Fatalf("Got %T (%s), expected nil", err, err)
+		}
+		_ = res.Body.Close()
+		if res.StatusCode != http.StatusNoContent {
+			t.Errorf("Got %d, expected 204", res.StatusCode)
+		}
+		if s := strings.Join(bearers, ","); s != "Bearer secret1,Bearer secret2" {
+			t.Errorf("Got %q, expected Bearer secret1,Bearer secret2", s)
+		}
+	})
+
+	t.Run("Retried once", func(t *testing.T) {
+		atomic.StoreInt32(&tokens, 0)
+		var calls int
+		apiTS := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			calls++
+			w.WriteHeader(http.StatusUnauthorized)
+		}))
+		defer apiTS.Close()
+
+		c := NewClient("foo", "bar", "baz")
+		c.apiBaseURL = apiTS.URL
+		c.authBaseURL = authTS.URL
+
+		res, err := c.apiRequest(context.Background(), http.MethodGet, "/foo", nil)
+		if err != nil {
+			t.Fatalf("Got %T (%s), expected nil", err, err)
+		}
+		_ = res.Body.Close()
+		if res.StatusCode != http.StatusUnauthorized {
+			t.Errorf("Got %d, expected 401", res.StatusCode)
+		}
+		if calls != 2 {
+			t.Errorf("Got %d, expected 2", calls)
+		}
+	})
+
+	t.Run("Token replaced meanwhile", func(t *testing.T) {
+		c := NewClient("foo", "bar", "baz")
+		c.token = &token{bearer: "new", expiresAt: time.Now().Add(time.Hour)}
+		c.dropToken("old")
+		if c.token == nil || c.token.bearer != "new" {
+			t.Errorf("Got %+v, expected the new token to be kept", c.token)
+		}
+	})
+}
+
 func TestAddToQueue(t *testing.T) {
 	t.Run("OK", func(t *testing.T) {
 		var called bool
@@ -263,4 +598,351 @@ func TestAddToQueue(t *testing.T) {
 			t.Error("Got false, expected true")
 		}
 	})
+
+	t.Run("No active device", func(t *testing.T) {
+		ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusNotFound)
+			_, _ = fmt.Fprint(w, `{"error":{"status":404,"message":"Player command failed: No active device found","reason":"NO_ACTIVE_DEVICE"}}`)
+		}))
+		defer ts.Close()
+
+		c := NewClient("foo", "bar", "baz")
+		c.apiBaseURL = ts.URL
+		c.token = &token{
+			bearer:    "secret",
+			expiresAt: c.nowFunc().Add(1800 * time.Second),
+		}
+		err := c.AddToQueue(context.Background(), "foo")
+		if !errors.Is(err, ErrNoActiveDevice) {
+			t.Errorf("Got %T (%v), expected ErrNoActiveDevice", err, err)
+		}
+		var serr *Error
+		if !errors.As(err, &serr) {
+			t.Fatalf("Got %T, expected *Error", err)
+		}
+		if serr.Message != "Player command failed: No active device found" {
+			t.Errorf("Got %q, expected Player command failed: No active device found", serr.Message)
+		}
+	})
+}
+
+func TestAlbumTracks(t *testing.T) {
+	t.Run("Paginated", func(t *testing.T) {
+		var calls int
+		ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			calls++
+
+			if r.URL.Path != "/v1/albums/foo/tracks" {
+				t.Errorf("Got %q, expected /v1/albums/foo/tracks", r.URL.Path)
+			}
+			if l := r.URL.Query().Get("limit"); l != "50" {
+				t.Errorf("Got %q, expected 50", l)
+			}
+			switch o := r.URL.Query().Get("offset"); o {
+			case "0":
+				_, _ = fmt.Fprint(w, `{"items":[{"uri":"spotify:track:a"},{"uri":"spotify:track:b"}],"total":3}`)
+			case "2":
+				_, _ = fmt.Fprint(w, `{"items":[{"uri":"spotify:track:c"}],"total":3}`)
+			default:
+				t.Errorf("Unexpected offset %q", o)
+			}
+		}))
+		defer ts.Close()
+
+		c := NewClient("foo", "bar", "baz")
+		c.apiBaseURL = ts.URL
+		c.token = &token{
+			bearer:    "secret",
+			expiresAt: c.nowFunc().Add(1800 * time.Second),
+		}
+		uris, err := c.AlbumTracks(context.Background(), "foo", 10)
+		if err != nil {
+			t.Fatalf("Got %T (%s), expected nil", err, err)
+		}
+		if s := strings.Join(uris, ","); s != "spotify:track:a,spotify:track:b,spotify:track:c" {
+			t.Errorf("Got %q, expected spotify:track:a,spotify:track:b,spotify:track:c", s)
+		}
+		if calls != 2 {
+			t.Errorf("Got %d, expected 2", calls)
+		}
+	})
+
+	t.Run("Max", func(t *testing.T) {
+		var calls int
+		ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			calls++
+
+			_, _ = fmt.Fprint(w, `{"items":[{"uri":"spotify:track:a"},{"uri":"spotify:track:b"}],"total":4}`)
+		}))
+		defer ts.Close()
+
+		c := NewClient("foo", "bar", "baz")
+		c.apiBaseURL = ts.URL
+		c.token = &token{
+			bearer:    "secret",
+			expiresAt: c.nowFunc().Add(1800 * time.Second),
+		}
+		uris, err := c.AlbumTracks(context.Background(), "foo", 1)
+		if err != nil {
+			t.Fatalf("Got %T (%s), expected nil", err, err)
+		}
+		if s := strings.Join(uris, ","); s != "spotify:track:a" {
+			t.Errorf("Got %q, expected spotify:track:a", s)
+		}
+		if calls != 1 {
+			t.Errorf("Got %d, expected 1", calls)
+		}
+	})
+
+	t.Run("Bad response", func(t *testing.T) {
+		ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusNotFound)
+		}))
+		defer ts.Close()
+
+		c := NewClient("foo", "bar", "baz")
+		c.apiBaseURL = ts.URL
+		c.token = &token{
+			bearer:    "secret",
+			expiresAt: c.nowFunc().Add(1800 * time.Second),
+		}
+		if _, err := c.AlbumTracks(context.Background(), "foo", 10); err == nil {
+			t.Error("Got nil, expected error")
+		}
+	})
+}
+
+func TestPlaylistTracks(t *testing.T) {
+	var calls int
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+
+		if r.URL.Path != "/v1/playlists/foo/tracks" {
+			t.Errorf("Got %q, expected /v1/playlists/foo/tracks", r.URL.Path)
+		}
+		if l := r.URL.Query().Get("limit"); l != "100" {
+			t.Errorf("Got %q, expected 100", l)
+		}
+		switch o := r.URL.Query().Get("offset"); o {
+		case "0":
+			_, _ = fmt.Fprint(w, `{"items":[
+				{"is_local":false,"track":{"type":"track","uri":"spotify:track:a"}},
+				{"is_local":true,"track":{"type":"track","uri":"spotify:local:x"}},
+				{"is_local":false,"track":null},
+				{"is_local":false,"track":{"type":"episode","uri":"spotify:episode:e"}}
+			],"total":5}`)
+		case "4":
+			_, _ = fmt.Fprint(w, `{"items":[{"is_local":false,"track":{"type":"track","uri":"spotify:track:b"}}],"total":5}`)
+		default:
+			t.Errorf("Unexpected offset %q", o)
+		}
+	}))
+	defer ts.Close()
+
+	c := NewClient("foo", "bar", "baz")
+	c.apiBaseURL = ts.URL
+	c.token = &token{
+		bearer:    "secret",
+		expiresAt: c.nowFunc().Add(1800 * time.Second),
+	}
+	uris, err := c.PlaylistTracks(context.Background(), "foo", 10)
+	if err != nil {
+		t.Fatalf("Got %T (%s), expected nil", err, err)
+	}
+	if s := strings.Join(uris, ","); s != "spotify:track:a,spotify:track:b" {
+		t.Errorf("Got %q, expected spotify:track:a,spotify:track:b", s)
+	}
+	if calls != 2 {
+		t.Errorf("Got %d, expected 2", calls)
+	}
+}
+
+func TestSearch(t *testing.T) {
+	t.Run("OK", func(t *testing.T) {
+		ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Path != "/v1/search" {
+				t.Errorf("Got %q, expected /v1/search", r.URL.Path)
+			}
+			q := r.URL.Query()
+			if v := q.Get("q"); v != "queen bohemian rhapsody" {
+				t.Errorf("Got %q, expected queen bohemian rhapsody", v)
+			}
+			if v := q.Get("type"); v != "track" {
+				t.Errorf("Got %q, expected track", v)
+			}
+			if v := q.Get("limit"); v != "5" {
+				t.Errorf("Got %q, expected 5", v)
+			}
+			if v := q.Get("market"); v != "NL" {
+				t.Errorf("Got %q, expected NL", v)
+			}
+
+			_, _ = fmt.Fprint(w, `{"tracks":{"items":[{
+				"id":"4u7EnebtmKWzUH433cf5Qv",
+				"uri":"spotify:track:4u7EnebtmKWzUH433cf5Qv",
+				"name":"Bohemian Rhapsody",
+				"duration_ms":354320,
+				"explicit":false,
+				"artists":[{"name":"Queen"}],
+				"album":{"name":"A Night At The Opera","images":[{"url":"https://i.scdn.co/image/foo","height":640,"width":640}]}
+			}]}}`)
+		}))
+		defer ts.Close()
+
+		c := NewClient("foo", "bar", "baz")
+		c.apiBaseURL = ts.URL
+		c.token = &token{
+			bearer:    "secret",
+			expiresAt: c.nowFunc().Add(1800 * time.Second),
+		}
+		tracks, err := c.Search(context.Background(), "queen bohemian rhapsody", "NL", 5)
+		if err != nil {
+			t.Fatalf("Got %T (%s), expected nil", err, err)
+		}
+		if len(tracks) != 1 {
+			t.Fatalf("Got %d, expected 1", len(tracks))
+		}
+		tr := tracks[0]
+		if tr.URI != "spotify:track:4u7EnebtmKWzUH433cf5Qv" {
+			t.Errorf("Got %q, expected spotify:track:4u7EnebtmKWzUH433cf5Qv", tr.URI)
+		}
+		if tr.Name != "Bohemian Rhapsody" {
+			t.Errorf("Got %q, expected Bohemian Rhapsody", tr.Name)
+		}
+		if len(tr.Artists) != 1 || tr.Artists[0].Name != "Queen" {
+			t.Errorf("Got %+v, expected [Queen]", tr.Artists)
+		}
+		if tr.Album.Name != "A Night At The Opera" {
+			t.Errorf("Got %q, expected A Night At The Opera", tr.Album.Name)
+		}
+		if tr.DurationMS != 354320 {
+			t.Errorf("Got %d, expected 354320", tr.DurationMS)
+		}
+	})
+
+	t.Run("Bad response", func(t *testing.T) {
+		ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusBadRequest)
+		}))
+		defer ts.Close()
+
+		c := NewClient("foo", "bar", "baz")
+		c.apiBaseURL = ts.URL
+		c.token = &token{
+			bearer:    "secret",
+			expiresAt: c.nowFunc().Add(1800 * time.Second),
+		}
+		if _, err := c.Search(context.Background(), "foo", "", 5); err == nil {
+			t.Error("Got nil, expected error")
+		}
+	})
+}
+
+func TestGetTrack(t *testing.T) {
+	t.Run("OK", func(t *testing.T) {
+		ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Path != "/v1/tracks/4u7EnebtmKWzUH433cf5Qv" {
+				t.Errorf("Got %q, expected /v1/tracks/4u7EnebtmKWzUH433cf5Qv", r.URL.Path)
+			}
+			_, _ = fmt.Fprint(w, `{
+				"id":"4u7EnebtmKWzUH433cf5Qv",
+				"uri":"spotify:track:4u7EnebtmKWzUH433cf5Qv",
+				"name":"Bohemian Rhapsody",
+				"duration_ms":354320,
+				"explicit":true,
+				"artists":[{"id":"1dfeR4HaWDbWqFHLkxsg1d","name":"Queen"}]
+			}`)
+		}))
+		defer ts.Close()
+
+		c := NewClient("foo", "bar", "baz")
+		c.apiBaseURL = ts.URL
+		c.token = &token{
+			bearer:    "secret",
+			expiresAt: c.nowFunc().Add(1800 * time.Second),
+		}
+		tr, err := c.GetTrack(context.Background(), "4u7EnebtmKWzUH433cf5Qv")
+		if err != nil {
+			t.Fatalf("Got %T (%s), expected nil", err, err)
+		}
+		if tr.Name != "Bohemian Rhapsody" {
+			t.Errorf("Got %q, expected Bohemian Rhapsody", tr.Name)
+		}
+		if !tr.Explicit {
+			t.Error("Got false, expected true")
+		}
+		if len(tr.Artists) != 1 || tr.Artists[0].ID != "1dfeR4HaWDbWqFHLkxsg1d" {
+			t.Errorf("Got %+v, expected [Queen]", tr.Artists)
+		}
+	})
+
+	t.Run("Not found", func(t *testing.T) {
+		ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusNotFound)
+			_, _ = fmt.Fprint(w, `{"error":{"status":404,"message":"Not found."}}`)
+		}))
+		defer ts.Close()
+
+		c := NewClient("foo", "bar", "baz")
+		c.apiBaseURL = ts.URL
+		c.token = &token{
+			bearer:    "secret",
+			expiresAt: c.nowFunc().Add(1800 * time.Second),
+		}
+		if _, err := c.GetTrack(context.Background(), "foo"); !errors.Is(err, ErrNotFound) {
+			t.Errorf("Got %v, expected %v", err, ErrNotFound)
+		}
+	})
+}
+
+func TestGetArtists(t *testing.T) {
+	var calls int
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		if r.URL.Path != "/v1/artists" {
+			t.Errorf("Got %q, expected /v1/artists", r.URL.Path)
+		}
+		ids := strings.Split(r.URL.Query().Get("ids"), ",")
+		switch calls {
+		case 1:
+			if len(ids) != maxArtistIDs {
+				t.Errorf("Got %d, expected %d", len(ids), maxArtistIDs)
+			}
+			// Unknown artists come back as null.
+			_, _ = fmt.Fprint(w, `{"artists":[{"id":"a0","name":"Queen","genres":["classic rock","glam rock"]},null]}`)
+		case 2:
+			if len(ids) != 1 || ids[0] != "a50" {
+				t.Errorf("Got %v, expected [a50]", ids)
+			}
+			_, _ = fmt.Fprint(w, `{"artists":[{"id":"a50","name":"ABBA","genres":["europop"]}]}`)
+		}
+	}))
+	defer ts.Close()
+
+	c := NewClient("foo", "bar", "baz")
+	c.apiBaseURL = ts.URL
+	c.token = &token{
+		bearer:    "secret",
+		expiresAt: c.nowFunc().Add(1800 * time.Second),
+	}
+	var ids []string
+	for i := 0; i <= maxArtistIDs; i++ {
+		ids = append(ids, fmt.Sprintf("a%d", i))
+	}
+	artists, err := c.GetArtists(context.Background(), ids)
+	if err != nil {
+		t.Fatalf("Got %T (%s), expected nil", err, err)
+	}
+	if calls != 2 {
+		t.Errorf("Got %d, expected 2", calls)
+	}
+	if len(artists) != 2 {
+		t.Fatalf("Got %d, expected 2", len(artists))
+	}
+	if g := strings.Join(artists[0].Genres, ","); g != "classic rock,glam rock" {
+		t.Errorf("Got %q, expected classic rock,glam rock", g)
+	}
+	if artists[1].Name != "ABBA" {
+		t.Errorf("Got %q, expected ABBA", artists[1].Name)
+	}
 }
@@ -0,0 +1,161 @@
+package spotify
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"time"
+)
+
+// Error is an error response from the Spotify Web API. Use errors.Is with one
+// of the sentinel errors below to inspect it, e.g.:
+//
+//	if errors.Is(err, spotify.ErrNoActiveDevice) {
+//		// Ask the host to open Spotify.
+//	}
+type Error struct {
+	// Status is the HTTP response status.
+	Status int `json:"status"`
+	// Message is a short description of the cause of the error.
+	Message string `json:"message"`
+	// Reason is only set for player errors, e.g. NO_ACTIVE_DEVICE.
+	Reason string `json:"reason"`
+	// RetryAfter is only set for rate limit errors: it is the time to wait
+	// before sending another request.
+	RetryAfter time.Duration `json:"-"`
+}
+
+// Player error reasons, as documented by Spotify.
+const (
+	ReasonNoActiveDevice  = "NO_ACTIVE_DEVICE"
+	ReasonPremiumRequired = "PREMIUM_REQUIRED"
+)
+
+var (
+	// ErrBadRequest is returned when the request was rejected as invalid.
+	ErrBadRequest = errors.New("bad request")
+	// ErrNoActiveDevice is returned for player requests when the user has no
+	// Spotify app open to play on.
+	ErrNoActiveDevice = errors.New("no active device")
+	// ErrNotFound is returned when the requested resource does not exist.
+	ErrNotFound = errors.New("not found")
+	// ErrPremiumRequired is returned for player requests on behalf of a user
+	// without Spotify Premium.
+	ErrPremiumRequired = errors.New("premium required")
+	// ErrRateLimited is returned when the app exceeded Spotify's rate limit.
+	ErrRateLimited = errors.New("rate limited")
+	// ErrUnauthorized is returned when the access token was rejected.
+	ErrUnauthorized = errors.New("unauthorized")
+)
+
+func (e *Error) Error() string {
+	if e.Reason != "" {
+		return fmt.Sprintf("spotify: %d %s (%s)", e.Status, e.Message, e.Reason)
+	}
+	return fmt.Sprintf("spotify: %d %s", e.Status, e.Message)
+}
+
+// Is makes the error match the sentinel error that describes it best.
+func (e *Error) Is(target error) bool {
+	switch target {
+	case ErrBadRequest:
+		return e.Status == http.StatusBadRequest
+	case ErrNoActiveDevice:
+		return e.Reason == ReasonNoActiveDevice
+	case ErrNotFound:
+		return e.Status == http.StatusNotFound && e.Reason != ReasonNoActiveDevice
+	case ErrPremiumRequired:
+		return e.Reason == ReasonPremiumRequired
+	case ErrRateLimited:
+		return e.Status == http.StatusTooManyRequests
+	case ErrUnauthorized:
+		return e.Status == http.StatusUnauthorized
+	}
+	return false
+}
+
+// Temporary reports whether the request that caused the error may succeed if
+// it is retried later, possibly after the user took action (like opening their
+// Spotify app).
+func (e *Error) Temporary() bool {
+	switch {
+	case e.Reason == ReasonNoActiveDevice:
+		return true
+	case e.Status == http.StatusUnauthorized, e.Status == http.StatusTooManyRequests:
+		// A rejected access token is replaced by apiRequest, and rate
+		// limits are temporary by definition.
+		return true
+	case e.Status >= 500:
+		return true
+	}
+	return false
+}
+
+// newError creates an *Error from an unexpected API response. Spotify's JSON
+// error object is used if present, falling back to the raw body otherwise. Now
+// is the time the response was received at.
+func newError(res *http.Response, now time.Time) error {
+	b, _ := ioutil.ReadAll(io.LimitReader(res.Body, 64<<10))
+	e := Error{Status: res.StatusCode}
+	var data struct {
+		Error *Error `json:"error"`
+	}
+	if err := json.Unmarshal(b, &data); err == nil && data.Error != nil {
+		e.Message = data.Error.Message
+		e.Reason = data.Error.Reason
+	} else {
+		e.Message = string(b)
+	}
+	if e.Message == "" {
+		e.Message = http.StatusText(res.StatusCode)
+	}
+	if res.StatusCode == http.StatusTooManyRequests {
+		e.RetryAfter = retryAfter(res.Header, now)
+	}
+	return &e
+}
+
+// AuthError is an error response from the Spotify Accounts service, which
+// issues access tokens.
+type AuthError struct {
+	// Status is the HTTP response status.
+	Status int `json:"-"`
+	// Code is the OAuth 2.0 error code, e.g. invalid_grant.
+	Code        string `json:"error"`
+	Description string `json:"error_description"`
+}
+
+func (e *AuthError) Error() string {
+	return fmt.Sprintf("spotify: accounts: %d %s (%s)", e.Status, e.Code, e.Description)
+}
+
+// Is makes the error match ErrUnauthorized if the client credentials or the
+// refresh token were rejected, and ErrRateLimited if rate limited.
+func (e *AuthError) Is(target error) bool {
+	switch target {
+	case ErrUnauthorized:
+		return e.Status == http.StatusUnauthorized || e.Code == "invalid_grant" || e.Code == "invalid_client"
+	case ErrRateLimited:
+		return e.Status == http.StatusTooManyRequests
+	}
+	return false
+}
+
+// Temporary reports whether requesting a token may succeed if retried later.
+// Rejected credentials never will.
+func (e *AuthError) Temporary() bool {
+	return e.Status == http.StatusTooManyRequests || e.Status >= 500
+}
+
+func newAuthError(res *http.Response) error {
+	b, _ := ioutil.ReadAll(io.LimitReader(res.Body, 64<<10))
+	e := AuthError{Status: res.StatusCode}
+	if err := json.Unmarshal(b, &e); err != nil || e.Code == "" {
+		e.Code = http.StatusText(res.StatusCode)
+		e.Description = string(b)
+	}
+	return &e
+}
@@ -0,0 +1,93 @@
+package spotify
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestNewError(t *testing.T) {
+	now := time.Date(2020, 1, 1, 20, 0, 0, 0, time.UTC)
+	for _, tc := range []struct {
+		status     int
+		body       string
+		retryAfter string
+		exp        Error
+	}{
+		{
+			status: http.StatusNotFound,
+			body:   `{"error":{"status":404,"message":"Player command failed: No active device found","reason":"NO_ACTIVE_DEVICE"}}`,
+			exp:    Error{Status: 404, Message: "Player command failed: No active device found", Reason: "NO_ACTIVE_DEVICE"},
+		},
+		{
+			status: http.StatusUnauthorized,
+			body:   `{"error":{"status":401,"message":"The access token expired"}}`,
+			exp:    Error{Status: 401, Message: "The access token expired"},
+		},
+		{
+			status: http.StatusBadGateway,
+			body:   "<html>Bad gateway</html>",
+			exp:    Error{Status: 502, Message: "<html>Bad gateway</html>"},
+		},
+		{
+			status: http.StatusInternalServerError,
+			body:   "",
+			exp:    Error{Status: 500, Message: "Internal Server Error"},
+		},
+		{
+			status:     http.StatusTooManyRequests,
+			body:       "",
+			retryAfter: now.Add(time.Minute).Format(http.TimeFormat),
+			exp:        Error{Status: 429, Message: "Too Many Requests", RetryAfter: time.Minute},
+		},
+	} {
+		res := &http.Response{
+			StatusCode: tc.status,
+			Header:     http.Header{},
+			Body:       ioutil.NopCloser(strings.NewReader(tc.body)),
+		}
+		if tc.retryAfter != "" {
+			res.Header.Set("Retry-After", tc.retryAfter)
+		}
+		err := newError(res, now)
+		var serr *Error
+		if !errors.As(err, &serr) {
+			t.Fatalf("Got %T, expected *Error", err)
+		}
+		if *serr != tc.exp {
+			t.Errorf("Got %+v, expected %+v", *serr, tc.exp)
+		}
+	}
+}
+
+func TestErrorIs(t *testing.T) {
+	sentinels := []error{ErrBadRequest, ErrNoActiveDevice, ErrNotFound, ErrPremiumRequired, ErrRateLimited, ErrUnauthorized}
+	for _, tc := range []struct {
+		err       *Error
+		exp       error
+		temporary bool
+	}{
+		{&Error{Status: 400, Message: "Invalid base62 id"}, ErrBadRequest, false},
+		{&Error{Status: 401, Message: "The access token expired"}, ErrUnauthorized, true},
+		{&Error{Status: 403, Message: "Player command failed: Premium required", Reason: "PREMIUM_REQUIRED"}, ErrPremiumRequired, false},
+		{&Error{Status: 404, Message: "Player command failed: No active device found", Reason: "NO_ACTIVE_DEVICE"}, ErrNoActiveDevice, true},
+		{&Error{Status: 404, Message: "Non existing id"}, ErrNotFound, false},
+		{&Error{Status: 429, Message: "API rate limit exceeded"}, ErrRateLimited, true},
+		{&Error{Status: 503, Message: "Service unavailable"}, nil, true},
+	} {
+		// Errors are matched through wrapping.
+		err := fmt.Errorf("foo: %w", tc.err)
+		for _, s := range sentinels {
+			if got, exp := errors.Is(err, s), s == tc.exp; got != exp {
+				t.Errorf("%s: Got %t for %s, expected %t", tc.err, got, s, exp)
+			}
+		}
+		if tmp := tc.err.Temporary(); tmp != tc.temporary {
+			t.Errorf("%s: Got %t, expected %t", tc.err, tmp, tc.temporary)
+		}
+	}
+}
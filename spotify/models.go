@@ -0,0 +1,62 @@
+package spotify
+
+import "time"
+
+// Track is a (simplified) Spotify Web API track object.
+type Track struct {
+	ID         string   `json:"id"`
+	URI        string   `json:"uri"`
+	Name       string   `json:"name"`
+	DurationMS int      `json:"duration_ms"`
+	Explicit   bool     `json:"explicit"`
+	Artists    []Artist `json:"artists"`
+	Album      Album    `json:"album"`
+}
+
+// Artist is a Spotify Web API artist object. Genres are only set for full
+// artist objects, like the ones returned by GetArtists.
+type Artist struct {
+	ID     string   `json:"id"`
+	URI    string   `json:"uri"`
+	Name   string   `json:"name"`
+	Genres []string `json:"genres,omitempty"`
+}
+
+// Album is a (simplified) Spotify Web API album object.
+type Album struct {
+	ID     string  `json:"id"`
+	URI    string  `json:"uri"`
+	Name   string  `json:"name"`
+	Images []Image `json:"images"`
+}
+
+// Image is a Spotify Web API image object. Spotify orders images by size,
+// widest first.
+type Image struct {
+	URL    string `json:"url"`
+	Height int    `json:"height"`
+	Width  int    `json:"width"`
+}
+
+// CurrentlyPlaying is a Spotify Web API currently playing object. Item is nil
+// if what is playing is not a track, e.g. an ad or a podcast episode.
+type CurrentlyPlaying struct {
+	IsPlaying  bool   `json:"is_playing"`
+	ProgressMS int    `json:"progress_ms"`
+	Item       *Track `json:"item"`
+}
+
+// Remaining returns how much of the track is left to play.
+func (cp *CurrentlyPlaying) Remaining() time.Duration {
+	if cp.Item == nil {
+		return 0
+	}
+	return time.Duration(cp.Item.DurationMS-cp.ProgressMS) * time.Millisecond
+}
+
+// Queue is a Spotify Web API queue object: what is playing and what is up
+// next in the user's queue.
+type Queue struct {
+	CurrentlyPlaying *Track  `json:"currently_playing"`
+	Queue            []Track `json:"queue"`
+}
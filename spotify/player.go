@@ -0,0 +1,58 @@
+package spotify
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+)
+
+// CurrentlyPlaying gets what is playing on the user's account. If nothing is,
+// it returns nil and a nil error.
+func (c *client) CurrentlyPlaying(ctx context.Context) (*CurrentlyPlaying, error) {
+	res, err := c.apiRequest(ctx, http.MethodGet, "/v1/me/player/currently-playing", nil)
+	if err != nil {
+		return nil, fmt.Errorf("apiRequest: %w", err)
+	}
+	defer func() {
+		_ = res.Body.Close()
+	}()
+
+	switch res.StatusCode {
+	case http.StatusNoContent:
+		return nil, nil
+	case http.StatusOK:
+	default:
+		return nil, newError(res, c.nowFunc())
+	}
+	var cp CurrentlyPlaying
+	if err := json.NewDecoder(res.Body).Decode(&cp); err != nil {
+		return nil, fmt.Errorf("encoding/json: Decoder.Decode: %w", err)
+	}
+	return &cp, nil
+}
+
+// SkipToNext skips to the next track in the user's queue.
+func (c *client) SkipToNext(ctx context.Context) error {
+	res, err := c.apiRequest(ctx, http.MethodPost, "/v1/me/player/next", nil)
+	if err != nil {
+		return fmt.Errorf("apiRequest: %w", err)
+	}
+	defer func() {
+		_ = res.Body.Close()
+	}()
+
+	if res.StatusCode != http.StatusNoContent && res.StatusCode != http.StatusOK {
+		return newError(res, c.nowFunc())
+	}
+	return nil
+}
+
+// Queue gets what is playing and the tracks in the user's queue.
+func (c *client) Queue(ctx context.Context) (*Queue, error) {
+	var q Queue
+	if err := c.getJSON(ctx, "/v1/me/player/queue", &q); err != nil {
+		return nil, fmt.Errorf("getJSON: %w", err)
+	}
+	return &q, nil
+}
@@ -0,0 +1,158 @@
+package spotify
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestCurrentlyPlaying(t *testing.T) {
+	t.Run("OK", func(t *testing.T) {
+		ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Path != "/v1/me/player/currently-playing" {
+				t.Errorf("Got %q, expected /v1/me/player/currently-playing", r.URL.Path)
+			}
+			_, _ = fmt.Fprint(w, `{
+				"is_playing":true,
+				"progress_ms":340320,
+				"item":{"id":"4u7EnebtmKWzUH433cf5Qv","name":"Bohemian Rhapsody","duration_ms":354320}
+			}`)
+		}))
+		defer ts.Close()
+
+		c := NewClient("foo", "bar", "baz")
+		c.apiBaseURL = ts.URL
+		c.token = &token{
+			bearer:    "secret",
+			expiresAt: c.nowFunc().Add(1800 * time.Second),
+		}
+		cp, err := c.CurrentlyPlaying(context.Background())
+		if err != nil {
+			t.Fatalf("Got %T (%s), expected nil", err, err)
+		}
+		if !cp.IsPlaying {
+			t.Error("Got false, expected true")
+		}
+		if cp.Item == nil || cp.Item.Name != "Bohemian Rhapsody" {
+			t.Fatalf("Got %+v, expected Bohemian Rhapsody", cp.Item)
+		}
+		if d := cp.Remaining(); d != 14*time.Second {
+			t.Errorf("Got %s, expected 14s", d)
+		}
+	})
+
+	t.Run("Nothing playing", func(t *testing.T) {
+		ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusNoContent)
+		}))
+		defer ts.Close()
+
+		c := NewClient("foo", "bar", "baz")
+		c.apiBaseURL = ts.URL
+		c.token = &token{
+			bearer:    "secret",
+			expiresAt: c.nowFunc().Add(1800 * time.Second),
+		}
+		cp, err := c.CurrentlyPlaying(context.Background())
+		if err != nil {
+			t.Fatalf("Got %T (%s), expected nil", err, err)
+		}
+		if cp != nil {
+			t.Errorf("Got %+v, expected nil", cp)
+		}
+	})
+
+	t.Run("Bad response", func(t *testing.T) {
+		ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusUnauthorized)
+		}))
+		defer ts.Close()
+
+		c := NewClient("foo", "bar", "baz")
+		c.apiBaseURL = ts.URL
+		c.token = &token{
+			bearer:    "secret",
+			expiresAt: c.nowFunc().Add(1800 * time.Second),
+		}
+		if _, err := c.CurrentlyPlaying(context.Background()); err == nil {
+			t.Error("Got nil, expected error")
+		}
+	})
+}
+
+func TestSkipToNext(t *testing.T) {
+	t.Run("OK", func(t *testing.T) {
+		ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Method != http.MethodPost {
+				t.Errorf("Got %q, expected POST", r.Method)
+			}
+			if r.URL.Path != "/v1/me/player/next" {
+				t.Errorf("Got %q, expected /v1/me/player/next", r.URL.Path)
+			}
+			w.WriteHeader(http.StatusNoContent)
+		}))
+		defer ts.Close()
+
+		c := NewClient("foo", "bar", "baz")
+		c.apiBaseURL = ts.URL
+		c.token = &token{
+			bearer:    "secret",
+			expiresAt: c.nowFunc().Add(1800 * time.Second),
+		}
+		if err := c.SkipToNext(context.Background()); err != nil {
+			t.Errorf("Got %T (%s), expected nil", err, err)
+		}
+	})
+
+	t.Run("No active device", func(t *testing.T) {
+		ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusNotFound)
+			_, _ = fmt.Fprint(w, `{"error":{"status":404,"message":"Player command failed: No active device found","reason":"NO_ACTIVE_DEVICE"}}`)
+		}))
+		defer ts.Close()
+
+		c := NewClient("foo", "bar", "baz")
+		c.apiBaseURL = ts.URL
+		c.token = &token{
+			bearer:    "secret",
+			expiresAt: c.nowFunc().Add(1800 * time.Second),
+		}
+		if err := c.SkipToNext(context.Background()); !errors.Is(err, ErrNoActiveDevice) {
+			t.Errorf("Got %v, expected %v", err, ErrNoActiveDevice)
+		}
+	})
+}
+
+func TestQueue(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/me/player/queue" {
+			t.Errorf("Got %q, expected /v1/me/player/queue", r.URL.Path)
+		}
+		_, _ = fmt.Fprint(w, `{
+			"currently_playing":{"uri":"spotify:track:4u7EnebtmKWzUH433cf5Qv","name":"Bohemian Rhapsody"},
+			"queue":[{"uri":"spotify:track:1301WleyT98MSxVHPZCA6M","name":"Mr. Brightside"}]
+		}`)
+	}))
+	defer ts.Close()
+
+	c := NewClient("foo", "bar", "baz")
+	c.apiBaseURL = ts.URL
+	c.token = &token{
+		bearer:    "secret",
+		expiresAt: c.nowFunc().Add(1800 * time.Second),
+	}
+	q, err := c.Queue(context.Background())
+	if err != nil {
+		t.Fatalf("Got %T (%s), expected nil", err, err)
+	}
+	if q.CurrentlyPlaying == nil || q.CurrentlyPlaying.Name != "Bohemian Rhapsody" {
+		t.Errorf("Got %+v, expected Bohemian Rhapsody", q.CurrentlyPlaying)
+	}
+	if len(q.Queue) != 1 || q.Queue[0].Name != "Mr. Brightside" {
+		t.Errorf("Got %+v, expected [Mr. Brightside]", q.Queue)
+	}
+}
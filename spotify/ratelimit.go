@@ -0,0 +1,116 @@
+package spotify
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// limiter keeps requests to the Spotify Web API under its rate limit. It is
+// shared by all callers of a client, so a 429 response to one of them makes
+// all of them back off. Optionally, it applies a token bucket to smooth out
+// bursts before Spotify even has to tell us to slow down.
+type limiter struct {
+	mu sync.Mutex
+	// blockedUntil is when Spotify allows requests again after it responded
+	// with a 429.
+	blockedUntil time.Time
+
+	// Token bucket. It is disabled if rate is 0.
+	rate, burst float64
+	tokens      float64
+	last        time.Time
+}
+
+// defaultRetryAfter is used when Spotify rate limits without saying for how
+// long.
+const defaultRetryAfter = 1 * time.Second
+
+// WithRateLimit makes the client send at most rps requests per second on
+// average, allowing bursts of up to burst requests.
+func WithRateLimit(rps float64, burst int) Option {
+	return func(c *client) {
+		c.limiter.rate = rps
+		c.limiter.burst = float64(burst)
+		c.limiter.tokens = float64(burst)
+	}
+}
+
+// wait blocks until a request may be sent. If ctx would expire before that, it
+// returns a rate limit error right away instead.
+func (l *limiter) wait(ctx context.Context, nowFunc func() time.Time) error {
+	for {
+		now := nowFunc()
+		d := l.reserve(now)
+		if d <= 0 {
+			return nil
+		}
+		if deadline, ok := ctx.Deadline(); ok && now.Add(d).After(deadline) {
+			return &Error{
+				Status:     http.StatusTooManyRequests,
+				Message:    "rate limit would be exceeded before deadline",
+				RetryAfter: d,
+			}
+		}
+
+		t := time.NewTimer(d)
+		select {
+		case <-ctx.Done():
+			t.Stop()
+			return ctx.Err()
+		case <-t.C:
+		}
+	}
+}
+
+// reserve takes a token from the bucket if a request may be sent at now, and
+// returns 0. Otherwise, it returns how long to wait before trying again.
+func (l *limiter) reserve(now time.Time) time.Duration {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if now.Before(l.blockedUntil) {
+		return l.blockedUntil.Sub(now)
+	}
+	if l.rate <= 0 {
+		return 0
+	}
+
+	if !l.last.IsZero() && now.After(l.last) {
+		l.tokens += now.Sub(l.last).Seconds() * l.rate
+		if l.tokens > l.burst {
+			l.tokens = l.burst
+		}
+	}
+	l.last = now
+	if l.tokens >= 1 {
+		l.tokens--
+		return 0
+	}
+	return time.Duration((1 - l.tokens) / l.rate * float64(time.Second))
+}
+
+// backoff blocks all requests until until.
+func (l *limiter) backoff(until time.Time) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if until.After(l.blockedUntil) {
+		l.blockedUntil = until
+	}
+}
+
+// retryAfter parses the Retry-After header of res, which Spotify sets to the
+// number of seconds to wait. HTTP dates are supported too, just in case.
+func retryAfter(h http.Header, now time.Time) time.Duration {
+	v := h.Get("Retry-After")
+	if secs, err := strconv.Atoi(v); err == nil && secs >= 0 {
+		return time.Duration(secs) * time.Second
+	}
+	if t, err := http.ParseTime(v); err == nil && t.After(now) {
+		return t.Sub(now)
+	}
+	return defaultRetryAfter
+}
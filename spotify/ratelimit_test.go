@@ -0,0 +1,170 @@
+package spotify
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestLimiterReserve(t *testing.T) {
+	t.Run("Disabled", func(t *testing.T) {
+		var l limiter
+		now := time.Now()
+		for i := 0; i < 100; i++ {
+			if d := l.reserve(now); d != 0 {
+				t.Fatalf("Got %s, expected 0", d)
+			}
+		}
+	})
+
+	t.Run("Token bucket", func(t *testing.T) {
+		l := limiter{rate: 2, burst: 3, tokens: 3}
+		now, _ := time.Parse(time.RFC3339, "2000-01-01T00:00:00Z")
+		for i := 0; i < 3; i++ {
+			if d := l.reserve(now); d != 0 {
+				t.Fatalf("Got %s, expected 0", d)
+			}
+		}
+		if d := l.reserve(now); d != 500*time.Millisecond {
+			t.Errorf("Got %s, expected 500ms", d)
+		}
+		if d := l.reserve(now.Add(500 * time.Millisecond)); d != 0 {
+			t.Errorf("Got %s, expected 0", d)
+		}
+		// Tokens never exceed burst.
+		now = now.Add(time.Hour)
+		for i := 0; i < 3; i++ {
+			if d := l.reserve(now); d != 0 {
+				t.Fatalf("Got %s, expected 0", d)
+			}
+		}
+		if d := l.reserve(now); d == 0 {
+			t.Error("Got 0, expected > 0")
+		}
+	})
+
+	t.Run("Backoff", func(t *testing.T) {
+		var l limiter
+		now, _ := time.Parse(time.RFC3339, "2000-01-01T00:00:00Z")
+		l.backoff(now.Add(10 * time.Second))
+		// An earlier deadline does not shorten the backoff.
+		l.backoff(now.Add(5 * time.Second))
+		if d := l.reserve(now); d != 10*time.Second {
+			t.Errorf("Got %s, expected 10s", d)
+		}
+		if d := l.reserve(now.Add(10 * time.Second)); d != 0 {
+			t.Errorf("Got %s, expected 0", d)
+		}
+	})
+}
+
+func TestLimiterWait(t *testing.T) {
+	var l limiter
+	l.backoff(time.Now().Add(time.Minute))
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	start := time.Now()
+	err := l.wait(ctx, time.Now)
+	if !errors.Is(err, ErrRateLimited) {
+		t.Errorf("Got %T (%v), expected ErrRateLimited", err, err)
+	}
+	var serr *Error
+	if errors.As(err, &serr) && serr.RetryAfter <= 0 {
+		t.Errorf("Got %s, expected > 0", serr.RetryAfter)
+	}
+	if d := time.Since(start); d > 100*time.Millisecond {
+		t.Errorf("Got %s, expected to fail fast", d)
+	}
+}
+
+func TestRetryAfter(t *testing.T) {
+	now, _ := time.Parse(time.RFC3339, "2000-01-01T00:00:00Z")
+	for _, tc := range []struct {
+		val string
+		exp time.Duration
+	}{
+		{"3", 3 * time.Second},
+		{"0", 0},
+		{"Sat, 01 Jan 2000 00:00:30 GMT", 30 * time.Second},
+		{"", defaultRetryAfter},
+		{"foo", defaultRetryAfter},
+	} {
+		h := http.Header{}
+		h.Set("Retry-After", tc.val)
+		if d := retryAfter(h, now); d != tc.exp {
+			t.Errorf("%q: Got %s, expected %s", tc.val, d, tc.exp)
+		}
+	}
+}
+
+func TestAPIRequestRateLimited(t *testing.T) {
+	t.Run("Retried", func(t *testing.T) {
+		var calls int
+		ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			calls++
+			if calls == 1 {
+				w.Header().Set("Retry-After", "0")
+				w.WriteHeader(http.StatusTooManyRequests)
+				return
+			}
+			w.WriteHeader(http.StatusNoContent)
+		}))
+		defer ts.Close()
+
+		c := NewClient("foo", "bar", "baz")
+		c.apiBaseURL = ts.URL
+		c.token = &token{
+			bearer:    "secret",
+			expiresAt: c.nowFunc().Add(1800 * time.Second),
+		}
+		if err := c.AddToQueue(context.Background(), "foo"); err != nil {
+			t.Errorf("Got %T (%s), expected nil", err, err)
+		}
+		if calls != 2 {
+			t.Errorf("Got %d, expected 2", calls)
+		}
+	})
+
+	t.Run("Backoff shared by callers", func(t *testing.T) {
+		var calls int
+		ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			calls++
+			w.Header().Set("Retry-After", "60")
+			w.WriteHeader(http.StatusTooManyRequests)
+		}))
+		defer ts.Close()
+
+		c := NewClient("foo", "bar", "baz")
+		c.apiBaseURL = ts.URL
+		c.token = &token{
+			bearer:    "secret",
+			expiresAt: c.nowFunc().Add(1800 * time.Second),
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+		err := c.AddToQueue(ctx, "foo")
+		if !errors.Is(err, ErrRateLimited) {
+			t.Errorf("Got %T (%v), expected ErrRateLimited", err, err)
+		}
+		var serr *Error
+		if !errors.As(err, &serr) {
+			t.Fatalf("Got %T, expected *Error", err)
+		}
+		if serr.RetryAfter <= 50*time.Second {
+			t.Errorf("Got %s, expected about 60s", serr.RetryAfter)
+		}
+
+		// Another caller doesn't even reach Spotify.
+		if _, err := c.Search(ctx, "foo", "", 1); !errors.Is(err, ErrRateLimited) {
+			t.Errorf("Got %T (%v), expected ErrRateLimited", err, err)
+		}
+		if calls != 1 {
+			t.Errorf("Got %d, expected 1", calls)
+		}
+	})
+}
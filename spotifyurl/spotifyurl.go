@@ -0,0 +1,145 @@
+// Package spotifyurl parses the many shapes of links Spotify hands out (URIs,
+// open.spotify.com share links, embed links, ...) into a typed resource.
+package spotifyurl
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// Type is the kind of resource a link refers to.
+type Type string
+
+const (
+	TypeAlbum    Type = "album"
+	TypeArtist   Type = "artist"
+	TypeEpisode  Type = "episode"
+	TypePlaylist Type = "playlist"
+	TypeShow     Type = "show"
+	TypeTrack    Type = "track"
+)
+
+// Link is a parsed reference to a Spotify resource.
+type Link struct {
+	Type Type
+	ID   string
+}
+
+// idLen is the length of a Spotify ID: a base62 encoded 128 bit integer.
+const idLen = 22
+
+var (
+	ErrInvalidID   = errors.New("invalid Spotify ID")
+	ErrUnsupported = errors.New("not a supported Spotify link")
+)
+
+// URI returns the Spotify "URI" for l, e.g. spotify:track:1301WleyT98MSxVHPZCA6M.
+func (l Link) URI() string {
+	return "spotify:" + string(l.Type) + ":" + l.ID
+}
+
+func (l Link) String() string {
+	return l.URI()
+}
+
+// Parse parses s as either a Spotify URI or an open.spotify.com URL. These are
+// all considered equal:
+//
+//	spotify:track:1301WleyT98MSxVHPZCA6M
+//	https://open.spotify.com/track/1301WleyT98MSxVHPZCA6M
+//	https://open.spotify.com/track/1301WleyT98MSxVHPZCA6M?si=FY7aEiPCT0u3-CuNApJTRg
+//	https://open.spotify.com/intl-de/track/1301WleyT98MSxVHPZCA6M
+//	https://open.spotify.com/embed/track/1301WleyT98MSxVHPZCA6M
+//
+// Legacy user scoped playlists (spotify:user:<user>:playlist:<id> and their
+// URL counterpart) are supported as well.
+func Parse(s string) (Link, error) {
+	s = strings.TrimSpace(s)
+	if strings.HasPrefix(s, "spotify:") {
+		return parseURI(s)
+	}
+	return parseURL(s)
+}
+
+func parseURI(s string) (Link, error) {
+	return parseSegments(strings.Split(strings.TrimPrefix(s, "spotify:"), ":"))
+}
+
+func parseURL(s string) (Link, error) {
+	// Links copied from chat apps commonly lack a scheme.
+	if !strings.Contains(s, "://") {
+		s = "https://" + s
+	}
+	u, err := url.Parse(s)
+	if err != nil {
+		return Link{}, fmt.Errorf("%w: %s", ErrUnsupported, err)
+	}
+	if u.Scheme != "https" && u.Scheme != "http" {
+		return Link{}, fmt.Errorf("%w: unexpected scheme %q", ErrUnsupported, u.Scheme)
+	}
+	switch strings.ToLower(u.Hostname()) {
+	case "open.spotify.com", "play.spotify.com":
+	default:
+		return Link{}, fmt.Errorf("%w: unexpected host %q", ErrUnsupported, u.Host)
+	}
+
+	var segs []string
+	for _, seg := range strings.Split(u.Path, "/") {
+		if seg != "" {
+			segs = append(segs, seg)
+		}
+	}
+	// Strip localized and embed prefixes, e.g. /intl-de/embed/track/<id>.
+	for len(segs) > 0 && isPrefix(segs[0]) {
+		segs = segs[1:]
+	}
+	return parseSegments(segs)
+}
+
+// isPrefix reports whether seg is a path segment that may precede the type of
+// resource in a URL, e.g. intl-de or embed.
+func isPrefix(seg string) bool {
+	switch seg {
+	case "embed", "embed-legacy":
+		return true
+	}
+	return strings.HasPrefix(seg, "intl-")
+}
+
+// parseSegments parses the path of a link, without any prefixes, such as
+// [track 1301WleyT98MSxVHPZCA6M] or [user foo playlist 37i9dQZF1DXcBWIGoYBM5M].
+func parseSegments(segs []string) (Link, error) {
+	if len(segs) == 4 && segs[0] == "user" && segs[2] == string(TypePlaylist) {
+		segs = segs[2:]
+	}
+	if len(segs) != 2 {
+		return Link{}, fmt.Errorf("%w: unexpected path %q", ErrUnsupported, strings.Join(segs, "/"))
+	}
+
+	t := Type(segs[0])
+	switch t {
+	case TypeAlbum, TypeArtist, TypeEpisode, TypePlaylist, TypeShow, TypeTrack:
+	default:
+		return Link{}, fmt.Errorf("%w: unknown type %q", ErrUnsupported, segs[0])
+	}
+	if !validID(segs[1]) {
+		return Link{}, fmt.Errorf("%w: %q", ErrInvalidID, segs[1])
+	}
+	return Link{Type: t, ID: segs[1]}, nil
+}
+
+func validID(id string) bool {
+	if len(id) != idLen {
+		return false
+	}
+	for _, r := range id {
+		switch {
+		case r >= '0' && r <= '9', r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z':
+		default:
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,84 @@
+package spotifyurl
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	t.Run("Valid", func(t *testing.T) {
+		for _, tc := range []struct {
+			in  string
+			exp Link
+		}{
+			{"spotify:track:1301WleyT98MSxVHPZCA6M", Link{TypeTrack, "1301WleyT98MSxVHPZCA6M"}},
+			{"  spotify:track:1301WleyT98MSxVHPZCA6M\n", Link{TypeTrack, "1301WleyT98MSxVHPZCA6M"}},
+			{"spotify:album:4aawyAB9vmqN3uQ7FjRGTy", Link{TypeAlbum, "4aawyAB9vmqN3uQ7FjRGTy"}},
+			{"spotify:playlist:37i9dQZF1DXcBWIGoYBM5M", Link{TypePlaylist, "37i9dQZF1DXcBWIGoYBM5M"}},
+			{"spotify:user:spotify:playlist:37i9dQZF1DXcBWIGoYBM5M", Link{TypePlaylist, "37i9dQZF1DXcBWIGoYBM5M"}},
+			{"spotify:episode:512ojhOuo1ktJprKbVcKyQ", Link{TypeEpisode, "512ojhOuo1ktJprKbVcKyQ"}},
+			{"https://open.spotify.com/track/1301WleyT98MSxVHPZCA6M?si=FY7aEiPCT0u3-CuNApJTRg", Link{TypeTrack, "1301WleyT98MSxVHPZCA6M"}},
+			{"https://open.spotify.com/track/1301WleyT98MSxVHPZCA6M", Link{TypeTrack, "1301WleyT98MSxVHPZCA6M"}},
+			{"https://open.spotify.com/track/1301WleyT98MSxVHPZCA6M/", Link{TypeTrack, "1301WleyT98MSxVHPZCA6M"}},
+			{"https://open.spotify.com/track/1301WleyT98MSxVHPZCA6M?si=abc&utm_source=copy-link&nd=1", Link{TypeTrack, "1301WleyT98MSxVHPZCA6M"}},
+			{"https://open.spotify.com/track/1301WleyT98MSxVHPZCA6M#fragment", Link{TypeTrack, "1301WleyT98MSxVHPZCA6M"}},
+			{"http://open.spotify.com/track/1301WleyT98MSxVHPZCA6M", Link{TypeTrack, "1301WleyT98MSxVHPZCA6M"}},
+			{"open.spotify.com/track/1301WleyT98MSxVHPZCA6M", Link{TypeTrack, "1301WleyT98MSxVHPZCA6M"}},
+			{"https://OPEN.SPOTIFY.COM/track/1301WleyT98MSxVHPZCA6M", Link{TypeTrack, "1301WleyT98MSxVHPZCA6M"}},
+			{"https://play.spotify.com/track/1301WleyT98MSxVHPZCA6M", Link{TypeTrack, "1301WleyT98MSxVHPZCA6M"}},
+			{"https://open.spotify.com/intl-de/track/1301WleyT98MSxVHPZCA6M?si=FY7aEiPCT0u3-CuNApJTRg", Link{TypeTrack, "1301WleyT98MSxVHPZCA6M"}},
+			{"https://open.spotify.com/intl-pt/album/4aawyAB9vmqN3uQ7FjRGTy", Link{TypeAlbum, "4aawyAB9vmqN3uQ7FjRGTy"}},
+			{"https://open.spotify.com/embed/track/1301WleyT98MSxVHPZCA6M", Link{TypeTrack, "1301WleyT98MSxVHPZCA6M"}},
+			{"https://open.spotify.com/embed/playlist/37i9dQZF1DXcBWIGoYBM5M?utm_source=generator&theme=0", Link{TypePlaylist, "37i9dQZF1DXcBWIGoYBM5M"}},
+			{"https://open.spotify.com/embed-legacy/track/1301WleyT98MSxVHPZCA6M", Link{TypeTrack, "1301WleyT98MSxVHPZCA6M"}},
+			{"https://open.spotify.com/user/spotify/playlist/37i9dQZF1DXcBWIGoYBM5M", Link{TypePlaylist, "37i9dQZF1DXcBWIGoYBM5M"}},
+			{"https://open.spotify.com/artist/0OdUWJ0sBjDrqHygGUXeCF", Link{TypeArtist, "0OdUWJ0sBjDrqHygGUXeCF"}},
+			{"https://open.spotify.com/show/5CfCWKI5pZ28U0uOzXkDHe", Link{TypeShow, "5CfCWKI5pZ28U0uOzXkDHe"}},
+		} {
+			l, err := Parse(tc.in)
+			if err != nil {
+				t.Errorf("%q: Got %T (%s), expected nil", tc.in, err, err)
+				continue
+			}
+			if l != tc.exp {
+				t.Errorf("%q: Got %+v, expected %+v", tc.in, l, tc.exp)
+			}
+		}
+	})
+
+	t.Run("Invalid", func(t *testing.T) {
+		for _, tc := range []struct {
+			in     string
+			expErr error
+		}{
+			{"", ErrUnsupported},
+			{"notmatching", ErrUnsupported},
+			{"spotify:track", ErrUnsupported},
+			{"spotify:song:1301WleyT98MSxVHPZCA6M", ErrUnsupported},
+			{"spotify:track:1301WleyT98MSxVHPZCA6", ErrInvalidID},
+			{"spotify:track:1301WleyT98MSxVHPZCA6M0", ErrInvalidID},
+			{"spotify:track:1301WleyT98MSxVHPZCA6-", ErrInvalidID},
+			{"https://open.spotify.com/track", ErrUnsupported},
+			{"https://open.spotify.com/track/", ErrUnsupported},
+			{"https://open.spotify.com/track/1301WleyT98MSxVHPZCA6M/extra", ErrUnsupported},
+			{"https://open.spotify.com/track/tooshort", ErrInvalidID},
+			{"https://open.spotify.com.evil.com/track/1301WleyT98MSxVHPZCA6M", ErrUnsupported},
+			{"https://example.com/track/1301WleyT98MSxVHPZCA6M", ErrUnsupported},
+			{"ftp://open.spotify.com/track/1301WleyT98MSxVHPZCA6M", ErrUnsupported},
+			{"https://open.spotify.com/user/spotify", ErrUnsupported},
+			{"https://open.spotify.com/embedded/track/1301WleyT98MSxVHPZCA6M", ErrUnsupported},
+		} {
+			_, err := Parse(tc.in)
+			if !errors.Is(err, tc.expErr) {
+				t.Errorf("%q: Got %T (%v), expected %s", tc.in, err, err, tc.expErr)
+			}
+		}
+	})
+}
+
+func TestURI(t *testing.T) {
+	l := Link{Type: TypeTrack, ID: "1301WleyT98MSxVHPZCA6M"}
+	if uri := l.URI(); uri != "spotify:track:1301WleyT98MSxVHPZCA6M" {
+		t.Errorf("Got %q, expected spotify:track:1301WleyT98MSxVHPZCA6M", uri)
+	}
+}